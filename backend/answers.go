@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gshare.com/platform/models"
+)
+
+var (
+	errAnswerNotFound = errors.New("the comment does not exist on this post")
+	errAnswerIsReply  = errors.New("only top-level comments can be accepted as the answer")
+	errNoAnswer       = errors.New("the post has no accepted answer")
+)
+
+// Accepts a top-level comment as the answer to a post, replacing any answer
+// accepted before
+func setAcceptedAnswer(post *models.Post, commentId string, now time.Time) (models.Comment, error) {
+	var comment models.Comment
+	if err := db.First(&comment, "comment_id = ? AND post_id = ?", commentId, post.PostId).Error; err != nil {
+		return comment, errAnswerNotFound
+	}
+	if comment.ParentID != nil {
+		return comment, errAnswerIsReply
+	}
+	err := db.Model(post).Updates(map[string]any{
+		"accepted_comment_id": comment.CommentId,
+		"accepted_at":         now,
+	}).Error
+	comment.Accepted = true
+	return comment, err
+}
+
+// Takes back the accepted answer of a post
+func removeAcceptedAnswer(post *models.Post) error {
+	if post.AcceptedCommentID == nil {
+		return errNoAnswer
+	}
+	return clearAcceptedAnswer(db, post.PostId, []string{*post.AcceptedCommentID})
+}
+
+// Clears the accepted answer of a post if it is one of the given comments
+func clearAcceptedAnswer(tx *gorm.DB, postId string, commentIds []string) error {
+	return tx.Model(&models.Post{}).
+		Where("post_id = ? AND accepted_comment_id IN ?", postId, commentIds).
+		Updates(map[string]any{"accepted_comment_id": nil, "accepted_at": nil}).Error
+}
+
+// Loads the accepted answer of a post to lead its first page of comments
+func loadAcceptedAnswer(post models.Post) ([]models.Comment, error) {
+	if post.AcceptedCommentID == nil {
+		return nil, nil
+	}
+	var answers []models.Comment
+	if err := db.Where("comment_id = ?", *post.AcceptedCommentID).Find(&answers).Error; err != nil {
+		return nil, err
+	}
+	for i := range answers {
+		answers[i].Accepted = true
+	}
+	return answers, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gshare.com/platform/models"
+)
+
+// Size limits of attachments: per file, and in total per member
+const (
+	maxAttachmentSize     = 10 << 20
+	memberAttachmentQuota = 100 << 20
+)
+
+const maxAttachmentNameLength = 200
+
+// Attachment types that are accepted, by the type sniffed from the content.
+// Each maps the file extensions allowed for that content to the type the file
+// is served as. Office documents are ZIP archives, so they sniff as ZIP.
+var allowedAttachmentTypes = map[string]map[string]string{
+	"application/pdf": {
+		".pdf": "application/pdf",
+	},
+	"text/plain; charset=utf-8": {
+		".txt": "text/plain; charset=utf-8",
+		".md":  "text/markdown; charset=utf-8",
+		".csv": "text/csv; charset=utf-8",
+	},
+	"application/zip": {
+		".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	},
+}
+
+var (
+	errAttachmentTooLarge    = fmt.Errorf("attachments cannot be larger than %d MB", maxAttachmentSize>>20)
+	errAttachmentQuota       = fmt.Errorf("attachments are limited to %d MB per member", memberAttachmentQuota>>20)
+	errAttachmentType        = errors.New("only PDF, text, CSV, Markdown and Word, Excel or PowerPoint files are allowed")
+	errAttachmentNotUploaded = errors.New("unknown attachment ID")
+	errInfected              = errors.New("the file was rejected by the virus scanner")
+	errAttachmentUnreadable  = errors.New("the uploaded file could not be read")
+)
+
+// virusScanner checks uploaded files before they are stored. Scan returns an
+// error wrapping errInfected for files that must be rejected, or any other
+// error if the scan itself failed.
+type virusScanner interface {
+	Scan(fileName string, data []byte) error
+}
+
+// noopScanner accepts every file. It is used when no scanner is configured.
+type noopScanner struct{}
+
+func (noopScanner) Scan(fileName string, data []byte) error {
+	return nil
+}
+
+var attachmentScanner virusScanner = noopScanner{}
+
+// Blob key of an attachment. Attachments share the blob store with images.
+func attachmentKey(attachmentId string) string {
+	return "attachments/" + attachmentId
+}
+
+// Reduces an uploaded file name to something safe to store and send back:
+// no directories, control characters or quotes, and a bounded length
+func sanitizeFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' || r == '/' || r == '\\' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if len(name) > maxAttachmentNameLength {
+		ext := path.Ext(name)
+		if len(ext) > 10 {
+			ext = ""
+		}
+		name = strings.ToValidUTF8(name[:maxAttachmentNameLength-len(ext)], "") + ext
+	}
+	if name == "" || name == "." {
+		return "attachment"
+	}
+	return name
+}
+
+// Content-Disposition header that makes browsers download the file under its
+// name instead of displaying it, with an ASCII fallback for old clients
+func contentDisposition(fileName string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || r == '%' || r == ';' {
+			return '_'
+		}
+		return r
+	}, fileName)
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, fallback, url.PathEscape(fileName))
+}
+
+// Space the member's attachments take up, in bytes
+func attachmentUsage(tx *gorm.DB, uploader string) (int64, error) {
+	var used int64
+	err := tx.Model(&models.Attachment{}).Where("uploader = ?", uploader).
+		Select("COALESCE(SUM(size), 0)").Scan(&used).Error
+	return used, err
+}
+
+// Refuses a file that would take the member past their attachment quota
+func checkAttachmentQuota(tx *gorm.DB, uploader string, size int64) error {
+	used, err := attachmentUsage(tx, uploader)
+	if err != nil {
+		return err
+	}
+	if used+size > memberAttachmentQuota {
+		return errAttachmentQuota
+	}
+	return nil
+}
+
+// Validates, scans and stores an uploaded file
+func storeAttachment(data []byte, fileName, uploader string) (models.Attachment, error) {
+	if len(data) > maxAttachmentSize {
+		return models.Attachment{}, errAttachmentTooLarge
+	}
+	fileName = sanitizeFileName(fileName)
+
+	// The content decides the type; the extension only has to agree with it
+	sniffed := http.DetectContentType(data)
+	contentType, ok := allowedAttachmentTypes[sniffed][strings.ToLower(path.Ext(fileName))]
+	if !ok {
+		return models.Attachment{}, errAttachmentType
+	}
+
+	if err := attachmentScanner.Scan(fileName, data); err != nil {
+		return models.Attachment{}, err
+	}
+
+	sum := sha256.Sum256(data)
+	attachment := models.Attachment{
+		AttachmentId: uuid.New().String(),
+		CreatedAt:    time.Now().UTC(),
+		Uploader:     uploader,
+		FileName:     fileName,
+		ContentType:  contentType,
+		Size:         int64(len(data)),
+		SHA256:       hex.EncodeToString(sum[:]),
+	}
+
+	// The file is stored before its row is inserted, so that a slow upload to
+	// the blob store does not hold the database's write lock. The quota is
+	// checked again with the insert, in case other uploads landed meanwhile.
+	if err := checkAttachmentQuota(db, uploader, attachment.Size); err != nil {
+		return models.Attachment{}, err
+	}
+	if err := blobStore.Put(attachmentKey(attachment.AttachmentId), data, contentType); err != nil {
+		return models.Attachment{}, err
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkAttachmentQuota(tx, uploader, attachment.Size); err != nil {
+			return err
+		}
+		return tx.Create(&attachment).Error
+	})
+	if err != nil {
+		// Nothing refers to the file without its row
+		blobStore.Delete(attachmentKey(attachment.AttachmentId))
+		return models.Attachment{}, err
+	}
+	return attachment, nil
+}
+
+// Reads one file of a multipart upload, refusing it early if it is too large
+func readAttachmentUpload(header *multipart.FileHeader) ([]byte, error) {
+	if header.Size > maxAttachmentSize {
+		return nil, errAttachmentTooLarge
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errAttachmentUnreadable, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxAttachmentSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errAttachmentUnreadable, err)
+	}
+	return data, nil
+}
+
+// Removes attachments stored earlier in an upload that then failed, so they
+// neither linger unlisted nor count against the member's quota
+func discardAttachments(attachments []models.Attachment) {
+	for _, attachment := range attachments {
+		if db.Delete(&attachment).Error == nil {
+			blobStore.Delete(attachmentKey(attachment.AttachmentId))
+		}
+	}
+}
+
+// Reports whether an error is the uploader's fault rather than the server's
+func isAttachmentInputError(err error) bool {
+	return errors.Is(err, errAttachmentTooLarge) || errors.Is(err, errAttachmentQuota) ||
+		errors.Is(err, errAttachmentType) || errors.Is(err, errInfected) || errors.Is(err, errAttachmentUnreadable)
+}
+
+// Checks that the attachments of a post exist and were uploaded by its author
+func resolvePostAttachments(attachmentIds models.StringArray, author string) (models.StringArray, error) {
+	resolved := models.StringArray{}
+	for _, attachmentId := range attachmentIds {
+		var attachment models.Attachment
+		if db.First(&attachment, "attachment_id = ? AND uploader = ?", attachmentId, author).Error != nil {
+			return nil, errAttachmentNotUploaded
+		}
+		resolved = append(resolved, attachment.AttachmentId)
+	}
+	return resolved, nil
+}
+
+// Loads the attachments of a post, in the order the post lists them
+func attachAttachmentDetails(post *models.Post) {
+	post.AttachmentDetails = []models.Attachment{}
+	if len(post.Attachments) == 0 {
+		return
+	}
+
+	var attachments []models.Attachment
+	db.Where("attachment_id IN ?", []string(post.Attachments)).Find(&attachments)
+	byId := make(map[string]models.Attachment, len(attachments))
+	for _, attachment := range attachments {
+		byId[attachment.AttachmentId] = attachment
+	}
+	for _, attachmentId := range post.Attachments {
+		if attachment, ok := byId[attachmentId]; ok {
+			post.AttachmentDetails = append(post.AttachmentDetails, attachment)
+		}
+	}
+}
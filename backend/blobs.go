@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+
+	"gshare.com/platform/storage"
+)
+
+// Where uploaded images and attachments are kept. Replaced from the
+// environment in main.
+var blobStore storage.BlobStore = storage.NewLocalStore("uploads")
+
+// Picks the blob store backend from the environment. BLOB_STORE=s3 uses an
+// S3-compatible bucket configured through the S3_* variables; anything else
+// keeps blobs on disk under BLOB_STORE_DIR (default "uploads"). The older
+// IMAGE_STORE and IMAGE_STORE_DIR names are still read when the new ones are
+// unset.
+func newBlobStore() storage.BlobStore {
+	if blobStoreSetting("") == "s3" {
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		return storage.NewS3Store(os.Getenv("S3_ENDPOINT"), os.Getenv("S3_BUCKET"), region,
+			os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"))
+	}
+
+	dir := blobStoreSetting("_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+	return storage.NewLocalStore(dir)
+}
+
+func blobStoreSetting(suffix string) string {
+	if value := os.Getenv("BLOB_STORE" + suffix); value != "" {
+		return value
+	}
+	return os.Getenv("IMAGE_STORE" + suffix)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gshare.com/platform/models"
+)
+
+const maxCollectionNameLength = 50
+
+var (
+	errCollectionName     = fmt.Errorf("collection names must be between 1 and %d characters", maxCollectionNameLength)
+	errCollectionNotFound = errors.New("collection not found")
+	errInvalidOrder       = errors.New("bookmark_ids must list every bookmark of the collection exactly once")
+)
+
+// Looks up a collection, making sure it belongs to the member
+func findCollection(tx *gorm.DB, owner, collectionId string) (models.Collection, error) {
+	var collection models.Collection
+	if err := tx.First(&collection, "collection_id = ? AND owner = ?", collectionId, owner).Error; err != nil {
+		return collection, errCollectionNotFound
+	}
+	return collection, nil
+}
+
+// Scope selecting the bookmarks of a collection, or the unfiled ones for nil
+func inCollection(collectionId *string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if collectionId == nil {
+			return db.Where("collection_id IS NULL")
+		}
+		return db.Where("collection_id = ?", *collectionId)
+	}
+}
+
+// Position after the last bookmark of a collection
+func nextBookmarkPosition(tx *gorm.DB, owner string, collectionId *string) (int, error) {
+	var last *int
+	err := tx.Model(&models.Bookmark{}).
+		Scopes(inCollection(collectionId)).
+		Where("owner = ?", owner).
+		Select("MAX(position)").
+		Scan(&last).Error
+	if err != nil || last == nil {
+		return 0, err
+	}
+	return *last + 1, nil
+}
+
+// Bookmarks a post or comment, filing it at the end of the collection if one
+// is given. Bookmarking something twice returns the existing bookmark.
+func addBookmark(owner, targetType, targetId string, collectionId *string) (models.Bookmark, bool, error) {
+	var bookmark models.Bookmark
+	created := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if collectionId != nil {
+			if _, err := findCollection(tx, owner, *collectionId); err != nil {
+				return err
+			}
+		}
+		position, err := nextBookmarkPosition(tx, owner, collectionId)
+		if err != nil {
+			return err
+		}
+
+		bookmark = models.Bookmark{
+			BookmarkId:   uuid.New().String(),
+			CreatedAt:    time.Now().UTC(),
+			Owner:        owner,
+			TargetType:   targetType,
+			TargetID:     targetId,
+			CollectionID: collectionId,
+			Position:     position,
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&bookmark)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			bookmark = models.Bookmark{}
+			return tx.First(&bookmark, "owner = ? AND target_type = ? AND target_id = ?", owner, targetType, targetId).Error
+		}
+		created = true
+		return nil
+	})
+	return bookmark, created, err
+}
+
+// Removes every bookmark of a post and of its comments
+func deleteBookmarksOfPost(tx *gorm.DB, postId string) error {
+	comments := tx.Model(&models.Comment{}).Select("comment_id").Where("post_id = ?", postId)
+	return tx.Where("(target_type = ? AND target_id = ?) OR (target_type = ? AND target_id IN (?))",
+		models.BookmarkTargetPost, postId, models.BookmarkTargetComment, comments).
+		Delete(&models.Bookmark{}).Error
+}
+
+// Fills in the post or comment each bookmark points at. Bookmarks whose
+// target is gone or no longer visible are left out.
+func loadBookmarkTargets(bookmarks []models.Bookmark) []models.Bookmark {
+	var postIds, commentIds []string
+	for _, bookmark := range bookmarks {
+		if bookmark.TargetType == models.BookmarkTargetPost {
+			postIds = append(postIds, bookmark.TargetID)
+		} else {
+			commentIds = append(commentIds, bookmark.TargetID)
+		}
+	}
+
+	posts := map[string]*models.Post{}
+	if len(postIds) > 0 {
+		var found []models.Post
+		db.Scopes(published).Where("post_id IN ?", postIds).Find(&found)
+		attachImageDetails(found)
+		for i := range found {
+			found[i].Bookmarked = true
+			posts[found[i].PostId] = &found[i]
+		}
+	}
+	comments := map[string]*models.Comment{}
+	if len(commentIds) > 0 {
+		var found []models.Comment
+		db.Where("comment_id IN ?", commentIds).Find(&found)
+		for i := range found {
+			found[i].Bookmarked = true
+			comments[found[i].CommentId] = &found[i]
+		}
+	}
+
+	loaded := []models.Bookmark{}
+	for _, bookmark := range bookmarks {
+		bookmark.Post = posts[bookmark.TargetID]
+		bookmark.Comment = comments[bookmark.TargetID]
+		if bookmark.Post != nil || bookmark.Comment != nil {
+			loaded = append(loaded, bookmark)
+		}
+	}
+	return loaded
+}
+
+// Sets the bookmarked flag on posts for the given member
+func attachBookmarkFlags(posts []models.Post, username string) {
+	if username == "" || len(posts) == 0 {
+		return
+	}
+	postIds := make([]string, len(posts))
+	for i, post := range posts {
+		postIds[i] = post.PostId
+	}
+	bookmarked := bookmarkedTargets(username, models.BookmarkTargetPost, postIds)
+	for i := range posts {
+		posts[i].Bookmarked = bookmarked[posts[i].PostId]
+	}
+}
+
+// Sets the bookmarked flag on comments for the given member
+func attachCommentBookmarkFlags(comments []models.Comment, username string) {
+	if username == "" || len(comments) == 0 {
+		return
+	}
+	commentIds := make([]string, len(comments))
+	for i, comment := range comments {
+		commentIds[i] = comment.CommentId
+	}
+	bookmarked := bookmarkedTargets(username, models.BookmarkTargetComment, commentIds)
+	for i := range comments {
+		comments[i].Bookmarked = bookmarked[comments[i].CommentId]
+	}
+}
+
+func bookmarkedTargets(username, targetType string, targetIds []string) map[string]bool {
+	var ids []string
+	db.Model(&models.Bookmark{}).
+		Where("owner = ? AND target_type = ? AND target_id IN ?", username, targetType, targetIds).
+		Pluck("target_id", &ids)
+	bookmarked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		bookmarked[id] = true
+	}
+	return bookmarked
+}
+
+// Rewrites the positions of a collection's bookmarks to follow the given
+// order, which must list every bookmark of the collection exactly once
+func reorderCollection(owner, collectionId string, bookmarkIds []string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := findCollection(tx, owner, collectionId); err != nil {
+			return err
+		}
+
+		var current []string
+		if err := tx.Model(&models.Bookmark{}).
+			Where("owner = ? AND collection_id = ?", owner, collectionId).
+			Pluck("bookmark_id", &current).Error; err != nil {
+			return err
+		}
+		if len(current) != len(bookmarkIds) || len(missingFrom(bookmarkIds, current)) > 0 || len(missingFrom(current, bookmarkIds)) > 0 {
+			return errInvalidOrder
+		}
+
+		for position, bookmarkId := range bookmarkIds {
+			if err := tx.Model(&models.Bookmark{}).
+				Where("bookmark_id = ?", bookmarkId).
+				Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
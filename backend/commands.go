@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// Runs a maintenance command named on the command line instead of the
+// server, e.g.
+//
+//	./platform recount-votes
+func runCommand(name string) error {
+	switch name {
+	case "recount-votes":
+		// Repairs counters that drifted from the vote rows
+		if err := recountAllVotes(); err != nil {
+			return err
+		}
+		log.Println("Recounted the likes and dislikes of every post and comment")
+		return nil
+	case "migrate-votes":
+		// Moves votes out of the join tables used before the votes table
+		return migrateLegacyVotes()
+	}
+	return fmt.Errorf("unknown command %q", name)
+}
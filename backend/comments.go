@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"math"
+
+	"gorm.io/gorm"
+	"gshare.com/platform/models"
+)
+
+// Orders comments can be listed in
+const (
+	commentSortNewest = "newest"
+	commentSortOldest = "oldest"
+	commentSortTop    = "top"
+	commentSortBest   = "best"
+)
+
+var errCommentSort = errors.New("sort must be newest, oldest, top or best")
+
+// z-score of the 95% confidence level used by the best sort
+const confidenceZ = 1.96
+
+// Lower bound of the Wilson score interval of a comment's share of likes.
+// Comments with few votes are ranked by how good they can be said to be with
+// confidence, so one like does not beat a hundred likes and a dislike.
+func confidenceScore(likes, dislikes int) float64 {
+	n := float64(likes + dislikes)
+	if n <= 0 {
+		return 0
+	}
+	p := float64(likes) / n
+	z2 := confidenceZ * confidenceZ
+	return (p + z2/(2*n) - confidenceZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
+
+// Returns a page of the comments directly below a parent, or of the
+// top-level comments for nil, in the given order, and the cursor of the next
+// page, which is empty on the last page. The post's accepted answer leads the
+// first page of top-level comments, on top of the page size, and is left out
+// of the pages after it.
+func commentPage(post models.Post, parentId *string, sort, cursor string, limit int) ([]models.Comment, string, error) {
+	query := db.Where("post_id = ?", post.PostId).Scopes(commentLevel(parentId))
+	var answers []models.Comment
+	if parentId == nil && post.AcceptedCommentID != nil {
+		query = query.Where("comment_id <> ?", *post.AcceptedCommentID)
+		if cursor == "" {
+			var err error
+			if answers, err = loadAcceptedAnswer(post); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	var after func(*gorm.DB) *gorm.DB
+	var err error
+	switch sort {
+	case commentSortNewest:
+		after, err = afterCursor("created_at", "comment_id", cursor)
+		query = query.Order("created_at desc").Order("comment_id desc")
+	case commentSortOldest:
+		after, err = afterCursorAsc("created_at", "comment_id", cursor)
+		query = query.Order("created_at asc").Order("comment_id asc")
+	case commentSortTop:
+		after, err = afterScoreCursor("likes", "comment_id", cursor)
+		query = query.Order("likes desc").Order("comment_id desc")
+	case commentSortBest:
+		after, err = afterScoreCursor("best_score", "comment_id", cursor)
+		query = query.Order("best_score desc").Order("comment_id desc")
+	default:
+		return nil, "", errCommentSort
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Fetch one extra comment to know whether there is another page
+	var comments []models.Comment
+	if err := query.Scopes(after).Limit(limit + 1).Find(&comments).Error; err != nil {
+		return nil, "", err
+	}
+	if len(comments) <= limit {
+		return append(answers, comments...), "", nil
+	}
+
+	comments = comments[:limit]
+	last := comments[len(comments)-1]
+	nextCursor := encodeCursor(last.CreatedAt, last.CommentId)
+	switch sort {
+	case commentSortTop:
+		nextCursor = encodeScoreCursor(float64(last.Likes), last.CommentId)
+	case commentSortBest:
+		nextCursor = encodeScoreCursor(last.BestScore, last.CommentId)
+	}
+	return append(answers, comments...), nextCursor, nil
+}
+
+// Scope selecting the comments directly below a parent, or the top-level
+// comments for nil
+func commentLevel(parentId *string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if parentId == nil {
+			return db.Where("parent_id IS NULL")
+		}
+		return db.Where("parent_id = ?", *parentId)
+	}
+}
+
+// Scores comments that were voted on before the best sort existed. Runs at
+// startup.
+func backfillCommentScores() {
+	var comments []models.Comment
+	db.Select("comment_id", "likes", "dislikes").Where("best_score = ? AND likes > ?", 0, 0).Find(&comments)
+	for _, comment := range comments {
+		db.Model(&models.Comment{}).Where("comment_id = ?", comment.CommentId).
+			Update("best_score", confidenceScore(comment.Likes, comment.Dislikes))
+	}
+}
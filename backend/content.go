@@ -0,0 +1,8 @@
+package main
+
+// Longest post and comment content accepted, in bytes. Content is rendered
+// from Markdown every time it is loaded.
+const (
+	maxPostContentLength    = 40000
+	maxCommentContentLength = 10000
+)
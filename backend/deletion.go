@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	"gshare.com/platform/models"
+)
+
+// What a deleted comment that still has replies reads as
+const tombstoneText = "[removed]"
+
+const defaultDeletionRetention = 30 * 24 * time.Hour
+
+// Moderators can restore deleted posts and comments for this long, after
+// which they are purged for good. It can be set with the DELETION_RETENTION
+// environment variable, e.g. "720h".
+var deletionRetention = deletionRetentionFromEnv()
+
+func deletionRetentionFromEnv() time.Duration {
+	if retention, err := time.ParseDuration(os.Getenv("DELETION_RETENTION")); err == nil && retention >= 0 {
+		return retention
+	}
+	return defaultDeletionRetention
+}
+
+var (
+	errNotDeleted      = errors.New("it has not been deleted")
+	errRetentionPassed = errors.New("it was deleted too long ago to be restored")
+	errPostDeleted     = errors.New("the post the comment is on is deleted; restore the post first")
+)
+
+// Deletes a post along with its comments. Both stay restorable until the
+// retention window passes; what lists or points at the post goes right away.
+func softDeletePost(post models.Post, now time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var commentIds []string
+		if err := tx.Model(&models.Comment{}).Where("post_id = ?", post.PostId).Pluck("comment_id", &commentIds).Error; err != nil {
+			return err
+		}
+		if err := deleteBookmarksOfPost(tx, post.PostId); err != nil {
+			return err
+		}
+		if err := deletePinsOfPost(tx, post.PostId); err != nil {
+			return err
+		}
+		if err := deleteRepostsOfPost(tx, post.PostId); err != nil {
+			return err
+		}
+		if err := deleteMentions(tx, models.MentionInPost, []string{post.PostId}); err != nil {
+			return err
+		}
+		if err := deleteMentions(tx, models.MentionInComment, commentIds); err != nil {
+			return err
+		}
+
+		// The comments share the post's deletion time so they come back with it
+		if err := tx.Model(&models.Comment{}).Where("post_id = ?", post.PostId).Update("deleted_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Post{}).Where("post_id = ?", post.PostId).Update("deleted_at", now).Error
+	})
+}
+
+// Deletes a comment. A comment with replies is left in its thread as a
+// tombstone; one without is hidden, along with any tombstones above it that
+// no longer have replies to hold them up.
+func softDeleteComment(comment models.Comment, now time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		ids := []string{comment.CommentId}
+		if err := tx.Where("target_type = ? AND target_id IN ?", models.BookmarkTargetComment, ids).Delete(&models.Bookmark{}).Error; err != nil {
+			return err
+		}
+		if err := deleteMentions(tx, models.MentionInComment, ids); err != nil {
+			return err
+		}
+		if err := clearAcceptedAnswer(tx, comment.PostID, ids); err != nil {
+			return err
+		}
+
+		replies, err := liveReplyCount(tx, comment.CommentId)
+		if err != nil {
+			return err
+		}
+		if replies > 0 {
+			// Keep the text so a moderator can bring it back
+			if _, err := currentCommentRevision(tx, comment); err != nil {
+				return err
+			}
+			return tx.Model(&models.Comment{}).Where("comment_id = ?", comment.CommentId).
+				Updates(map[string]any{"content": tombstoneText, "removed_at": now}).Error
+		}
+
+		current := comment
+		for {
+			if err := tx.Model(&models.Comment{}).Where("comment_id = ?", current.CommentId).Update("deleted_at", now).Error; err != nil {
+				return err
+			}
+			if current.ParentID == nil {
+				return nil
+			}
+			var parent models.Comment
+			if err := tx.First(&parent, "comment_id = ?", *current.ParentID).Error; err != nil {
+				return nil
+			}
+			if parent.RemovedAt == nil {
+				return nil
+			}
+			if replies, err := liveReplyCount(tx, parent.CommentId); err != nil || replies > 0 {
+				return err
+			}
+			current = parent
+		}
+	})
+}
+
+func liveReplyCount(tx *gorm.DB, commentId string) (int64, error) {
+	var count int64
+	err := tx.Model(&models.Comment{}).Where("parent_id = ?", commentId).Count(&count).Error
+	return count, err
+}
+
+// Reports whether something deleted or removed at the given time can still
+// be restored
+func withinRetention(deletedAt, now time.Time) bool {
+	return deletedAt.After(now.Add(-deletionRetention))
+}
+
+// Brings back a deleted post and the comments deleted with it
+func undeletePost(postId string, now time.Time) (models.Post, error) {
+	var post models.Post
+	if err := db.Unscoped().First(&post, "post_id = ?", postId).Error; err != nil {
+		return post, err
+	}
+	if !post.DeletedAt.Valid {
+		return post, errNotDeleted
+	}
+	if !withinRetention(post.DeletedAt.Time, now) {
+		return post, errRetentionPassed
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Comment{}).
+			Where("post_id = ? AND deleted_at = ?", post.PostId, post.DeletedAt.Time).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&models.Post{}).Where("post_id = ?", post.PostId).Update("deleted_at", nil).Error
+	})
+	post.DeletedAt = gorm.DeletedAt{}
+	return post, err
+}
+
+// Brings back a deleted comment, along with the comments above it that were
+// hidden once it was gone, which come back as tombstones. A tombstone that is
+// restored itself gets its text back.
+func undeleteComment(postId, commentId string, now time.Time) (models.Comment, error) {
+	var comment models.Comment
+	if err := db.Unscoped().First(&comment, "comment_id = ? AND post_id = ?", commentId, postId).Error; err != nil {
+		return comment, err
+	}
+	var post models.Post
+	if err := db.First(&post, "post_id = ?", postId).Error; err != nil {
+		return comment, errPostDeleted
+	}
+
+	deletedAt := comment.DeletedAt.Time
+	if comment.RemovedAt != nil {
+		deletedAt = *comment.RemovedAt
+	} else if !comment.DeletedAt.Valid {
+		return comment, errNotDeleted
+	}
+	if !withinRetention(deletedAt, now) {
+		return comment, errRetentionPassed
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if comment.RemovedAt != nil {
+			var original models.CommentRevision
+			if err := tx.Where("comment_id = ?", comment.CommentId).Order("revision desc").First(&original).Error; err != nil {
+				return err
+			}
+			comment.Content = original.Content
+			comment.RemovedAt = nil
+			if err := tx.Unscoped().Model(&models.Comment{}).Where("comment_id = ?", comment.CommentId).
+				Updates(map[string]any{"content": comment.Content, "removed_at": nil}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Model(&models.Comment{}).Where("comment_id = ?", comment.CommentId).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+
+		// Hidden comments above it come back as tombstones, so that a parent
+		// its author deleted stays deleted
+		current := comment
+		for current.ParentID != nil {
+			var parent models.Comment
+			if err := tx.Unscoped().First(&parent, "comment_id = ?", *current.ParentID).Error; err != nil {
+				return err
+			}
+			if parent.DeletedAt.Valid {
+				updates := map[string]any{"deleted_at": nil}
+				if parent.RemovedAt == nil {
+					if _, err := currentCommentRevision(tx, parent); err != nil {
+						return err
+					}
+					updates["content"] = tombstoneText
+					updates["removed_at"] = parent.DeletedAt.Time
+				}
+				if err := tx.Unscoped().Model(&models.Comment{}).Where("comment_id = ?", parent.CommentId).Updates(updates).Error; err != nil {
+					return err
+				}
+			}
+			current = parent
+		}
+		return nil
+	})
+	comment.DeletedAt = gorm.DeletedAt{}
+	return comment, err
+}
+
+// Purges posts and comments deleted longer ago than the retention window,
+// together with the votes, revisions and other records that hang off them,
+// and drops the kept text of old tombstones
+func purgeDeletedContent(now time.Time) error {
+	cutoff := now.Add(-deletionRetention)
+	return db.Transaction(func(tx *gorm.DB) error {
+		var postIds []string
+		if err := tx.Unscoped().Model(&models.Post{}).Where("deleted_at < ?", cutoff).Pluck("post_id", &postIds).Error; err != nil {
+			return err
+		}
+		if len(postIds) > 0 {
+			if err := purgePosts(tx, postIds); err != nil {
+				return err
+			}
+		}
+
+		var commentIds []string
+		if err := tx.Unscoped().Model(&models.Comment{}).Where("deleted_at < ?", cutoff).Pluck("comment_id", &commentIds).Error; err != nil {
+			return err
+		}
+		if len(commentIds) > 0 {
+			if err := purgeComments(tx, commentIds); err != nil {
+				return err
+			}
+		}
+
+		removed := tx.Model(&models.Comment{}).Select("comment_id").Where("removed_at < ?", cutoff)
+		return tx.Where("comment_id IN (?)", removed).Delete(&models.CommentRevision{}).Error
+	})
+}
+
+func purgePosts(tx *gorm.DB, postIds []string) error {
+	var commentIds []string
+	if err := tx.Unscoped().Model(&models.Comment{}).Where("post_id IN ?", postIds).Pluck("comment_id", &commentIds).Error; err != nil {
+		return err
+	}
+	if len(commentIds) > 0 {
+		if err := purgeComments(tx, commentIds); err != nil {
+			return err
+		}
+	}
+
+	if err := deleteVotesOn(tx, models.VoteTargetPost, postIds); err != nil {
+		return err
+	}
+	for _, model := range []any{&models.Assignment{}, &models.PostView{}, &models.PostViewDay{}, &models.PostRevision{}} {
+		if err := tx.Where("post_id IN ?", postIds).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	for _, postId := range postIds {
+		if err := deletePoll(tx, postId); err != nil {
+			return err
+		}
+	}
+	return tx.Unscoped().Where("post_id IN ?", postIds).Delete(&models.Post{}).Error
+}
+
+func purgeComments(tx *gorm.DB, commentIds []string) error {
+	if err := deleteVotesOn(tx, models.VoteTargetComment, commentIds); err != nil {
+		return err
+	}
+	if err := deleteCommentHistory(tx, commentIds); err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("comment_id IN ?", commentIds).Delete(&models.Comment{}).Error
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diff operations
+const (
+	diffEqual  = "equal"
+	diffInsert = "insert"
+	diffDelete = "delete"
+)
+
+// A run of consecutive lines that were kept, added or removed
+type diffOp struct {
+	Op    string   `json:"op"`
+	Lines []string `json:"lines"`
+}
+
+// Texts with more lines than this are not diffed
+const maxDiffLines = 5000
+
+var errDiffTooLarge = fmt.Errorf("revisions longer than %d lines cannot be compared", maxDiffLines)
+
+// Computes a line-based diff between two texts with Myers' algorithm, in
+// space linear in the number of lines
+func diffLines(from, to string) ([]diffOp, error) {
+	a := strings.Split(from, "\n")
+	b := strings.Split(to, "\n")
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		return nil, errDiffTooLarge
+	}
+
+	d := lineDiff{a: a, b: b, deleted: make([]bool, len(a)), inserted: make([]bool, len(b))}
+	d.compare(0, len(a), 0, len(b))
+
+	var ops []diffOp
+	add := func(op, line string) {
+		if len(ops) > 0 && ops[len(ops)-1].Op == op {
+			ops[len(ops)-1].Lines = append(ops[len(ops)-1].Lines, line)
+			return
+		}
+		ops = append(ops, diffOp{Op: op, Lines: []string{line}})
+	}
+
+	// Within a change, removed lines are listed before added ones
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && d.deleted[i]:
+			add(diffDelete, a[i])
+			i++
+		case j < len(b) && d.inserted[j]:
+			add(diffInsert, b[j])
+			j++
+		default:
+			add(diffEqual, a[i])
+			i++
+			j++
+		}
+	}
+	return ops, nil
+}
+
+// Marks which lines of a were deleted and which lines of b were inserted
+type lineDiff struct {
+	a, b              []string
+	deleted, inserted []bool
+}
+
+// Diffs a[aLo:aHi] against b[bLo:bHi] by splitting both at the middle of a
+// shortest edit script and recursing on the halves
+func (d *lineDiff) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	if aLo == aHi {
+		for j := bLo; j < bHi; j++ {
+			d.inserted[j] = true
+		}
+		return
+	}
+	if bLo == bHi {
+		for i := aLo; i < aHi; i++ {
+			d.deleted[i] = true
+		}
+		return
+	}
+
+	x, y, ok := d.middleSnake(aLo, aHi, bLo, bHi)
+	if !ok {
+		for i := aLo; i < aHi; i++ {
+			d.deleted[i] = true
+		}
+		for j := bLo; j < bHi; j++ {
+			d.inserted[j] = true
+		}
+		return
+	}
+	d.compare(aLo, x, bLo, y)
+	d.compare(x, aHi, y, bHi)
+}
+
+// Runs the search for a shortest edit script forwards from the start and
+// backwards from the end of the ranges at the same time, and returns the
+// point where the two meet. The ranges must be non-empty and must neither
+// start nor end with the same line.
+func (d *lineDiff) middleSnake(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	forward := make([]int, 2*maxD+2)
+	backward := make([]int, 2*maxD+2)
+	for k := range forward {
+		forward[k] = -1
+		backward[k] = -1
+	}
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+
+	delta := n - m
+	// With an odd delta the forward search is the one to notice the overlap
+	front := delta%2 != 0
+	var kStart1, kEnd1, kStart2, kEnd2 int
+	for depth := 0; depth < maxD; depth++ {
+		for k := -depth + kStart1; k <= depth-kEnd1; k += 2 {
+			var x int
+			if k == -depth || (k != depth && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			switch {
+			case x > n:
+				kEnd1 += 2
+			case y > m:
+				kStart1 += 2
+			case front:
+				k2 := offset + delta - k
+				if k2 >= 0 && k2 < len(backward) && backward[k2] != -1 && x >= n-backward[k2] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+
+		for k := -depth + kStart2; k <= depth-kEnd2; k += 2 {
+			var x int
+			if k == -depth || (k != depth && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-x-1] == d.b[bHi-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			switch {
+			case x > n:
+				kEnd2 += 2
+			case y > m:
+				kStart2 += 2
+			case !front:
+				k1 := offset + delta - k
+				if k1 >= 0 && k1 < len(forward) && forward[k1] != -1 {
+					x1 := forward[k1]
+					y1 := offset + x1 - k1
+					if x1 >= n-x {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// Returns the entries of to that are missing from from
+func missingFrom(from, to []string) []string {
+	seen := make(map[string]bool, len(from))
+	for _, s := range from {
+		seen[s] = true
+	}
+	missing := []string{}
+	for _, s := range to {
+		if !seen[s] {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"gshare.com/platform/models"
+)
+
+// Posts at least this similar to a new post are reported as likely duplicates
+const duplicateThreshold = 0.6
+
+// Words per shingle
+const shingleSize = 3
+
+// How far back, and how many posts, the near-duplicate check compares against
+const (
+	duplicateLookback      = 7 * 24 * time.Hour
+	maxAuthorDuplicateScan = 50
+	maxSiteDuplicateScan   = 200
+)
+
+// Most similar posts reported back to the author
+const maxDuplicateCandidates = 5
+
+const defaultDuplicateWindow = 24 * time.Hour
+
+// Exact reposts by the same author within this window are rejected. It can be
+// set with the DUPLICATE_POST_WINDOW environment variable, e.g. "72h".
+var duplicateRepostWindow = duplicateWindowFromEnv()
+
+func duplicateWindowFromEnv() time.Duration {
+	if window, err := time.ParseDuration(os.Getenv("DUPLICATE_POST_WINDOW")); err == nil && window >= 0 {
+		return window
+	}
+	return defaultDuplicateWindow
+}
+
+// A post that looks like the one being created
+type duplicateCandidate struct {
+	PostId     string    `json:"post_id"`
+	Title      string    `json:"title"`
+	Author     string    `json:"author"`
+	CreatedAt  time.Time `json:"created_at"`
+	Similarity float64   `json:"similarity"`
+}
+
+// Lowercases text and splits it into words, dropping punctuation, so that
+// reposts differing only in case, spacing or punctuation compare equal
+func normalizedWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Hash of a post's normalized title and content, used to spot exact reposts
+func postContentHash(title, content string) string {
+	normalized := strings.Join(normalizedWords(title), " ") + "\n" + strings.Join(normalizedWords(content), " ")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// Hashes of every run of shingleSize consecutive words of a post. Texts
+// shorter than a shingle count as a single shingle.
+func postShingles(title, content string) map[uint64]bool {
+	words := append(normalizedWords(title), normalizedWords(content)...)
+	shingles := map[uint64]bool{}
+	if len(words) == 0 {
+		return shingles
+	}
+	for i := 0; i+shingleSize <= len(words) || i == 0; i++ {
+		end := min(i+shingleSize, len(words))
+		hash := fnv.New64a()
+		hash.Write([]byte(strings.Join(words[i:end], " ")))
+		shingles[hash.Sum64()] = true
+	}
+	return shingles
+}
+
+// Jaccard similarity of two sets of shingles
+func shingleSimilarity(a, b map[uint64]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for shingle := range a {
+		if b[shingle] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// Looks for an exact repost of the post by its author within the repost
+// window. Drafts do not count until they are published.
+func findExactRepost(post models.Post, now time.Time) (models.Post, bool) {
+	var existing models.Post
+	if duplicateRepostWindow == 0 {
+		return existing, false
+	}
+	err := db.Scopes(published).
+		Where("author = ? AND content_hash = ? AND created_at >= ?", post.Author, post.ContentHash, now.Add(-duplicateRepostWindow)).
+		Order("created_at desc").
+		First(&existing).Error
+	return existing, err == nil
+}
+
+// Compares a new post against the author's latest posts and the site's recent
+// ones, returning the most similar above the threshold. Posts left behind by
+// deleted accounts are skipped since nobody can follow up on them.
+func findDuplicateCandidates(post models.Post, now time.Time) []duplicateCandidate {
+	var posts []models.Post
+	db.Select("post_id", "title", "content", "author", "created_at").
+		Scopes(published).
+		Where("author = ?", post.Author).
+		Order("created_at desc").
+		Limit(maxAuthorDuplicateScan).
+		Find(&posts)
+	var recent []models.Post
+	db.Select("post_id", "title", "content", "author", "created_at").
+		Scopes(published).
+		Where("author NOT IN ? AND created_at >= ?", []string{post.Author, "[deleted]"}, now.Add(-duplicateLookback)).
+		Order("created_at desc").
+		Limit(maxSiteDuplicateScan).
+		Find(&recent)
+	posts = append(posts, recent...)
+
+	shingles := postShingles(post.Title, post.Content)
+	candidates := []duplicateCandidate{}
+	for _, other := range posts {
+		similarity := shingleSimilarity(shingles, postShingles(other.Title, other.Content))
+		if similarity < duplicateThreshold {
+			continue
+		}
+		candidates = append(candidates, duplicateCandidate{
+			PostId:     other.PostId,
+			Title:      other.Title,
+			Author:     other.Author,
+			CreatedAt:  other.CreatedAt,
+			Similarity: similarity,
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Similarity > candidates[j].Similarity
+	})
+	if len(candidates) > maxDuplicateCandidates {
+		candidates = candidates[:maxDuplicateCandidates]
+	}
+	return candidates
+}
+
+// Fills in the content hash of posts created before it was stored. Runs at
+// startup.
+func backfillContentHashes() {
+	var posts []models.Post
+	db.Select("post_id", "title", "content").Where("content_hash = ? OR content_hash IS NULL", "").Find(&posts)
+	for _, post := range posts {
+		db.Model(&models.Post{}).Where("post_id = ?", post.PostId).
+			Update("content_hash", postContentHash(post.Title, post.Content))
+	}
+}
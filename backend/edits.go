@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gshare.com/platform/models"
+)
+
+var (
+	errOwnComment      = errors.New("you cannot report your own comment")
+	errAlreadyReported = errors.New("you have already reported this comment")
+)
+
+// Appends a comment's text as its next revision
+func saveCommentRevision(tx *gorm.DB, commentId, content string, at time.Time) (int, error) {
+	var latest int
+	if err := tx.Model(&models.CommentRevision{}).Where("comment_id = ?", commentId).Select("COALESCE(MAX(revision), 0)").Scan(&latest).Error; err != nil {
+		return 0, err
+	}
+	revision := models.CommentRevision{
+		RevisionId: uuid.New().String(),
+		CommentID:  commentId,
+		Revision:   latest + 1,
+		CreatedAt:  at,
+		Content:    content,
+	}
+	return revision.Revision, tx.Create(&revision).Error
+}
+
+// Returns the revision a comment currently reads as, first saving its text as
+// posted if it has never been edited or reported
+func currentCommentRevision(tx *gorm.DB, comment models.Comment) (int, error) {
+	var latest int
+	if err := tx.Model(&models.CommentRevision{}).Where("comment_id = ?", comment.CommentId).Select("COALESCE(MAX(revision), 0)").Scan(&latest).Error; err != nil {
+		return 0, err
+	}
+	if latest > 0 {
+		return latest, nil
+	}
+	return saveCommentRevision(tx, comment.CommentId, comment.Content, comment.CreatedAt)
+}
+
+// Records an edit of a comment, keeping the text it replaces
+func recordCommentEdit(tx *gorm.DB, previous, current models.Comment, at time.Time) error {
+	if _, err := currentCommentRevision(tx, previous); err != nil {
+		return err
+	}
+	_, err := saveCommentRevision(tx, current.CommentId, current.Content, at)
+	return err
+}
+
+// Flags a comment to the moderators as it currently reads
+func fileCommentReport(comment models.Comment, reporter, reason string, now time.Time) (models.CommentReport, error) {
+	if comment.Author == reporter {
+		return models.CommentReport{}, errOwnComment
+	}
+	report := models.CommentReport{
+		ReportId:  uuid.New().String(),
+		CommentID: comment.CommentId,
+		Reporter:  reporter,
+		CreatedAt: now,
+		Reason:    reason,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var reported int64
+		if err := tx.Model(&models.CommentReport{}).Where("comment_id = ? AND reporter = ?", comment.CommentId, reporter).Count(&reported).Error; err != nil {
+			return err
+		}
+		if reported > 0 {
+			return errAlreadyReported
+		}
+		revision, err := currentCommentRevision(tx, comment)
+		if err != nil {
+			return err
+		}
+		report.Revision = revision
+		return tx.Create(&report).Error
+	})
+	return report, err
+}
+
+// A report of a comment with the text the comment had when it was reported
+type reportedComment struct {
+	models.CommentReport
+	ReportedContent   string `json:"reported_content"`
+	EditedSinceReport bool   `json:"edited_since_report"`
+}
+
+// Lists the reports of a comment, oldest first, each with the text that was
+// reported
+func commentReports(comment models.Comment) ([]reportedComment, error) {
+	var reports []models.CommentReport
+	if err := db.Where("comment_id = ?", comment.CommentId).Order("created_at asc").Find(&reports).Error; err != nil {
+		return nil, err
+	}
+	var revisions []models.CommentRevision
+	if err := db.Where("comment_id = ?", comment.CommentId).Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	contents := make(map[int]string, len(revisions))
+	latest := 0
+	for _, revision := range revisions {
+		contents[revision.Revision] = revision.Content
+		latest = max(latest, revision.Revision)
+	}
+
+	listed := make([]reportedComment, len(reports))
+	for i, report := range reports {
+		listed[i] = reportedComment{
+			CommentReport:     report,
+			ReportedContent:   contents[report.Revision],
+			EditedSinceReport: report.Revision < latest,
+		}
+	}
+	return listed, nil
+}
+
+// Removes the revisions and reports of comments that are being deleted
+func deleteCommentHistory(tx *gorm.DB, commentIds []string) error {
+	if err := tx.Where("comment_id IN ?", commentIds).Delete(&models.CommentRevision{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("comment_id IN ?", commentIds).Delete(&models.CommentReport{}).Error
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gshare.com/platform/models"
+)
+
+// Scope that leaves out expired posts, including those whose deadline has
+// passed but that the scheduler has not closed yet
+func notExpired(now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("posts.status <> ? AND (posts.expires_at IS NULL OR posts.expires_at > ?)", models.PostStatusExpired, now.UTC())
+	}
+}
+
+// Returns an optional time in UTC. Times are stored and compared as text, so
+// ones sent with a client's UTC offset must be normalized first.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// Reports whether two optional times are the same
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// Closes the open posts whose deadline has passed and lets their authors know
+func closeExpiredPosts(now time.Time) error {
+	now = now.UTC()
+	var posts []models.Post
+	err := db.Scopes(published).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at <= ?", models.PostStatusOpen, now).
+		Find(&posts).Error
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		// Only close the post if it is still open and due, in case the author
+		// resolved it or moved the deadline meanwhile
+		result := db.Model(&models.Post{}).
+			Where("post_id = ? AND status = ? AND expires_at <= ?", post.PostId, models.PostStatusOpen, now).
+			Update("status", models.PostStatusExpired)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		title := "Your post has expired"
+		content := fmt.Sprintf("Your post %s passed its deadline and was closed. Edit the deadline to reopen it.", post.Title)
+		sendAutoNotification(post.Author, title, content)
+	}
+	return nil
+}
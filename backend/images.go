@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gshare.com/platform/models"
+)
+
+// Largest image accepted for upload
+const maxImageSize = 5 << 20
+
+// Most images accepted in one upload request
+const maxImagesPerUpload = 10
+
+// Limits on the descriptive text stored with an image
+const (
+	maxAltTextLength = 250
+	maxCaptionLength = 500
+)
+
+// Types that are accepted for upload, as sniffed from the content
+var allowedImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+var (
+	errImageTooLarge    = fmt.Errorf("images cannot be larger than %d MB", maxImageSize>>20)
+	errImageType        = errors.New("only PNG, JPEG and GIF images are allowed")
+	errInvalidDataURL   = errors.New("invalid image data URL")
+	errImageNotUploaded = errors.New("unknown image ID")
+	errImageText        = fmt.Errorf("alt text is limited to %d characters and captions to %d", maxAltTextLength, maxCaptionLength)
+	errTooManyImages    = fmt.Errorf("at most %d images can be uploaded at once", maxImagesPerUpload)
+)
+
+// Blob key of one variant of an image
+func imageKey(imageId, variant string) string {
+	return "images/" + variant + "/" + imageId
+}
+
+// Where images were kept before variants were generated
+func legacyImageKey(imageId string) string {
+	return "images/" + imageId
+}
+
+// Validates and stores an uploaded image along with its resized variants.
+// Metadata such as EXIF GPS tags is stripped before anything is stored.
+// Identical uploads are only stored once and share a record, but every
+// uploader keeps their own alt text and caption, which the returned image
+// carries.
+func storeImage(data []byte, uploader, altText, caption string) (models.Image, error) {
+	if len(data) > maxImageSize {
+		return models.Image{}, errImageTooLarge
+	}
+	if !allowedImageTypes[http.DetectContentType(data)] {
+		return models.Image{}, errImageType
+	}
+	if len(altText) > maxAltTextLength || len(caption) > maxCaptionLength {
+		return models.Image{}, errImageText
+	}
+
+	sum := sha256.Sum256(data)
+	imageId := hex.EncodeToString(sum[:])
+
+	// The record can outlive its blobs, for instance when the store is
+	// replaced, in which case the upload puts them back
+	var existing models.Image
+	found := db.First(&existing, "image_id = ?", imageId).Error == nil
+	if found {
+		stored, err := imageBlobsStored(imageId)
+		if err != nil {
+			return models.Image{}, err
+		}
+		if stored {
+			return describeImage(existing, uploader, altText, caption)
+		}
+	}
+
+	processed, err := processImage(data)
+	if err != nil {
+		return models.Image{}, err
+	}
+	if err := putImageBlobs(imageId, processed); err != nil {
+		return models.Image{}, err
+	}
+	if found {
+		return describeImage(existing, uploader, altText, caption)
+	}
+
+	image := models.Image{
+		ImageId:     imageId,
+		Uploader:    uploader,
+		ContentType: processed.ContentType,
+		Size:        len(processed.Blobs[variantOriginal]),
+		Width:       processed.Width,
+		Height:      processed.Height,
+	}
+	if err := db.Create(&image).Error; err != nil {
+		return models.Image{}, err
+	}
+	return describeImage(image, uploader, altText, caption)
+}
+
+// Records that a member uploaded an image, with their alt text and caption.
+// Uploading it again without either keeps what they said before.
+func describeImage(image models.Image, uploader, altText, caption string) (models.Image, error) {
+	description := models.ImageDescription{ImageID: image.ImageId, Uploader: uploader, AltText: altText, Caption: caption}
+	onConflict := clause.OnConflict{DoNothing: true}
+	if altText != "" || caption != "" {
+		onConflict = clause.OnConflict{DoUpdates: clause.AssignmentColumns([]string{"alt_text", "caption"})}
+	}
+	if err := db.Clauses(onConflict).Create(&description).Error; err != nil {
+		return models.Image{}, err
+	}
+	if err := db.First(&description, "image_id = ? AND uploader = ?", image.ImageId, uploader).Error; err != nil {
+		return models.Image{}, err
+	}
+	image.AltText = description.AltText
+	image.Caption = description.Caption
+	return image, nil
+}
+
+// Hands the descriptions of a member who is being deleted to "[deleted]", so
+// their posts keep their alt text. Where "[deleted]" already described the
+// image, that description stays.
+func disownImageDescriptions(tx *gorm.DB, uploader string) error {
+	if err := tx.Exec("UPDATE OR IGNORE image_descriptions SET uploader = ? WHERE uploader = ?", "[deleted]", uploader).Error; err != nil {
+		return err
+	}
+	return tx.Where("uploader = ?", uploader).Delete(&models.ImageDescription{}).Error
+}
+
+func putImageBlobs(imageId string, processed processedImage) error {
+	for variant, blob := range processed.Blobs {
+		if err := blobStore.Put(imageKey(imageId, variant), blob, variantContentType(processed.ContentType, variant)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reports whether the original and every variant of an image are in the store
+func imageBlobsStored(imageId string) (bool, error) {
+	for _, variant := range []string{variantOriginal, variantMedium, variantThumb} {
+		exists, err := blobStore.Exists(imageKey(imageId, variant))
+		if err != nil || !exists {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Reports whether an error is the uploader's fault rather than the server's
+func isImageInputError(err error) bool {
+	return errors.Is(err, errImageTooLarge) || errors.Is(err, errImageType) || errors.Is(err, errInvalidDataURL) ||
+		errors.Is(err, errNotAnImage) || errors.Is(err, errImageDimensions) || errors.Is(err, errImageText)
+}
+
+// Loads the images attached to each post, in the order the post lists them,
+// so listings can show thumbnails with their alt text without extra requests.
+// Each image is described the way the post's author described it, or else
+// the way its first uploader did.
+func attachImageDetails(posts []models.Post) {
+	var ids []string
+	for _, post := range posts {
+		ids = append(ids, post.Images...)
+	}
+	if len(ids) == 0 {
+		for i := range posts {
+			posts[i].ImageDetails = []models.Image{}
+		}
+		return
+	}
+
+	var images []models.Image
+	db.Where("image_id IN ?", ids).Find(&images)
+	byId := make(map[string]models.Image, len(images))
+	for _, image := range images {
+		byId[image.ImageId] = image
+	}
+
+	type describedBy struct{ imageId, uploader string }
+	var descriptions []models.ImageDescription
+	db.Where("image_id IN ?", ids).Find(&descriptions)
+	described := make(map[describedBy]models.ImageDescription, len(descriptions))
+	for _, description := range descriptions {
+		described[describedBy{description.ImageID, description.Uploader}] = description
+	}
+
+	for i := range posts {
+		posts[i].ImageDetails = []models.Image{}
+		for _, id := range posts[i].Images {
+			image, ok := byId[id]
+			if !ok {
+				continue
+			}
+			description, ok := described[describedBy{id, posts[i].Author}]
+			if !ok {
+				description = described[describedBy{id, image.Uploader}]
+			}
+			image.AltText = description.AltText
+			image.Caption = description.Caption
+			posts[i].ImageDetails = append(posts[i].ImageDetails, image)
+		}
+	}
+}
+
+// Decodes a data URL such as data:image/png;base64,...
+func decodeDataURL(dataURL string) ([]byte, error) {
+	header, payload, found := strings.Cut(strings.TrimPrefix(dataURL, "data:"), ",")
+	if !found || !strings.HasSuffix(header, ";base64") {
+		return nil, errInvalidDataURL
+	}
+	if base64.StdEncoding.DecodedLen(len(payload)) > maxImageSize+3 {
+		return nil, errImageTooLarge
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidDataURL
+	}
+	return data, nil
+}
+
+// Turns the images attached to a post into image IDs. Data URLs, which older
+// clients send inline, are uploaded on the fly; anything else must be the ID
+// of an image that was already uploaded.
+func resolvePostImages(images models.StringArray, uploader string) (models.StringArray, error) {
+	resolved := models.StringArray{}
+	for _, entry := range images {
+		if strings.HasPrefix(entry, "data:") {
+			data, err := decodeDataURL(entry)
+			if err != nil {
+				return nil, err
+			}
+			image, err := storeImage(data, uploader, "", "")
+			if err != nil {
+				return nil, err
+			}
+			resolved = append(resolved, image.ImageId)
+			continue
+		}
+
+		var image models.Image
+		if db.First(&image, "image_id = ?", entry).Error != nil {
+			return nil, errImageNotUploaded
+		}
+		resolved = append(resolved, image.ImageId)
+	}
+	return resolved, nil
+}
+
+// Moves images that older versions stored inline in posts and revisions into
+// the blob store. Runs at startup and is a no-op once everything is migrated.
+func migrateInlineImages() {
+	var posts []models.Post
+	db.Where("images LIKE ?", "%data:%").Find(&posts)
+	for _, post := range posts {
+		images, err := resolvePostImages(post.Images, post.Author)
+		if err != nil {
+			log.Printf("Image migration: skipping post %s: %v", post.PostId, err)
+			continue
+		}
+		db.Model(&models.Post{}).Where("post_id = ?", post.PostId).Update("images", images)
+	}
+
+	var revisions []models.PostRevision
+	db.Where("images LIKE ?", "%data:%").Find(&revisions)
+	for _, revision := range revisions {
+		images, err := resolvePostImages(revision.Images, revision.Editor)
+		if err != nil {
+			log.Printf("Image migration: skipping revision %s: %v", revision.RevisionId, err)
+			continue
+		}
+		db.Model(&models.PostRevision{}).Where("revision_id = ?", revision.RevisionId).Update("images", images)
+	}
+}
+
+// Generates the variants of images uploaded before variants existed and
+// strips their metadata. Runs at startup after migrateInlineImages.
+func migrateImageVariants() {
+	var images []models.Image
+	db.Where("width = ? OR width IS NULL", 0).Find(&images)
+	for _, image := range images {
+		data, err := blobStore.Get(legacyImageKey(image.ImageId))
+		if err != nil {
+			log.Printf("Image migration: skipping image %s: %v", image.ImageId, err)
+			continue
+		}
+		processed, err := processImage(data)
+		if err == nil {
+			err = putImageBlobs(image.ImageId, processed)
+		}
+		if err != nil {
+			log.Printf("Image migration: skipping image %s: %v", image.ImageId, err)
+			continue
+		}
+
+		db.Model(&models.Image{}).Where("image_id = ?", image.ImageId).Updates(map[string]any{
+			"content_type": processed.ContentType,
+			"size":         len(processed.Blobs[variantOriginal]),
+			"width":        processed.Width,
+			"height":       processed.Height,
+		})
+		blobStore.Delete(legacyImageKey(image.ImageId))
+	}
+}
+
+// Moves the alt text and captions that used to be stored on images into
+// per-uploader descriptions. Runs at startup and is a no-op once done.
+func migrateImageDescriptions() {
+	if !db.Migrator().HasColumn("images", "alt_text") {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("INSERT OR IGNORE INTO image_descriptions (image_id, uploader, alt_text, caption) " +
+			"SELECT image_id, uploader, COALESCE(alt_text, ''), COALESCE(caption, '') FROM images").Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("ALTER TABLE images DROP COLUMN alt_text").Error; err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE images DROP COLUMN caption").Error
+	})
+	if err != nil {
+		log.Printf("Image migration: could not move descriptions: %v", err)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// Image variants generated on upload and the longest side of each
+const (
+	variantOriginal = "original"
+	variantMedium   = "medium"
+	variantThumb    = "thumb"
+)
+
+var variantSizes = map[string]int{
+	variantMedium: 800,
+	variantThumb:  200,
+}
+
+// Uploads with more pixels than this are rejected before being decoded. For
+// animations the pixels of every frame count.
+const maxImagePixels = 40_000_000
+
+var (
+	errNotAnImage      = errors.New("the upload is not a valid PNG, JPEG or GIF image")
+	errImageDimensions = errors.New("image dimensions are too large")
+)
+
+// The result of processing an upload: a clean original plus its variants
+type processedImage struct {
+	ContentType string
+	Width       int
+	Height      int
+	Blobs       map[string][]byte
+}
+
+// Decodes an upload, drops all of its metadata by re-encoding the pixels and
+// generates the resized variants. The format is detected from the content
+// itself, never from what the client claims.
+func processImage(data []byte) (processedImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return processedImage{}, errNotAnImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return processedImage{}, errImageDimensions
+	}
+
+	var (
+		original    []byte
+		contentType string
+		frame       image.Image
+	)
+	switch format {
+	case "jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return processedImage{}, errNotAnImage
+		}
+		// Apply the EXIF orientation before the EXIF data is thrown away
+		frame = orient(img, jpegOrientation(data))
+		if original, err = encodeJPEG(frame); err != nil {
+			return processedImage{}, err
+		}
+		contentType = "image/jpeg"
+
+	case "png":
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return processedImage{}, errNotAnImage
+		}
+		frame = img
+		if original, err = encodePNG(frame); err != nil {
+			return processedImage{}, err
+		}
+		contentType = "image/png"
+
+	case "gif":
+		// Every frame is decoded, so all of them have to fit in the budget
+		if pixels, ok := gifFramePixels(data); !ok {
+			return processedImage{}, errNotAnImage
+		} else if pixels > maxImagePixels {
+			return processedImage{}, errImageDimensions
+		}
+
+		// Keep the animation, but only the frames, palette and loop count
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil || len(anim.Image) == 0 {
+			return processedImage{}, errNotAnImage
+		}
+		clean := &gif.GIF{
+			Image:     anim.Image,
+			Delay:     anim.Delay,
+			Disposal:  anim.Disposal,
+			LoopCount: anim.LoopCount,
+			Config:    anim.Config,
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, clean); err != nil {
+			return processedImage{}, err
+		}
+		original = buf.Bytes()
+		frame = anim.Image[0]
+		contentType = "image/gif"
+
+	default:
+		return processedImage{}, errNotAnImage
+	}
+
+	bounds := frame.Bounds()
+	processed := processedImage{
+		ContentType: contentType,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		Blobs:       map[string][]byte{variantOriginal: original},
+	}
+
+	for variant, size := range variantSizes {
+		resized := fitWithin(frame, size)
+		var encoded []byte
+		if contentType == "image/jpeg" {
+			encoded, err = encodeJPEG(resized)
+		} else {
+			encoded, err = encodePNG(resized)
+		}
+		if err != nil {
+			return processedImage{}, err
+		}
+		processed.Blobs[variant] = encoded
+	}
+	return processed, nil
+}
+
+// Content type of a stored variant. Resized GIFs are stored as PNG.
+func variantContentType(originalType, variant string) string {
+	if variant == variantOriginal || originalType == "image/jpeg" {
+		return originalType
+	}
+	return "image/png"
+}
+
+func encodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	return buf.Bytes(), err
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+// Scales an image down so that its longest side is at most size pixels,
+// averaging the source pixels that fall into each destination pixel
+func fitWithin(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return src
+	}
+
+	dstWidth, dstHeight := size, size
+	if width > height {
+		dstHeight = max(1, height*size/width)
+	} else {
+		dstWidth = max(1, width*size/height)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := bounds.Min.Y + y*height/dstHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/dstHeight)
+		for x := 0; x < dstWidth; x++ {
+			x0 := bounds.Min.X + x*width/dstWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/dstWidth)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+// Reads the EXIF orientation (1-8) from a JPEG, or 1 if there is none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// Walk the segments until the APP1 Exif segment
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < entries; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// Adds up the pixels of every frame of a GIF by walking its blocks, without
+// decompressing anything. Reports false if the structure is malformed.
+func gifFramePixels(data []byte) (int64, bool) {
+	if len(data) < 13 {
+		return 0, false
+	}
+	i := 13
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&0x07 + 1)
+	}
+
+	// Skips a chain of data sub-blocks, ending with an empty one
+	skipSubBlocks := func(i int) int {
+		for i < len(data) && data[i] != 0 {
+			i += 1 + int(data[i])
+		}
+		return i + 1
+	}
+
+	var pixels int64
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // extension
+			i = skipSubBlocks(i + 2)
+		case 0x2C: // image descriptor
+			if i+10 > len(data) {
+				return pixels, true
+			}
+			width := int64(binary.LittleEndian.Uint16(data[i+5:]))
+			height := int64(binary.LittleEndian.Uint16(data[i+7:]))
+			pixels += width * height
+			if pixels > maxImagePixels {
+				return pixels, true
+			}
+			packed := data[i+9]
+			i += 10
+			if packed&0x80 != 0 {
+				i += 3 << (packed&0x07 + 1)
+			}
+			// The LZW minimum code size comes before the image data
+			i = skipSubBlocks(i + 1)
+		case 0x3B: // trailer
+			return pixels, true
+		default:
+			return pixels, false
+		}
+	}
+	// Truncated files are left for the decoder to reject
+	return pixels, true
+}
+
+// Rotates and flips an image according to its EXIF orientation
+func orient(src image.Image, orientation int) image.Image {
+	if orientation <= 1 {
+		return src
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = width-1-x, y
+			case 3: // rotated 180
+				dx, dy = width-1-x, height-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, height-1-y
+			case 5: // mirrored along the top-left diagonal
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = height-1-y, x
+			case 7: // mirrored along the top-right diagonal
+				dx, dy = height-1-y, width-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, width-1-x
+			}
+			dst.Set(dx, dy, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dst
+}
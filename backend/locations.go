@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gshare.com/platform/models"
+)
+
+// Campus buildings posts can be placed at. Coordinates are the approximate
+// centre of each building.
+var ufBuildings = []models.Building{
+	{BuildingId: "BEATY", Name: "Beaty Towers", Latitude: 29.6459, Longitude: -82.3410},
+	{BuildingId: "BRO", Name: "Broward Hall", Latitude: 29.6467, Longitude: -82.3433},
+	{BuildingId: "CSE", Name: "Computer Sciences and Engineering Building", Latitude: 29.6484, Longitude: -82.3443},
+	{BuildingId: "CT", Name: "Century Tower", Latitude: 29.6488, Longitude: -82.3425},
+	{BuildingId: "GCD", Name: "Gator Corner Dining Center", Latitude: 29.6463, Longitude: -82.3458},
+	{BuildingId: "HSC", Name: "Health Science Center", Latitude: 29.6404, Longitude: -82.3437},
+	{BuildingId: "HUB", Name: "The Hub", Latitude: 29.6484, Longitude: -82.3456},
+	{BuildingId: "HUME", Name: "Hume Hall", Latitude: 29.6444, Longitude: -82.3509},
+	{BuildingId: "LIBW", Name: "Library West", Latitude: 29.6508, Longitude: -82.3428},
+	{BuildingId: "MALA", Name: "Malachowsky Hall", Latitude: 29.6441, Longitude: -82.3476},
+	{BuildingId: "MSL", Name: "Marston Science Library", Latitude: 29.6481, Longitude: -82.3439},
+	{BuildingId: "NEB", Name: "New Engineering Building", Latitude: 29.6424, Longitude: -82.3472},
+	{BuildingId: "NEW", Name: "Newell Hall", Latitude: 29.6489, Longitude: -82.3449},
+	{BuildingId: "OCON", Name: "Stephen C. O'Connell Center", Latitude: 29.6495, Longitude: -82.3511},
+	{BuildingId: "PLAZA", Name: "Plaza of the Americas", Latitude: 29.6493, Longitude: -82.3429},
+	{BuildingId: "REITZ", Name: "J. Wayne Reitz Union", Latitude: 29.6463, Longitude: -82.3478},
+	{BuildingId: "SHANDS", Name: "UF Health Shands Hospital", Latitude: 29.6399, Longitude: -82.3431},
+	{BuildingId: "STAD", Name: "Ben Hill Griffin Stadium", Latitude: 29.6500, Longitude: -82.3486},
+	{BuildingId: "SWRC", Name: "Southwest Recreation Center", Latitude: 29.6383, Longitude: -82.3686},
+	{BuildingId: "TUR", Name: "Turlington Hall", Latitude: 29.6490, Longitude: -82.3436},
+	{BuildingId: "WEIL", Name: "Weil Hall", Latitude: 29.6479, Longitude: -82.3475},
+}
+
+// Radius of proximity searches, in meters
+const (
+	defaultSearchRadius = 500.0
+	maxSearchRadius     = 10000.0
+)
+
+// Meters per degree of latitude, and of longitude at the equator
+const (
+	metersPerDegreeLat = 110540.0
+	metersPerDegreeLng = 111320.0
+)
+
+var (
+	errUnknownBuilding  = errors.New("unknown building")
+	errInvalidLocation  = errors.New("a location needs both a latitude between -90 and 90 and a longitude between -180 and 180")
+	errLocationRequired = errors.New("sorting by distance needs a lat and lng")
+	errInvalidRadius    = fmt.Errorf("radius must be between 1 and %.0f meters", maxSearchRadius)
+)
+
+// Adds any missing campus buildings. Runs at startup.
+func seedBuildings() {
+	db.Clauses(clause.OnConflict{DoNothing: true}).Create(&ufBuildings)
+}
+
+// Validates the location of a post. A building takes precedence and places
+// the post at the building's coordinates.
+func resolvePostLocation(post *models.Post) error {
+	if post.Building != "" {
+		var building models.Building
+		if err := db.First(&building, "building_id = ?", post.Building).Error; err != nil {
+			return errUnknownBuilding
+		}
+		post.Latitude = &building.Latitude
+		post.Longitude = &building.Longitude
+		return nil
+	}
+	if post.Latitude == nil && post.Longitude == nil {
+		return nil
+	}
+	if post.Latitude == nil || post.Longitude == nil ||
+		math.Abs(*post.Latitude) > 90 || math.Abs(*post.Longitude) > 180 {
+		return errInvalidLocation
+	}
+	return nil
+}
+
+// Squared distance in meters from a point, as SQL. At campus scale the earth
+// is flat enough to treat degrees as a grid scaled by the latitude, which
+// needs nothing but arithmetic from the database.
+func squaredDistanceSQL(lat, lng float64) clause.Expr {
+	ky := metersPerDegreeLat
+	kx := metersPerDegreeLng * math.Cos(lat*math.Pi/180)
+	return gorm.Expr("((posts.latitude - ?) * (posts.latitude - ?) * ? + (posts.longitude - ?) * (posts.longitude - ?) * ?)",
+		lat, lat, ky*ky, lng, lng, kx*kx)
+}
+
+// Filters a listing to a building, or to a radius around a point
+func locationScope(query models.SearchQuery) (func(*gorm.DB) *gorm.DB, error) {
+	if query.Building != "" {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("posts.building = ?", query.Building)
+		}, nil
+	}
+	if query.Lat == nil && query.Lng == nil {
+		return func(db *gorm.DB) *gorm.DB { return db }, nil
+	}
+	if query.Lat == nil || query.Lng == nil || math.Abs(*query.Lat) > 90 || math.Abs(*query.Lng) > 180 {
+		return nil, errInvalidLocation
+	}
+
+	radius := query.Radius
+	if radius == 0 {
+		radius = defaultSearchRadius
+	}
+	if radius < 1 || radius > maxSearchRadius {
+		return nil, errInvalidRadius
+	}
+
+	lat, lng := *query.Lat, *query.Lng
+	dLat := radius / metersPerDegreeLat
+	dLng := radius / (metersPerDegreeLng * math.Cos(lat*math.Pi/180))
+	return func(db *gorm.DB) *gorm.DB {
+		// The bounding box narrows the search down on the indexed
+		// coordinates before distances are computed
+		return db.Where("posts.latitude BETWEEN ? AND ?", lat-dLat, lat+dLat).
+			Where("posts.longitude BETWEEN ? AND ?", lng-dLng, lng+dLng).
+			Where("? <= ?", squaredDistanceSQL(lat, lng), radius*radius)
+	}, nil
+}
+
+// Orders a listing by distance from the queried point, nearest first
+func distanceScope(query models.SearchQuery) (func(*gorm.DB) *gorm.DB, error) {
+	if query.Lat == nil || query.Lng == nil {
+		return nil, errLocationRequired
+	}
+	lat, lng := *query.Lat, *query.Lng
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("posts.latitude IS NOT NULL AND posts.longitude IS NOT NULL").
+			Clauses(clause.OrderBy{Expression: clause.Expr{SQL: "? ASC", Vars: []any{squaredDistanceSQL(lat, lng)}}})
+	}, nil
+}
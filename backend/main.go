@@ -1,15 +1,21 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/glebarez/sqlite"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	swaggerFiles "github.com/swaggo/files"     // swagger embed files
 	ginSwagger "github.com/swaggo/gin-swagger" // gin-swagger middleware
@@ -28,11 +34,17 @@ var db *gorm.DB
 
 func connectDatabase() error {
 	var err error
-	db, err = gorm.Open(sqlite.Open("local.db"), &gorm.Config{})
+	// Times are compared as text in SQLite, so they are all kept in UTC
+	db, err = gorm.Open(sqlite.Open("local.db"), &gorm.Config{
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
 	if err != nil {
 		panic("Error connecting/creating the sqlite db")
 	}
-	db.AutoMigrate(&models.Member{}, &models.Post{}, &models.Comment{}, &models.Notification{})
+	db.AutoMigrate(&models.Member{}, &models.Post{}, &models.Comment{}, &models.Notification{}, &models.Assignment{}, &models.Rating{}, &models.PostRevision{}, &models.Image{}, &models.ImageDescription{}, &models.PostView{}, &models.PostViewDay{}, &models.Bookmark{}, &models.Collection{}, &models.Building{}, &models.Poll{}, &models.PollOption{}, &models.PollBallot{}, &models.PollChoice{}, &models.Attachment{}, &models.Pin{}, &models.Repost{}, &models.Mention{}, &models.CommentRevision{}, &models.CommentReport{}, &models.Vote{})
+	// The feed looks up who a member follows, which the join table's primary key does not cover
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_member_followers_follower ON member_followers(follower_username)")
+	seedBuildings()
 	return err
 }
 
@@ -49,6 +61,28 @@ func main() {
 	err := connectDatabase()
 	checkErr(err)
 
+	// Maintenance commands run in place of the server
+	if len(os.Args) > 1 {
+		checkErr(runCommand(os.Args[1]))
+		return
+	}
+
+	// Votes still in the old join tables would be missing from the votes
+	// table while the counters include them, so they move before serving
+	if err := migrateLegacyVotes(); err != nil {
+		log.Println("Failed to migrate legacy votes:", err)
+	}
+
+	blobStore = newBlobStore()
+	migrateInlineImages()
+	migrateImageVariants()
+	migrateImageDescriptions()
+	backfillPostRankings()
+	backfillContentHashes()
+	backfillCommentScores()
+
+	go runScheduler()
+
 	r := gin.Default()
 
 	r.Use(cors.New(cors.Config{
@@ -85,16 +119,43 @@ func main() {
 		v1.DELETE("member/:username/follow", unfollowMember)
 		v1.GET("member/:username/followers", getFollowers)
 		v1.GET("member/:username/following", getFollowing)
+		v1.GET("feed", getFeed)
 
 		// post routes
 		v1.GET("post", getPosts)
+		v1.GET("post/drafts", getDrafts)
 		v1.GET("post/:postId", getPostById)
 		v1.POST("post", createPost)
 		v1.DELETE("post/:postId", deletePost)
 		v1.PUT("post/:postId", updatePost)
 		v1.GET("member/:username/posts", getUserPosts)
 		v1.PUT("post/:postId/increment-views", incrementPostViews)
+		v1.GET("post/:postId/views", getPostViews)
 		v1.PUT("post/:postId/like-dislike", likeOrDislikePost)
+		v1.GET("post/:postId/revisions", getPostRevisions)
+		v1.GET("post/:postId/revisions/diff", getPostRevisionDiff)
+		v1.PUT("post/:postId/revisions/:revision/restore", restorePostRevision)
+		v1.POST("post/:postId/poll/vote", votePoll)
+		v1.PUT("post/:postId/pin", pinPost)
+		v1.DELETE("post/:postId/pin", unpinPost)
+		v1.PUT("post/:postId/answer", acceptAnswer)
+		v1.DELETE("post/:postId/answer", unacceptAnswer)
+		v1.PUT("post/:postId/restore", restoreDeletedPost)
+		v1.POST("post/:postId/repost", repostPost)
+		v1.DELETE("post/:postId/repost", undoRepost)
+
+		// assignment routes
+		v1.POST("post/:postId/volunteer", volunteerForPost)
+		v1.DELETE("post/:postId/volunteer", withdrawFromPost)
+		v1.PUT("post/:postId/helpers/:username", acceptHelper)
+		v1.DELETE("post/:postId/helpers/:username", removeHelper)
+		v1.GET("member/:username/assignments", getMemberAssignments)
+		v1.PUT("post/:postId/resolve", resolvePost)
+
+		// rating routes
+		v1.POST("post/:postId/ratings", ratePostParticipant)
+		v1.GET("post/:postId/ratings", getPostRatings)
+		v1.GET("member/:username/ratings", getMemberRatings)
 
 		// comment routes
 		v1.GET("comment/:postId/", getComments)
@@ -103,6 +164,38 @@ func main() {
 		v1.PUT("comment/:postId/:commentId", updateComment)
 		v1.DELETE("comment/:postId/:commentId", deleteComment)
 		v1.PUT("comment/:postId/:commentId/like-dislike", likeOrDislikeComment)
+		v1.PUT("comment/:postId/:commentId/restore", restoreDeletedComment)
+		v1.GET("comment/:postId/:commentId/revisions", getCommentRevisions)
+		v1.POST("comment/:postId/:commentId/report", reportComment)
+		v1.GET("comment/:postId/:commentId/reports", getCommentReports)
+
+		// bookmark routes
+		v1.POST("post/:postId/bookmark", bookmarkPost)
+		v1.DELETE("post/:postId/bookmark", unbookmarkPost)
+		v1.POST("comment/:postId/:commentId/bookmark", bookmarkComment)
+		v1.DELETE("comment/:postId/:commentId/bookmark", unbookmarkComment)
+		v1.GET("bookmark", getBookmarks)
+		v1.PUT("bookmark/:bookmarkId", moveBookmark)
+		v1.DELETE("bookmark/:bookmarkId", deleteBookmark)
+		v1.GET("collection", getCollections)
+		v1.POST("collection", createCollection)
+		v1.PUT("collection/:collectionId", renameCollection)
+		v1.DELETE("collection/:collectionId", deleteCollection)
+		v1.PUT("collection/:collectionId/order", reorderCollectionBookmarks)
+
+		// building routes
+		v1.GET("building", getBuildings)
+
+		// image routes
+		v1.POST("image", uploadImages)
+		v1.GET("image/:imageId", getImage)
+		v1.PUT("image/:imageId", updateImage)
+
+		// attachment routes
+		v1.POST("attachment", uploadAttachments)
+		v1.GET("attachment", getAttachments)
+		v1.GET("attachment/:attachmentId", getAttachment)
+		v1.DELETE("attachment/:attachmentId", deleteAttachment)
 
 		// notification routes
 		v1.GET("notification", getNotifications)
@@ -203,6 +296,7 @@ func getMemberByUsername(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No Records Found"})
 		return
 	} else {
+		member.RatingAverage, member.RatingCount = getRatingSummary(member.Username)
 		c.JSON(http.StatusOK, gin.H{"data": member})
 	}
 }
@@ -243,6 +337,9 @@ func register(c *gin.Context) {
 	//Hash the password using bcrypt
 	newMember.Password, _ = hashPassword(newMember.Password)
 
+	//Moderators are appointed, not self-registered
+	newMember.Moderator = false
+
 	//Add to database
 	result := db.Create(&newMember)
 	if result.Error != nil {
@@ -428,12 +525,97 @@ func updateMember(c *gin.Context) {
 		// Update username in posts and comments if changed
 		if updateReq.NewUsername != "" && updateReq.NewUsername != username {
 			// Update posts
-			if err := tx.Model(&models.Post{}).Where("author = ?", username).Update("author", updateReq.NewUsername).Error; err != nil {
+			if err := tx.Unscoped().Model(&models.Post{}).Where("author = ?", username).Update("author", updateReq.NewUsername).Error; err != nil {
 				return err
 			}
 
 			// Update comments
-			if err := tx.Model(&models.Comment{}).Where("author = ?", username).Update("author", updateReq.NewUsername).Error; err != nil {
+			if err := tx.Unscoped().Model(&models.Comment{}).Where("author = ?", username).Update("author", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+
+			// Update assignments
+			if err := tx.Model(&models.Assignment{}).Where("helper = ?", username).Update("helper", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+
+			// Update post revisions
+			if err := tx.Model(&models.PostRevision{}).Where("editor = ?", username).Update("editor", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+
+			// Update post views
+			if err := tx.Model(&models.PostView{}).Where("viewer = ?", username).Update("viewer", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+
+			// Update poll votes
+			if err := tx.Model(&models.PollBallot{}).Where("voter = ?", username).Update("voter", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.PollChoice{}).Where("voter = ?", username).Update("voter", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+
+			// Update bookmarks and collections
+			if err := tx.Model(&models.Bookmark{}).Where("owner = ?", username).Update("owner", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Collection{}).Where("owner = ?", username).Update("owner", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+
+			// Update follow relationships, which the feed relies on
+			if err := tx.Table("member_followers").Where("username = ?", username).Update("username", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+			if err := tx.Table("member_followers").Where("follower_username = ?", username).Update("follower_username", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+
+			// Update mentions
+			if err := tx.Model(&models.Mention{}).Where("username = ?", username).Update("username", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+
+			// Update reposts
+			if err := tx.Model(&models.Repost{}).Where("member = ?", username).Update("member", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+
+			// Update votes
+			if err := tx.Model(&models.Vote{}).Where("member = ?", username).Update("member", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+
+			// Update comment reports
+			if err := tx.Model(&models.CommentReport{}).Where("reporter = ?", username).Update("reporter", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+
+			// Update pins
+			if err := tx.Model(&models.Pin{}).Where("pinned_by = ?", username).Update("pinned_by", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+
+			// Update attachments
+			if err := tx.Model(&models.Attachment{}).Where("uploader = ?", username).Update("uploader", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+
+			// Update images and how the member described them
+			if err := tx.Model(&models.Image{}).Where("uploader = ?", username).Update("uploader", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.ImageDescription{}).Where("uploader = ?", username).Update("uploader", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+
+			// Update ratings
+			if err := tx.Model(&models.Rating{}).Where("rater = ?", username).Update("rater", updateReq.NewUsername).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.Rating{}).Where("ratee = ?", username).Update("ratee", updateReq.NewUsername).Error; err != nil {
 				return err
 			}
 
@@ -500,22 +682,7 @@ func deleteMember(c *gin.Context) {
 
 	// Start a transaction to ensure all updates happen atomically
 	err := db.Transaction(func(tx *gorm.DB) error {
-		// Update posts to mark author as [deleted]
-		if err := tx.Model(&models.Post{}).Where("author = ?", username).Update("author", "[deleted]").Error; err != nil {
-			return err
-		}
-
-		// Update comments to mark author as [deleted]
-		if err := tx.Model(&models.Comment{}).Where("author = ?", username).Update("author", "[deleted]").Error; err != nil {
-			return err
-		}
-
-		// Delete the member
-		if err := tx.Delete(&member).Error; err != nil {
-			return err
-		}
-
-		return nil
+		return removeMember(tx, member)
 	})
 
 	if err != nil {
@@ -526,6 +693,120 @@ func deleteMember(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Member deleted successfully"})
 }
 
+// Deletes a member. Their posts and comments stay behind under "[deleted]";
+// their votes, follows, bookmarks and other personal records go with them.
+func removeMember(tx *gorm.DB, member models.Member) error {
+	username := member.Username
+
+	// Update posts to mark author as [deleted]
+	if err := tx.Unscoped().Model(&models.Post{}).Where("author = ?", username).Update("author", "[deleted]").Error; err != nil {
+		return err
+	}
+
+	// Update comments to mark author as [deleted]
+	if err := tx.Unscoped().Model(&models.Comment{}).Where("author = ?", username).Update("author", "[deleted]").Error; err != nil {
+		return err
+	}
+
+	// Update post revisions to mark editor as [deleted]
+	if err := tx.Model(&models.PostRevision{}).Where("editor = ?", username).Update("editor", "[deleted]").Error; err != nil {
+		return err
+	}
+
+	// Forget where the member was mentioned
+	if err := tx.Where("username = ?", username).Delete(&models.Mention{}).Error; err != nil {
+		return err
+	}
+
+	// Take back the member's votes
+	if err := deleteVotesOf(tx, username); err != nil {
+		return err
+	}
+
+	// Withdraw the member's comment reports
+	if err := tx.Where("reporter = ?", username).Delete(&models.CommentReport{}).Error; err != nil {
+		return err
+	}
+
+	// Take back the member's reposts
+	var reposted []string
+	if err := tx.Model(&models.Repost{}).Where("member = ?", username).Pluck("post_id", &reposted).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("member = ?", username).Delete(&models.Repost{}).Error; err != nil {
+		return err
+	}
+	for _, postId := range reposted {
+		if err := refreshRepostCount(tx, postId); err != nil {
+			return err
+		}
+	}
+
+	// Unpin the member's posts from their profile
+	if err := tx.Where("scope = ? AND pinned_by = ?", models.PinScopeProfile, username).Delete(&models.Pin{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Pin{}).Where("pinned_by = ?", username).Update("pinned_by", "[deleted]").Error; err != nil {
+		return err
+	}
+
+	// Attachments stay available on the posts that share them
+	if err := tx.Model(&models.Attachment{}).Where("uploader = ?", username).Update("uploader", "[deleted]").Error; err != nil {
+		return err
+	}
+
+	// So do images, along with the alt text and captions the member gave them
+	if err := tx.Model(&models.Image{}).Where("uploader = ?", username).Update("uploader", "[deleted]").Error; err != nil {
+		return err
+	}
+	if err := disownImageDescriptions(tx, username); err != nil {
+		return err
+	}
+
+	// Remove the member from any posts they volunteered for
+	if err := tx.Where("helper = ?", username).Delete(&models.Assignment{}).Error; err != nil {
+		return err
+	}
+
+	// Remove the member's follow relationships
+	if err := tx.Exec("DELETE FROM member_followers WHERE username = ? OR follower_username = ?", username, username).Error; err != nil {
+		return err
+	}
+
+	// Remove the member's poll votes
+	if err := tx.Where("voter = ?", username).Delete(&models.PollChoice{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("voter = ?", username).Delete(&models.PollBallot{}).Error; err != nil {
+		return err
+	}
+
+	// Remove the member's bookmarks and collections
+	if err := tx.Where("owner = ?", username).Delete(&models.Bookmark{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("owner = ?", username).Delete(&models.Collection{}).Error; err != nil {
+		return err
+	}
+
+	// Forget which posts the member viewed
+	if err := tx.Where("viewer = ?", username).Delete(&models.PostView{}).Error; err != nil {
+		return err
+	}
+
+	// Remove the ratings the member received
+	if err := tx.Where("ratee = ?", username).Delete(&models.Rating{}).Error; err != nil {
+		return err
+	}
+
+	// Delete the member
+	if err := tx.Delete(&member).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // Options godoc
 //
 // @Summary			Handles OPTIONS requests
@@ -585,12 +866,17 @@ func getUserLikedPosts(c *gin.Context) {
 	username := c.Param("username")
 
 	var member models.Member
-	if err := db.Preload("LikedPosts").First(&member, "username = ?", username).Error; err != nil {
+	if err := db.First(&member, "username = ?", username).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": member.LikedPosts})
+	voted, err := votedPosts(member.Username, models.VoteLike)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": voted})
 }
 
 // GetUserDislikedPosts godoc
@@ -609,21 +895,33 @@ func getUserDislikedPosts(c *gin.Context) {
 	username := c.Param("username")
 
 	var member models.Member
-	if err := db.Preload("DislikedPosts").First(&member, "username = ?", username).Error; err != nil {
+	if err := db.First(&member, "username = ?", username).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": member.DislikedPosts})
+	voted, err := votedPosts(member.Username, models.VoteDislike)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": voted})
 }
 
 // GetPosts godoc
 //
 // @Summary 		Retrieves posts
-// @Description 	Gets a slice of posts using the limit and offset parameters, sorts based on the column and order (desc or asc) parameters, and filters based off the search_key parameter
+// @Description 	Gets a slice of posts using the limit and offset parameters, sorts based on the column and order (desc or asc) parameters, and filters based off the search_key parameter. Posts past their deadline are left out unless include_expired is set. Posts can be filtered to a building, or to a radius around the lat and lng parameters, and sorted nearest first with column distance. The column can also be a ranking mode: hot (time-decayed engagement), rising (recent activity on posts from the last two days) or top (likes minus dislikes within the period parameter: day, week, month or all).
 // @Tags 			post
 // @Accept 			json
 // @Produce 		json
+// @Param 			column query string false "Column to sort by, or hot, rising or top"
+// @Param 			period query string false "Period of the top ranking: day, week, month or all (default)"
+// @Param 			include_expired query bool false "Include posts whose deadline has passed"
+// @Param 			building query string false "Only posts at this building"
+// @Param 			lat query number false "Latitude of the point to search around"
+// @Param 			lng query number false "Longitude of the point to search around"
+// @Param 			radius query number false "Search radius in meters, up to 10000 (default 500)"
 // @Success 		200 {array} models.Post
 // @Failure 		400 {object} string "Bad Request"
 // @Router 			/post [get]
@@ -654,15 +952,76 @@ func getPosts(c *gin.Context) {
 
 	var posts []models.Post
 
-	// Fetch posts ordered by the passed in column, with slices specified
+	// Drafts never show up in listings or search results
+	search := db.Where("title LIKE ?", "%"+postQuery.SearchKey+"%").
+		Or("author LIKE ?", "%"+postQuery.SearchKey+"%").
+		Or("content LIKE ?", "%"+postQuery.SearchKey+"%")
+
+	location, err := locationScope(postQuery)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Expired posts are left out unless asked for
+	now := time.Now().UTC()
+	visible := func(db *gorm.DB) *gorm.DB {
+		db = published(db)
+		if !postQuery.IncludeExpired {
+			db = notExpired(now)(db)
+		}
+		if postQuery.Category != "" {
+			db = db.Where("posts.category = ?", postQuery.Category)
+		}
+		return location(db)
+	}
+
+	// Ranking modes sort on scores maintained as posts get activity
+	ranking, err := rankingScope(postQuery.Column, postQuery.Period, now)
+	if postQuery.Column == "distance" {
+		ranking, err = distanceScope(postQuery)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Pinned posts come first whatever the sort, and the rest of the
+	// listing continues after them
+	pinnedIds := pinnedPostIds(postQuery.Category, now)
+	pinnedQuery := db.Scopes(visible).Where(search)
 	if postQuery.Column == "comments" {
+		pinnedQuery = pinnedQuery.Preload("Comments")
+	}
+	pinned, err := loadPinnedPosts(pinnedQuery, pinnedIds)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pinnedOnPage, offset, limit := pinnedPage(pinned, postQuery.Offset, postQuery.Limit)
+	unpinned := excludingPosts(pinnedIds)
+
+	// Fetch posts ordered by the passed in column, with slices specified
+	if limit == 0 {
+		// The page is filled with pinned posts
+	} else if ranking != nil {
+		result := db.Scopes(visible, unpinned, ranking).
+			Where(search).
+			Limit(limit).
+			Offset(offset).
+			Find(&posts)
+
+		if result.Error != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": result.Error.Error()})
+			return
+		}
+	} else if postQuery.Column == "comments" {
 		result := db.Preload("Comments").
-			Where("title LIKE ?", "%"+postQuery.SearchKey+"%").
-			Or("author LIKE ?", "%"+postQuery.SearchKey+"%").
-			Or("content LIKE ?", "%"+postQuery.SearchKey+"%").
-			Order(fmt.Sprintf("(SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.post_id) %s", postQuery.Order)).
-			Limit(postQuery.Limit).
-			Offset(postQuery.Offset).
+			Scopes(visible, unpinned).
+			Where(search).
+			Order(fmt.Sprintf("(SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.post_id AND comments.deleted_at IS NULL) %s", postQuery.Order)).
+			Limit(limit).
+			Offset(offset).
 			Find(&posts)
 
 		if result.Error != nil {
@@ -670,12 +1029,11 @@ func getPosts(c *gin.Context) {
 			return
 		}
 	} else {
-		result := db.Where("title LIKE ?", "%"+postQuery.SearchKey+"%").
-			Or("author LIKE ?", "%"+postQuery.SearchKey+"%").
-			Or("content LIKE ?", "%"+postQuery.SearchKey+"%").
+		result := db.Scopes(visible, unpinned).
+			Where(search).
 			Order(order).
-			Limit(postQuery.Limit).
-			Offset(postQuery.Offset).
+			Limit(limit).
+			Offset(offset).
 			Find(&posts)
 
 		if result.Error != nil {
@@ -683,22 +1041,28 @@ func getPosts(c *gin.Context) {
 			return
 		}
 	}
+	posts = append(pinnedOnPage, posts...)
 
 	//Get the count
 	var count int64
-	db.Model(&models.Post{}).
-		Where("title LIKE ?", "%"+postQuery.SearchKey+"%").
-		Or("author LIKE ?", "%"+postQuery.SearchKey+"%").
-		Or("content LIKE ?", "%"+postQuery.SearchKey+"%").
-		Count(&count)
+	countQuery := db.Model(&models.Post{}).Scopes(visible, unpinned)
+	if ranking != nil {
+		countQuery = countQuery.Scopes(ranking)
+	}
+	countQuery.Where(search).Count(&count)
+	count += int64(len(pinned))
 
+	attachImageDetails(posts)
+	attachQuotedPosts(posts)
+	attachPostMentions(posts)
+	attachBookmarkFlags(posts, getUsername(c))
 	c.JSON(http.StatusOK, gin.H{"count": count, "data": posts})
 }
 
 // GetPostById godoc
 //
 // @Summary 		Retrieves a specific post by ID
-// @Description 	This API fetches a post and its comments by the post ID
+// @Description 	This API fetches a post by the post ID with the first page of its comment threads, newest first, the total number of comments and the cursor of the next page of comments
 // @Tags 			post
 // @Accept 			json
 // @Produce 		json
@@ -710,30 +1074,60 @@ func getPostById(c *gin.Context) {
 	postId := c.Param("postId")
 	var post models.Post
 
-	// Fetch post and preload its comments ordered by createdAt descending
-	result := db.Preload("Comments", func(db *gorm.DB) *gorm.DB {
-		return db.Order("created_at desc")
+	result := db.Preload("Assignments", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at asc")
 	}).First(&post, "post_id = ?", postId)
 
-	if result.Error != nil {
+	// Drafts are only visible to their author
+	username := getUsername(c)
+	if result.Error != nil || (post.Draft && post.Author != username) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Post not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": post})
+	poll, err := loadPoll(post.PostId, username, time.Now().UTC())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	post.Poll = poll
+
+	// Only the first page of comment threads comes with the post; the rest
+	// is fetched through getComments with comments_next_cursor
+	page, nextCursor, err := commentPage(post, nil, commentSortNewest, "", defaultPageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if post.Comments, err = loadThreads(page, defaultThreadDepth, username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	post.CommentsNextCursor = nextCursor
+	db.Model(&models.Comment{}).Where("post_id = ?", post.PostId).Count(&post.CommentCount)
+
+	posts := []models.Post{post}
+	attachImageDetails(posts)
+	attachAttachmentDetails(&posts[0])
+	attachQuotedPosts(posts)
+	attachPostMentions(posts)
+	attachBookmarkFlags(posts, username)
+	c.JSON(http.StatusOK, gin.H{"data": posts[0]})
 }
 
 // CreatePost godoc
 //
 // @Summary 	Creates a new post
-// @Description This API creates a new post for the logged-in member
+// @Description This API creates a new post for the logged-in member. Posts that look like recent ones are not created; their likely duplicates are returned instead, and the post can be sent again with confirm_duplicate=true. Reposting the same title and content within the repost window is always refused. Set quote_of to the ID of a published post to quote it; the quoted post is embedded as it currently reads.
 // @Tags 		post
 // @Accept 		json
 // @Produce 	json
 // @Param 		post body models.Post true "New post"
+// @Param 		confirm_duplicate query bool false "Create the post even if similar posts exist"
 // @Success 	200 {object} models.Post
 // @Failure 	400 {object} string "Bad Request"
 // @Failure 	401 {object} string "Unauthorized"
+// @Failure 	409 {object} string "Duplicate post"
 // @Router 		/post [post]
 func createPost(c *gin.Context) {
 	if err := Authorize(c); err != nil {
@@ -755,26 +1149,143 @@ func createPost(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Title and Content is required"})
 		return
 	}
+	if len(post.Content) > maxPostContentLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Content cannot exceed %d characters", maxPostContentLength)})
+		return
+	}
+	if err := checkMentions(post.Content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	if post.Images == nil {
-		post.Images = models.StringArray{}
+	images, err := resolvePostImages(post.Images, username)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	post.Images = images
+
+	attachments, err := resolvePostAttachments(post.Attachments, username)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	post.Attachments = attachments
+
+	if err := resolvePostLocation(&post); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateCategory(post.Category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := resolveQuote(&post); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	post.PublishAt = utcTime(post.PublishAt)
+	post.ExpiresAt = utcTime(post.ExpiresAt)
+
+	// Posts scheduled for later are kept as drafts until the scheduler publishes them
+	if post.PublishAt != nil {
+		if !post.PublishAt.After(time.Now().UTC()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Scheduled publish time must be in the future"})
+			return
+		}
+		post.Draft = true
+	}
+
+	// Posts with a deadline are closed by the scheduler once it passes
+	if post.ExpiresAt != nil {
+		if !post.ExpiresAt.After(time.Now().UTC()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry time must be in the future"})
+			return
+		}
+		if post.PublishAt != nil && !post.ExpiresAt.After(*post.PublishAt) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry time must be after the scheduled publish time"})
+			return
+		}
+	}
+
+	// Exact reposts are refused outright; similar posts are only reported
+	// back, and the author can confirm they want to post anyway
+	now := time.Now().UTC()
+	post.ContentHash = postContentHash(post.Title, post.Content)
+	if existing, found := findExactRepost(post, now); found {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already posted this recently", "data": gin.H{"post_id": existing.PostId}})
+		return
+	}
+	if c.Query("confirm_duplicate") != "true" {
+		if candidates := findDuplicateCandidates(post, now); len(candidates) > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"warning": "Similar posts already exist. Resend with confirm_duplicate=true to post anyway.",
+				"data":    candidates,
+			})
+			return
+		}
 	}
+
 	post.PostId = uuid.New().String()
+	post.Status = models.PostStatusOpen
+	post.AcceptedCommentID = nil
+	post.AcceptedAt = nil
+
+	// The poll is stored separately, after the post it belongs to
+	poll := post.Poll
+	post.Poll = nil
+	if poll != nil {
+		if err := preparePoll(poll, post.PostId, time.Now().UTC()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	post.Reposts = 0
+	post.Quotes = 0
 	post.Comments = []models.Comment{}
+	post.Assignments = []models.Assignment{}
 
-	result := db.Create(&post)
-	if result.Error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": result.Error})
+	// New posts start ranked by their age alone
+	post.HotScore = hotScore(0, 0, 0, 0, time.Now().UTC())
+	post.RisingScore = 0
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		if poll != nil {
+			if err := tx.Create(poll).Error; err != nil {
+				return err
+			}
+		}
+		return savePostRevision(tx, post, username, post.CreatedAt)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	if poll != nil {
+		post.Poll, _ = loadPoll(post.PostId, username, time.Now().UTC())
+	}
+	attachAttachmentDetails(&post)
+	if err := recordPostMentions(&post); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record mentions"})
 		return
 	}
 
+	if post.Draft {
+		c.JSON(http.StatusOK, gin.H{"message": "Draft saved successfully", "data": post})
+		return
+	}
+	publishQuote(post)
 	c.JSON(http.StatusOK, gin.H{"message": "Post created successfully", "data": post})
 }
 
 // DeletePost godoc
 //
 // @Summary 	Deletes a post
-// @Description This API deletes a post by its ID if the logged-in member is the author
+// @Description This API deletes a post by its ID if the logged-in member is the author. The post and its comments are hidden right away and purged once moderators can no longer restore them.
 // @Tags 		post
 // @Accept 		json
 // @Produce 	json
@@ -803,67 +1314,257 @@ func deletePost(c *gin.Context) {
 		return
 	}
 
-	db.Delete(&post)
+	if err := softDeletePost(post, time.Now().UTC()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post"})
+		return
+	}
+
+	// Quotes of the post stay up, marked as quoting a deleted post
+	if post.QuoteOf != nil {
+		refreshQuoteCount(db, *post.QuoteOf)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
 }
 
-// UpdatePost godoc
+// RestoreDeletedPost godoc
 //
-// @Summary 	Updates a post
-// @Description This API updates a post's content if the logged-in member is the author
+// @Summary 	Restores a deleted post
+// @Description This API lets moderators bring back a deleted post, with the comments deleted along with it, within the retention window. Bookmarks, pins and reposts of the post are not brought back.
 // @Tags 		post
-// @Accept 		json
 // @Produce 	json
 // @Param 		postId path string true "Post ID"
-// @Param 		post body models.Post true "Updated post"
 // @Success 	200 {object} models.Post
-// @Failure 	400 {object} string "Bad Request"
 // @Failure 	401 {object} string "Unauthorized"
 // @Failure 	403 {object} string "Forbidden"
-// @Router 		/post/{postId} [put]
-func updatePost(c *gin.Context) {
+// @Failure 	404 {object} string "Post not found or not deleted"
+// @Failure 	410 {object} string "Retention window passed"
+// @Router 		/post/{postId}/restore [put]
+func restoreDeletedPost(c *gin.Context) {
 	if err := Authorize(c); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	var post models.Post
-	if err := db.First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+	if !isModerator(getUsername(c)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators can restore deleted posts"})
 		return
 	}
 
-	// Check if the post belongs to the logged-in user
-	username := getUsername(c)
-	if post.Author != username {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only update your own posts"})
+	post, err := undeletePost(c.Param("postId"), time.Now().UTC())
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, errNotDeleted) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found or not deleted"})
 		return
 	}
-
-	if err := c.ShouldBindJSON(&post); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if errors.Is(err, errRetentionPassed) {
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore post"})
 		return
 	}
 
-	// if post.Title == "" || post.Content == "" {
-	// 	c.JSON(http.StatusBadRequest, gin.H{"error": "Title and Content is required"})
+	if post.QuoteOf != nil {
+		refreshQuoteCount(db, *post.QuoteOf)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Post restored successfully", "data": post})
+}
+
+// UpdatePost godoc
+//
+// @Summary 	Updates a post
+// @Description This API updates a post's content if the logged-in member is the author
+// @Tags 		post
+// @Accept 		json
+// @Produce 	json
+// @Param 		postId path string true "Post ID"
+// @Param 		post body models.Post true "Updated post"
+// @Success 	200 {object} models.Post
+// @Failure 	400 {object} string "Bad Request"
+// @Failure 	401 {object} string "Unauthorized"
+// @Failure 	403 {object} string "Forbidden"
+// @Failure 	409 {object} string "Exact repost of a recent post"
+// @Router 		/post/{postId} [put]
+func updatePost(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var post models.Post
+	if err := db.First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	// Check if the post belongs to the logged-in user
+	username := getUsername(c)
+	if post.Author != username {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only update your own posts"})
+		return
+	}
+
+	previous := post
+	wasDraft := post.Draft
+	if err := c.ShouldBindJSON(&post); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// if post.Title == "" || post.Content == "" {
+	// 	c.JSON(http.StatusBadRequest, gin.H{"error": "Title and Content is required"})
 	// 	return
 	// }
 
-	if post.Images == nil {
-		post.Images = models.StringArray{}
+	// The body cannot point the update at another post or author
+	post.PostId = previous.PostId
+	post.Author = previous.Author
+
+	// The edited marker and status are maintained by the server
+	post.Edited = previous.Edited
+	post.EditedAt = previous.EditedAt
+	post.Status = previous.Status
+
+	// Polls cannot be changed once members may have voted on them
+	post.Poll = nil
+
+	// Neither can what a quote post quotes, nor the counters
+	post.QuoteOf = previous.QuoteOf
+	post.QuoteRevision = previous.QuoteRevision
+	post.Reposts = previous.Reposts
+	post.Quotes = previous.Quotes
+
+	// The accepted answer has its own endpoint
+	post.AcceptedCommentID = previous.AcceptedCommentID
+	post.AcceptedAt = previous.AcceptedAt
+
+	// Fields left empty keep their current value
+	if post.Title == "" {
+		post.Title = previous.Title
+	}
+	if post.Content == "" {
+		post.Content = previous.Content
+	}
+	if len(post.Content) > maxPostContentLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Content cannot exceed %d characters", maxPostContentLength)})
+		return
+	}
+	if err := checkMentions(post.Content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	images, err := resolvePostImages(post.Images, username)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	post.Images = images
+
+	attachments, err := resolvePostAttachments(post.Attachments, username)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	post.Attachments = attachments
+
+	if err := resolvePostLocation(&post); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateCategory(post.Category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	post.PublishAt = utcTime(post.PublishAt)
+	post.ExpiresAt = utcTime(post.ExpiresAt)
+
+	// Published posts cannot go back to being drafts
+	if post.Draft && !wasDraft {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A published post cannot be turned into a draft"})
+		return
+	}
+	if post.Draft && post.PublishAt != nil && !post.PublishAt.After(time.Now().UTC()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Scheduled publish time must be in the future"})
+		return
+	}
+	if !post.Draft {
+		post.PublishAt = nil
+	}
+	now := time.Now().UTC()
+	if !sameTime(previous.ExpiresAt, post.ExpiresAt) && post.ExpiresAt != nil && !post.ExpiresAt.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry time must be in the future"})
+		return
 	}
 
 	// Update post with new title, content, and images
-	result := db.Model(&post).Where("post_id = ?", c.Param("postId")).Updates(models.Post{
-		Title:   post.Title,
-		Content: post.Content,
-		Images:  post.Images,
+	post.ContentHash = postContentHash(post.Title, post.Content)
+
+	// A draft going live is checked for exact reposts like a new post
+	if wasDraft && !post.Draft {
+		if existing, found := findExactRepost(post, now); found {
+			c.JSON(http.StatusConflict, gin.H{"error": "You already posted this recently", "data": gin.H{"post_id": existing.PostId}})
+			return
+		}
+	}
+	updates := map[string]any{
+		"title":        post.Title,
+		"content":      post.Content,
+		"content_hash": post.ContentHash,
+		"images":       post.Images,
+		"attachments":  post.Attachments,
+		"draft":        post.Draft,
+		"publish_at":   post.PublishAt,
+		"expires_at":   post.ExpiresAt,
+		"building":     post.Building,
+		"category":     post.Category,
+		"latitude":     post.Latitude,
+		"longitude":    post.Longitude,
+	}
+	if post.Status == models.PostStatusExpired && (post.ExpiresAt == nil || post.ExpiresAt.After(now)) {
+		// Moving or removing the deadline of an expired post reopens it
+		post.Status = models.PostStatusOpen
+		updates["status"] = post.Status
+	}
+	if wasDraft && !post.Draft {
+		// Publishing a draft dates it from the moment it goes live
+		post.CreatedAt = now
+		updates["created_at"] = post.CreatedAt
+	}
+	changed := postContentChanged(previous, post)
+	if changed && !wasDraft {
+		// Readers are told when a published post was changed
+		post.Edited = true
+		post.EditedAt = &now
+		updates["edited"] = post.Edited
+		updates["edited_at"] = post.EditedAt
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&post).Where("post_id = ?", c.Param("postId")).Updates(updates).Error; err != nil {
+			return err
+		}
+		if wasDraft && !post.Draft {
+			if err := refreshPostRanking(tx, post.PostId, 0, now); err != nil {
+				return err
+			}
+		}
+		if !changed {
+			return nil
+		}
+		return recordPostEdit(tx, previous, post, username, now)
 	})
 
-	if result.Error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": result.Error})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	if wasDraft && !post.Draft {
+		publishQuote(post)
+	}
+	if err := recordPostMentions(&post); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record mentions"})
 		return
 	}
+	attachAttachmentDetails(&post)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Post updated successfully", "data": post})
 }
@@ -882,961 +1583,3276 @@ func updatePost(c *gin.Context) {
 func getUserPosts(c *gin.Context) {
 	username := c.Param("username")
 
+	// Posts the member pinned on their profile come first
+	pinnedIds := profilePinnedPostIds(username, time.Now().UTC())
+	pinned, err := loadPinnedPosts(db.Scopes(published).Where("author = ?", username), pinnedIds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	var posts []models.Post
-	result := db.Where("author = ?", username).Find(&posts)
+	result := db.Scopes(published, excludingPosts(pinnedIds)).Where("author = ?", username).Find(&posts)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
+	posts = append(pinned, posts...)
 
+	attachImageDetails(posts)
+	attachQuotedPosts(posts)
+	attachPostMentions(posts)
+	attachBookmarkFlags(posts, getUsername(c))
 	c.JSON(http.StatusOK, gin.H{"data": posts})
 }
 
-// IncrementPostViews godoc
+// GetDrafts godoc
+//
+// @Summary 	Retrieves the logged-in member's drafts
+// @Description This API fetches the unpublished drafts and scheduled posts of the logged-in member, most recently created first
+// @Tags 		post
+// @Accept 		json
+// @Produce 	json
+// @Success 	200 {array} models.Post
+// @Failure 	401 {object} string "Unauthorized"
+// @Failure 	500 {object} string "Internal Server Error"
+// @Router 		/post/drafts [get]
+func getDrafts(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var posts []models.Post
+	result := db.Where("author = ? AND draft = ?", getUsername(c), true).Order("created_at desc").Find(&posts)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	attachImageDetails(posts)
+	attachQuotedPosts(posts)
+	attachPostMentions(posts)
+	attachBookmarkFlags(posts, getUsername(c))
+	c.JSON(http.StatusOK, gin.H{"data": posts})
+}
+
+// GetPostRevisions godoc
 //
-// @Summary 	Increments the view count of a post
-// @Description This API increments the view count of a specific post by its ID
+// @Summary 	Retrieves the revision history of a post
+// @Description This API lists every saved revision of a post, oldest first, with its editor and timestamp
 // @Tags 		post
 // @Accept 		json
 // @Produce 	json
 // @Param 		postId path string true "Post ID"
-// @Success 	200 {object} string
+// @Success 	200 {array} models.PostRevision
+// @Failure 	404 {object} string "Post not found"
+// @Router 		/post/{postId}/revisions [get]
+func getPostRevisions(c *gin.Context) {
+	var post models.Post
+	if err := db.First(&post, "post_id = ?", c.Param("postId")).Error; err != nil || (post.Draft && post.Author != getUsername(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	var revisions []models.PostRevision
+	result := db.Where("post_id = ?", post.PostId).Order("revision asc").Find(&revisions)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": revisions})
+}
+
+// GetPostRevisionDiff godoc
+//
+// @Summary 	Compares two revisions of a post
+// @Description This API returns a line-based diff of the title and content, and the images added or removed, between two revisions of a post. By default it compares the latest revision to the one before it.
+// @Tags 		post
+// @Accept 		json
+// @Produce 	json
+// @Param 		postId path string true "Post ID"
+// @Param 		from query int false "Revision to compare from"
+// @Param 		to query int false "Revision to compare to"
+// @Success 	200 {object} map[string]interface{} "Diff between the revisions"
 // @Failure 	400 {object} string "Bad Request"
-// @Router 		/post/{postId}/increment-views [put]
-func incrementPostViews(c *gin.Context) {
-	postId := c.Param("postId")
+// @Failure 	404 {object} string "Post or revision not found"
+// @Failure 	413 {object} string "Revisions too long to compare"
+// @Router 		/post/{postId}/revisions/diff [get]
+func getPostRevisionDiff(c *gin.Context) {
+	var post models.Post
+	if err := db.First(&post, "post_id = ?", c.Param("postId")).Error; err != nil || (post.Draft && post.Author != getUsername(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	var diffQuery struct {
+		From int `form:"from"`
+		To   int `form:"to"`
+	}
+	if err := c.ShouldBindQuery(&diffQuery); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Default to the latest revision and the one before it
+	if diffQuery.To == 0 {
+		var latest models.PostRevision
+		if err := db.Where("post_id = ?", post.PostId).Order("revision desc").First(&latest).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		}
+		diffQuery.To = latest.Revision
+	}
+	if diffQuery.From == 0 {
+		diffQuery.From = max(diffQuery.To-1, 1)
+	}
+
+	var from, to models.PostRevision
+	if db.First(&from, "post_id = ? AND revision = ?", post.PostId, diffQuery.From).Error != nil ||
+		db.First(&to, "post_id = ? AND revision = ?", post.PostId, diffQuery.To).Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	}
+
+	title, err := diffLines(from.Title, to.Title)
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	content, err := diffLines(from.Content, to.Content)
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"from":           from.Revision,
+		"to":             to.Revision,
+		"title":          title,
+		"content":        content,
+		"images_added":   missingFrom(from.Images, to.Images),
+		"images_removed": missingFrom(to.Images, from.Images),
+	}})
+}
+
+// RestorePostRevision godoc
+//
+// @Summary 	Restores an earlier revision of a post
+// @Description This API brings a post's title, content and images back to a previous revision. The restore is saved as a new revision. Only the author or a moderator can restore.
+// @Tags 		post
+// @Accept 		json
+// @Produce 	json
+// @Param 		postId path string true "Post ID"
+// @Param 		revision path int true "Revision number"
+// @Success 	200 {object} models.Post
+// @Failure 	401 {object} string "Unauthorized"
+// @Failure 	403 {object} string "Forbidden"
+// @Failure 	404 {object} string "Post or revision not found"
+// @Router 		/post/{postId}/revisions/{revision}/restore [put]
+func restorePostRevision(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	username := getUsername(c)
+	if post.Author != username && !isModerator(username) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only restore your own posts"})
+		return
+	}
+
+	var revision models.PostRevision
+	if err := db.First(&revision, "post_id = ? AND revision = ?", post.PostId, c.Param("revision")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	}
+
+	previous := post
+	post.Title = revision.Title
+	post.Content = revision.Content
+	post.Images = revision.Images
+	if post.Images == nil {
+		post.Images = models.StringArray{}
+	}
+
+	if !postContentChanged(previous, post) {
+		c.JSON(http.StatusOK, gin.H{"message": "Post already matches this revision", "data": post})
+		return
+	}
+
+	now := time.Now().UTC()
+	post.ContentHash = postContentHash(post.Title, post.Content)
+	updates := map[string]any{
+		"title":        post.Title,
+		"content":      post.Content,
+		"content_hash": post.ContentHash,
+		"images":       post.Images,
+	}
+	if !post.Draft {
+		post.Edited = true
+		post.EditedAt = &now
+		updates["edited"] = post.Edited
+		updates["edited_at"] = post.EditedAt
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&post).Where("post_id = ?", post.PostId).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordPostEdit(tx, previous, post, username, now)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore revision"})
+		return
+	}
+	if err := recordPostMentions(&post); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record mentions"})
+		return
+	}
+
+	if post.Author != username {
+		title := "Your post was restored by a moderator"
+		content := fmt.Sprintf("%s restored your post %s to revision %d", username, post.Title, revision.Revision)
+		sendAutoNotification(post.Author, title, content)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Revision restored successfully", "data": post})
+}
+
+// VotePoll godoc
+//
+// @Summary 	Votes on the poll of a post
+// @Description This API records the logged-in member's vote on a post's poll and returns the results. Members can vote once; polls that allow multiple choices take several option IDs in that single vote.
+// @Tags 		post
+// @Accept 		json
+// @Produce 	json
+// @Param 		postId path string true "Post ID"
+// @Success 	200 {object} models.Poll
+// @Failure 	400 {object} string "Invalid choice or poll closed"
+// @Failure 	401 {object} string "Unauthorized"
+// @Failure 	404 {object} string "Poll not found"
+// @Failure 	409 {object} string "Already voted"
+// @Router 		/post/{postId}/poll/vote [post]
+func votePoll(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var post models.Post
+	if err := db.Scopes(published).First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	var request struct {
+		OptionIds []string `json:"option_ids"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	username := getUsername(c)
+	now := time.Now().UTC()
+	poll, err := loadPoll(post.PostId, username, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if poll == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "This post has no poll"})
+		return
+	}
+
+	err = castPollVote(*poll, username, request.OptionIds, now)
+	if errors.Is(err, errAlreadyVoted) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errPollClosed) || errors.Is(err, errInvalidChoice) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record vote"})
+		return
+	}
+
+	poll, _ = loadPoll(post.PostId, username, now)
+	c.JSON(http.StatusOK, gin.H{"message": "Vote recorded", "data": poll})
+}
+
+// RepostPost godoc
+//
+// @Summary 	Reposts a post
+// @Description This API shares a post with the logged-in member's followers, who see it in their feeds. Members can repost a post once, and not their own. The post's author is notified.
+// @Tags 		post
+// @Produce 	json
+// @Param 		postId path string true "Post ID"
+// @Success 	200 {object} models.Post
+// @Failure 	400 {object} string "Own post"
+// @Failure 	401 {object} string "Unauthorized"
+// @Failure 	404 {object} string "Post not found"
+// @Failure 	409 {object} string "Already reposted"
+// @Router 		/post/{postId}/repost [post]
+func repostPost(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var post models.Post
+	if err := db.Scopes(published).First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	username := getUsername(c)
+	err := addRepost(post, username, time.Now().UTC())
+	if errors.Is(err, errOwnRepost) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errAlreadyReposted) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to repost"})
+		return
+	}
+
+	title := "Your post was reposted"
+	content := fmt.Sprintf("%s reposted your post %s", username, post.Title)
+	sendAutoNotification(post.Author, title, content)
+
+	db.First(&post, "post_id = ?", post.PostId)
+	c.JSON(http.StatusOK, gin.H{"message": "Post reposted successfully", "data": post})
+}
+
+// UndoRepost godoc
+//
+// @Summary 	Takes back a repost
+// @Description This API removes the logged-in member's repost of a post from their followers' feeds.
+// @Tags 		post
+// @Produce 	json
+// @Param 		postId path string true "Post ID"
+// @Success 	200 {object} string
+// @Failure 	401 {object} string "Unauthorized"
+// @Failure 	404 {object} string "Not reposted"
+// @Router 		/post/{postId}/repost [delete]
+func undoRepost(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	err := removeRepost(c.Param("postId"), getUsername(c))
+	if errors.Is(err, errNotReposted) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to undo repost"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Repost removed successfully"})
+}
+
+// PinPost godoc
+//
+// @Summary 	Pins a post to the top of a listing
+// @Description This API pins a post so it is listed first whatever the sort. Moderators pin posts to the top of all posts (scope "global") or of the post's category (scope "category"); authors pin up to 3 of their own posts on their profile (scope "profile"). Pins can be given an expiry; pinning a post again moves it.
+// @Tags 		post
+// @Accept 		json
+// @Produce 	json
+// @Param 		postId path string true "Post ID"
+// @Success 	200 {object} models.Pin
+// @Failure 	400 {object} string "Bad Request"
+// @Failure 	401 {object} string "Unauthorized"
+// @Failure 	403 {object} string "Forbidden"
+// @Failure 	404 {object} string "Post not found"
+// @Failure 	409 {object} string "Too many pins"
+// @Router 		/post/{postId}/pin [put]
+func pinPost(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var post models.Post
+	if err := db.Scopes(published).First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	var request struct {
+		Scope     string     `json:"scope" binding:"required"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	username := getUsername(c)
+	if !canPin(post, request.Scope, username) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators can feature posts, and members can only pin their own posts"})
+		return
+	}
+
+	pin, err := savePin(post, request.Scope, username, request.ExpiresAt, time.Now().UTC())
+	if errors.Is(err, errTooManyPins) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errPinScope) || errors.Is(err, errPinExpiry) || errors.Is(err, errNoCategory) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin post"})
+		return
+	}
+
+	if post.Author != username {
+		title := "Your post was featured"
+		content := fmt.Sprintf("%s pinned your post %s", username, post.Title)
+		sendAutoNotification(post.Author, title, content)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Post pinned successfully", "data": pin})
+}
+
+// UnpinPost godoc
+//
+// @Summary 	Unpins a post
+// @Description This API removes a pin from a post. The same rules as for pinning decide who may remove it.
+// @Tags 		post
+// @Produce 	json
+// @Param 		postId path string true "Post ID"
+// @Param 		scope query string true "global, category or profile"
+// @Success 	200 {object} string
+// @Failure 	401 {object} string "Unauthorized"
+// @Failure 	403 {object} string "Forbidden"
+// @Failure 	404 {object} string "Post not found or not pinned"
+// @Router 		/post/{postId}/pin [delete]
+func unpinPost(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	scope := c.Query("scope")
+	if !canPin(post, scope, getUsername(c)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators can unfeature posts, and members can only unpin their own posts"})
+		return
+	}
+
+	err := removePin(post.PostId, scope)
+	if errors.Is(err, errNotPinned) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unpin post"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Post unpinned successfully"})
+}
+
+// AcceptAnswer godoc
+//
+// @Summary 	Accepts a comment as the answer to a post
+// @Description This API lets the author of a post mark one of its top-level comments as the accepted answer. The accepted answer is listed first among the post's comments. Accepting another comment replaces it. The comment's author is notified.
+// @Tags 		post
+// @Accept 		json
+// @Produce 	json
+// @Param 		postId path string true "Post ID"
+// @Success 	200 {object} models.Comment
+// @Failure 	400 {object} string "Bad Request"
+// @Failure 	401 {object} string "Unauthorized"
+// @Failure 	403 {object} string "Forbidden"
+// @Failure 	404 {object} string "Post or comment not found"
+// @Router 		/post/{postId}/answer [put]
+func acceptAnswer(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var post models.Post
+	if err := db.Scopes(published).First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	var request struct {
+		CommentID string `json:"comment_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	username := getUsername(c)
+	if post.Author != username {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author of the post can accept an answer"})
+		return
+	}
+
+	wasAccepted := post.AcceptedCommentID != nil && *post.AcceptedCommentID == request.CommentID
+	comment, err := setAcceptedAnswer(&post, request.CommentID, time.Now().UTC())
+	if errors.Is(err, errAnswerNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errAnswerIsReply) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept answer"})
+		return
+	}
+
+	if !wasAccepted && comment.Author != username {
+		title := "Your answer was accepted"
+		content := fmt.Sprintf("%s accepted your comment as the answer to %s", username, post.Title)
+		sendAutoNotification(comment.Author, title, content)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Answer accepted successfully", "data": comment})
+}
+
+// UnacceptAnswer godoc
+//
+// @Summary 	Takes back the accepted answer of a post
+// @Description This API lets the author of a post un-accept its accepted answer. The comment is kept and listed like any other.
+// @Tags 		post
+// @Produce 	json
+// @Param 		postId path string true "Post ID"
+// @Success 	200 {object} string
+// @Failure 	401 {object} string "Unauthorized"
+// @Failure 	403 {object} string "Forbidden"
+// @Failure 	404 {object} string "Post not found or no accepted answer"
+// @Router 		/post/{postId}/answer [delete]
+func unacceptAnswer(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	if post.Author != getUsername(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author of the post can un-accept its answer"})
+		return
+	}
+
+	err := removeAcceptedAnswer(&post)
+	if errors.Is(err, errNoAnswer) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to un-accept answer"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Answer un-accepted successfully"})
+}
+
+// IncrementPostViews godoc
+//
+// @Summary 	Counts a view of a post
+// @Description This API counts a view of a specific post by its ID. Each member, or anonymous client, is only counted once per day; repeat views return counted false.
+// @Tags 		post
+// @Accept 		json
+// @Produce 	json
+// @Param 		postId path string true "Post ID"
+// @Success 	200 {object} string
+// @Failure 	400 {object} string "Bad Request"
+// @Router 		/post/{postId}/increment-views [put]
+func incrementPostViews(c *gin.Context) {
+	postId := c.Param("postId")
+
+	// Find the post by ID
+	var post models.Post
+	result := db.Scopes(published).First(&post, "post_id = ?", postId)
+
+	if result.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Post not found"})
+		return
+	}
+
+	counted, err := recordPostView(post.PostId, viewerKey(c), time.Now().UTC())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to update view count"})
+		return
+	}
+
+	// Read the count back, as other viewers may have been counted meanwhile
+	db.Model(&models.Post{}).Where("post_id = ?", post.PostId).Pluck("views", &post.Views)
+
+	if !counted {
+		c.JSON(http.StatusOK, gin.H{"message": "View already counted", "views": post.Views, "counted": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "View count incremented", "views": post.Views, "counted": true})
+}
+
+// GetPostViews godoc
+//
+// @Summary 	Retrieves the views of a post over time
+// @Description This API returns the number of counted views of a post for each of the last days, oldest first. Only the author can see it.
+// @Tags 		post
+// @Accept 		json
+// @Produce 	json
+// @Param 		postId path string true "Post ID"
+// @Param 		days query int false "Number of days, up to 365 (default 30)"
+// @Success 	200 {array} models.PostViewDay
+// @Failure 	400 {object} string "Bad Request"
+// @Failure 	401 {object} string "Unauthorized"
+// @Failure 	403 {object} string "Forbidden"
+// @Failure 	404 {object} string "Post not found"
+// @Router 		/post/{postId}/views [get]
+func getPostViews(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	if post.Author != getUsername(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author can see the views of a post"})
+		return
+	}
+
+	query := struct {
+		Days int `form:"days"`
+	}{Days: defaultViewHistoryDays}
+	if err := c.ShouldBindQuery(&query); err != nil || query.Days < 1 || query.Days > maxViewHistoryDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Days must be between 1 and %d", maxViewHistoryDays)})
+		return
+	}
+
+	history, err := postViewHistory(post.PostId, query.Days, time.Now().UTC())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": post.Views, "data": history})
+}
+
+// LikeOrDislikePost godoc
+//
+// @Summary 		Likes or dislikes a post
+// @Description 	This API allows a logged-in user to like or dislike a specific post. The action is specified in the request body as either "like" or "dislike". Repeating the member's current vote takes it back, and the opposite action switches it.
+// @Tags 			post
+// @Accept 			json
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Success 		200 {object} map[string]interface{} "Action applied successfully with updated like/dislike counts"
+// @Failure 		400 {object} string "Bad Request or Invalid Action"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		404 {object} string "Post not found"
+// @Failure 		409 {object} string "Concurrent vote by the same member"
+// @Router 			/post/{postId}/like-dislike [put]
+func likeOrDislikePost(c *gin.Context) {
+	// Check if the user is authorized
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	username := getUsername(c)
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	postId := c.Param("postId")
+	var post models.Post
+
+	// Fetch the post by ID
+	if err := db.Scopes(published).First(&post, "post_id = ?", postId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	// Parse the request body to determine the action (like or dislike)
+	var request struct {
+		Action string `json:"action"` // "like" or "dislike"
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now().UTC()
+	vote, err := castVote(models.VoteTargetPost, post.PostId, username, request.Action, now)
+	if errors.Is(err, errInvalidVote) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action"})
+		return
+	}
+	if errors.Is(err, errVoteConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post"})
+		return
+	}
+	post.Likes, post.Dislikes = vote.Likes, vote.Dislikes
+
+	// Authors hear about new likes and dislikes, not ones taken back
+	if vote.Current != 0 && post.Author != username {
+		title, verb := "Your post was liked!", "liked"
+		if vote.Current == models.VoteDislike {
+			title, verb = "Your post was disliked!", "disliked"
+		}
+		content := fmt.Sprintf("%s %s your post: %s", username, verb, post.Title)
+		sendAutoNotification(post.Author, title, content)
+	}
+
+	// Only new likes count as activity, not taking one back or disliking
+	activity := 0.0
+	if vote.Current == models.VoteLike {
+		activity = activityLike
+	}
+	refreshPostRanking(db, post.PostId, activity, now)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Action applied successfully",
+		"likes":    post.Likes,
+		"dislikes": post.Dislikes,
+	})
+}
+
+// GetComments godoc
+//
+// @Summary 		Retrieves the comment threads of a specific post
+// @Description 	This API fetches a page of the top-level comments of a post, each with its replies nested below it oldest first. Comments are sorted newest first by default, or oldest first, by likes (top), or by the lower bound of their share of likes (best), which keeps comments with a handful of votes from outranking well-liked ones. Threads are cut off after depth levels; reply_count tells how many replies a comment has, and the rest of a thread is fetched by passing that comment as parent_id. Pass the returned next_cursor as the cursor parameter, with the same sort, to get the next page; it is empty on the last page. Count is the number of comments at the requested level.
+// @Tags 			comment
+// @Accept 			json
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Param 			parent_id query string false "Return the replies below this comment instead of the top-level comments"
+// @Param 			depth query int false "Levels of comments to return, 1 to 6 (default 3)"
+// @Param 			sort query string false "newest, oldest, top or best (default newest)"
+// @Param 			cursor query string false "Cursor returned with the previous page"
+// @Param 			limit query int false "Page size, up to 100 (default 20)"
+// @Success 		200 {array} models.Comment "List of comments"
+// @Failure 		400 {object} string "Bad Request"
+// @Failure 		404 {object} string "Post not found"
+// @Router 			/comment/{postId}/ [get]
+func getComments(c *gin.Context) {
+	postId := c.Param("postId")
+
+	// Find the post first
+	var post models.Post
+	if err := db.First(&post, "post_id = ?", postId).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Post not found"})
+		return
+	}
+
+	query := struct {
+		ParentID *string `form:"parent_id"`
+		Depth    int     `form:"depth"`
+		Sort     string  `form:"sort"`
+		Cursor   string  `form:"cursor"`
+		Limit    int     `form:"limit"`
+	}{Depth: defaultThreadDepth, Sort: commentSortNewest, Limit: defaultPageSize}
+	if err := c.ShouldBindQuery(&query); err != nil || query.Depth < 1 || query.Depth > maxCommentDepth+1 || query.Limit < 1 || query.Limit > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Depth must be between 1 and %d, and limit between 1 and %d", maxCommentDepth+1, maxPageSize)})
+		return
+	}
+	if query.ParentID != nil {
+		var parent models.Comment
+		if err := db.First(&parent, "comment_id = ? AND post_id = ?", *query.ParentID, postId).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			return
+		}
+	}
+
+	page, nextCursor, err := commentPage(post, query.ParentID, query.Sort, query.Cursor, query.Limit)
+	if errors.Is(err, errCommentSort) || errors.Is(err, errInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	threads, err := loadThreads(page, query.Depth, getUsername(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	db.Model(&models.Comment{}).Where("post_id = ?", postId).Scopes(commentLevel(query.ParentID)).Count(&count)
+
+	c.JSON(http.StatusOK, gin.H{"count": count, "data": threads, "next_cursor": nextCursor})
+}
+
+// GetCommentById godoc
+//
+// @Summary 		Retrieves a specific comment by its ID
+// @Description 	This API fetches a comment associated with a specific post by its unique comment ID.
+// @Tags 			comment
+// @Accept 			json
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Param 			commentId path string true "Comment ID"
+// @Success 		200 {object} models.Comment "Comment details"
+// @Failure 		400 {object} string "Bad Request"
+// @Failure 		404 {object} string "Comment not found"
+// @Router 			/comment/{postId}/{commentId} [get]
+func getCommentById(c *gin.Context) {
+	postId := c.Param("postId")
+	commentId := c.Param("commentId")
+
+	var comment models.Comment
+	result := db.First(&comment, "comment_id = ? AND post_id = ?", commentId, postId)
+
+	if result.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment not found"})
+		return
+	} else {
+		c.JSON(http.StatusOK, gin.H{"data": comment})
+	}
+}
+
+// CreateComment godoc
+//
+// @Summary 		Creates a new comment on a post
+// @Description 	This API allows a logged-in user to add a new comment to a specific post. Set parent_id to reply to another comment; replies nest at most 5 levels deep. Members mentioned as @username are notified, once per comment.
+// @Tags 			comment
+// @Accept 			json
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Param 			comment body models.Comment true "New comment data"
+// @Success 		200 {object} models.Comment "Created comment details"
+// @Failure 		400 {object} string "Bad Request"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		404 {object} string "Post not found"
+// @Router 			/comment/{postId} [post]
+func createComment(c *gin.Context) {
+	// Check if user is logged in
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	username := getUsername(c)
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Get the post ID from URL parameter
+	postId := c.Param("postId")
+
+	// Verify the post exists
+	var post models.Post
+	if err := db.Scopes(published).First(&post, "post_id = ?", postId).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Post not found"})
+		return
+	}
+
+	var newComment models.Comment
+
+	// Bind the JSON request to the comment struct
+	if err := c.ShouldBindJSON(&newComment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Validate comment content
+	if newComment.Content == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment content is required"})
+		return
+	}
+	if len(newComment.Content) > maxCommentContentLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Comment cannot exceed %d characters", maxCommentContentLength)})
+		return
+	}
+	if err := checkMentions(newComment.Content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Set comment fields
+	newComment.Author = username
+	newComment.PostID = postId
+	newComment.CommentId = uuid.New().String()
+	newComment.Likes = 0
+	newComment.Dislikes = 0
+	newComment.Edited = false
+	newComment.EditedAt = nil
+
+	// Replies go below the comment they answer
+	parent, err := resolveCommentParent(&newComment)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	newComment.Replies = []models.Comment{}
+
+	// Create the comment in the database
+	result := db.Create(&newComment)
+	if result.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": result.Error.Error()})
+	} else {
+		refreshPostRanking(db, post.PostId, activityComment, time.Now().UTC())
+		if err := recordCommentMentions(&newComment, post); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record mentions"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Comment created successfully", "data": newComment})
+
+		// A reply notifies the author of the comment it answers; the post's
+		// author hears about it too unless they wrote that comment
+		if parent != nil && parent.Author != username {
+			title := "New reply to your comment!"
+			content := fmt.Sprintf("%s replied: %s", username, newComment.Content)
+			sendAutoNotification(parent.Author, title, content)
+		}
+		if post.Author != username && (parent == nil || parent.Author != post.Author) {
+			title := "New comment on your post!"
+			content := fmt.Sprintf("%s commented: %s", username, newComment.Content)
+			sendAutoNotification(post.Author, title, content)
+		}
+	}
+}
+
+// UpdateComment godoc
+//
+// @Summary 		Updates an existing comment
+// @Description 	This API allows the author of a comment to update its content. The comment is marked as edited and the text it replaces is kept in its revision history. Members newly mentioned by the edit are notified.
+// @Tags 			comment
+// @Accept 			json
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Param 			commentId path string true "Comment ID"
+// @Success 		200 {object} models.Comment "Updated comment details"
+// @Failure 		400 {object} string "Bad Request or Empty Content"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		403 {object} string "Forbidden - Only the author can update their own comments"
+// @Failure 		404 {object} string "Comment not found"
+// @Router 			/comment/{postId}/{commentId} [put]
+func updateComment(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	postId := c.Param("postId")
+	commentId := c.Param("commentId")
+
+	var comment models.Comment
+	if err := db.First(&comment, "comment_id = ? AND post_id = ?", commentId, postId).Error; err != nil || comment.RemovedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	// Check if the comment belongs to the logged-in user
+	username := getUsername(c)
+	if comment.Author != username {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only update your own comments"})
+		return
+	}
+
+	var updateData struct {
+		Content string `json:"content"`
+	}
+
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if updateData.Content == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment content cannot be empty"})
+		return
+	}
+	if len(updateData.Content) > maxCommentContentLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Comment cannot exceed %d characters", maxCommentContentLength)})
+		return
+	}
+	if err := checkMentions(updateData.Content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Unchanged text is not an edit
+	if updateData.Content == comment.Content {
+		c.JSON(http.StatusOK, gin.H{"message": "Comment updated successfully", "data": comment})
+		return
+	}
+
+	previous := comment
+	now := time.Now().UTC()
+	comment.Content = updateData.Content
+	comment.Edited = true
+	comment.EditedAt = &now
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&comment).Error; err != nil {
+			return err
+		}
+		return recordCommentEdit(tx, previous, comment, now)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+
+	var post models.Post
+	db.First(&post, "post_id = ?", comment.PostID)
+	if err := recordCommentMentions(&comment, post); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record mentions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Comment updated successfully",
+		"data":    comment,
+	})
+}
+
+// GetCommentRevisions godoc
+//
+// @Summary 		Retrieves the revision history of a comment
+// @Description 	This API lists the saved revisions of a comment, oldest first. The first revision is the comment as posted. Only the author of the comment and moderators can see it.
+// @Tags 			comment
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Param 			commentId path string true "Comment ID"
+// @Success 		200 {array} models.CommentRevision
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		403 {object} string "Forbidden"
+// @Failure 		404 {object} string "Comment not found"
+// @Router 			/comment/{postId}/{commentId}/revisions [get]
+func getCommentRevisions(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var comment models.Comment
+	if err := db.First(&comment, "comment_id = ? AND post_id = ?", c.Param("commentId"), c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+	username := getUsername(c)
+	if comment.Author != username && !isModerator(username) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author and moderators can see the history of a comment"})
+		return
+	}
+
+	revisions := []models.CommentRevision{}
+	if err := db.Where("comment_id = ?", comment.CommentId).Order("revision asc").Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": revisions})
+}
+
+// ReportComment godoc
+//
+// @Summary 		Reports a comment to the moderators
+// @Description 	This API flags a comment for the moderators with an optional reason. The text of the comment is kept as reported, so moderators can see it even if the comment is edited afterwards. Each member can report a comment once.
+// @Tags 			comment
+// @Accept 			json
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Param 			commentId path string true "Comment ID"
+// @Success 		200 {object} models.CommentReport
+// @Failure 		400 {object} string "Cannot report your own comment"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		404 {object} string "Comment not found"
+// @Failure 		409 {object} string "Already reported"
+// @Router 			/comment/{postId}/{commentId}/report [post]
+func reportComment(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var comment models.Comment
+	if err := db.First(&comment, "comment_id = ? AND post_id = ?", c.Param("commentId"), c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := fileCommentReport(comment, getUsername(c), request.Reason, time.Now().UTC())
+	if errors.Is(err, errOwnComment) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errAlreadyReported) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report comment"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Comment reported successfully", "data": report})
+}
+
+// GetCommentReports godoc
+//
+// @Summary 		Retrieves the reports of a comment
+// @Description 	This API lists the reports of a comment, oldest first, each with the text the comment had when it was reported and whether it was edited since. Only moderators can see reports.
+// @Tags 			comment
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Param 			commentId path string true "Comment ID"
+// @Success 		200 {array} map[string]interface{} "Reports of the comment"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		403 {object} string "Forbidden"
+// @Failure 		404 {object} string "Comment not found"
+// @Router 			/comment/{postId}/{commentId}/reports [get]
+func getCommentReports(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	if !isModerator(getUsername(c)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators can see reports"})
+		return
+	}
+
+	var comment models.Comment
+	if err := db.First(&comment, "comment_id = ? AND post_id = ?", c.Param("commentId"), c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	reports, err := commentReports(comment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": reports})
+}
+
+// DeleteComment godoc
+//
+// @Summary 		Deletes an existing comment
+// @Description 	This API allows the author of a comment to delete it from a specific post. A comment with replies is left in its thread reading "[removed]" so the replies keep their context.
+// @Tags 			comment
+// @Accept 			json
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Param 			commentId path string true "Comment ID"
+// @Success 		200 {object} string "Comment deleted successfully"
+// @Failure 		400 {object} string "Bad Request"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		403 {object} string "Forbidden - Only the author can delete their own comments"
+// @Failure 		404 {object} string "Comment not found"
+// @Router 			/comment/{postId}/{commentId} [delete]
+func deleteComment(c *gin.Context) {
+	// Check if user is logged in
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	username := getUsername(c)
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Get parameters from URL
+	postId := c.Param("postId")
+	commentId := c.Param("commentId")
+
+	// Find the comment
+	var comment models.Comment
+	result := db.First(&comment, "comment_id = ? AND post_id = ?", commentId, postId)
+
+	if result.Error != nil || comment.RemovedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	// Check if the user is the author of the comment
+	if comment.Author != username {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "You can only delete your own comments"})
+		return
+	}
+
+	// Replies stay up; the comment is left above them as a tombstone
+	if err := softDeleteComment(comment, time.Now().UTC()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+	refreshPostRanking(db, comment.PostID, 0, time.Now().UTC())
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
+}
+
+// RestoreDeletedComment godoc
+//
+// @Summary 		Restores a deleted comment
+// @Description 	This API lets moderators bring back a deleted comment within the retention window. A comment left as a tombstone gets its text back; a hidden reply brings back the tombstones above it.
+// @Tags 			comment
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Param 			commentId path string true "Comment ID"
+// @Success 		200 {object} models.Comment
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		403 {object} string "Forbidden"
+// @Failure 		404 {object} string "Comment not found or not deleted"
+// @Failure 		409 {object} string "The post is deleted"
+// @Failure 		410 {object} string "Retention window passed"
+// @Router 			/comment/{postId}/{commentId}/restore [put]
+func restoreDeletedComment(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	if !isModerator(getUsername(c)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators can restore deleted comments"})
+		return
+	}
+
+	comment, err := undeleteComment(c.Param("postId"), c.Param("commentId"), time.Now().UTC())
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, errNotDeleted) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found or not deleted"})
+		return
+	}
+	if errors.Is(err, errPostDeleted) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errRetentionPassed) {
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore comment"})
+		return
+	}
+
+	refreshPostRanking(db, comment.PostID, 0, time.Now().UTC())
+	c.JSON(http.StatusOK, gin.H{"message": "Comment restored successfully", "data": comment})
+}
+
+// LikeOrDislikeComment godoc
+//
+// @Summary 		Like or dislike action on a comment
+// @Description 	This API allows a logged-in user to like or dislike a specific comment. The action is specified in the request body as either "like" or "dislike". Repeating the member's current vote takes it back, and the opposite action switches it.
+// @Tags 			comment
+// @Accept 			json
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Param 			commentId path string true "Comment ID"
+// @Success 		200 {object} map[string]interface{} "Action applied successfully with updated like/dislike counts"
+// @Failure 		400 {object} string "Invalid action"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		409 {object} string "Concurrent vote by the same member"
+// @Router 			/comment/{postId}/{commentId}/like-dislike [put]
+func likeOrDislikeComment(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	username := getUsername(c)
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	postId := c.Param("postId")
+	commentId := c.Param("commentId")
+	var comment models.Comment
+
+	if err := db.First(&comment, "comment_id = ? AND post_id = ?", commentId, postId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	var request struct {
+		Action string `json:"action"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	vote, err := castVote(models.VoteTargetComment, comment.CommentId, username, request.Action, time.Now().UTC())
+	if errors.Is(err, errInvalidVote) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action"})
+		return
+	}
+	if errors.Is(err, errVoteConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+		return
+	}
+	comment.Likes, comment.Dislikes = vote.Likes, vote.Dislikes
+
+	// Authors hear about new likes and dislikes, not ones taken back
+	if vote.Current != 0 && comment.Author != username {
+		title, verb := "Your comment was liked!", "liked"
+		if vote.Current == models.VoteDislike {
+			title, verb = "Your comment was disliked!", "disliked"
+		}
+		content := fmt.Sprintf("%s %s your comment: %s", username, verb, comment.Content)
+		sendAutoNotification(comment.Author, title, content)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Action applied successfully",
+		"likes":    comment.Likes,
+		"dislikes": comment.Dislikes,
+	})
+}
+
+// GetUserLikedComments godoc
+//
+// @Summary 		Retrieves comments liked by a specific user
+// @Description 	This API fetches all comments that have been liked by a specific user, identified by their username.
+// @Tags 			member
+// @Accept 			json
+// @Produce 		json
+// @Param 			username path string true "Username of the member"
+// @Success 		200 {array} models.Comment
+// @Failure 		400 {object} string "Bad Request"
+// @Failure 		404 {object} string "User not found"
+// @Failure 		401 {object} string "Unauthorized"
+// @Router 			/member/{username}/liked-comments [get]
+func getUserLikedComments(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	username := c.Param("username")
+
+	var member models.Member
+	if err := db.First(&member, "username = ?", username).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	voted, err := votedComments(member.Username, models.VoteLike)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": voted})
+}
+
+// GetUserDislikedComments godoc
+//
+// @Summary 		Retrieves comments disliked by a specific user
+// @Description 	This API fetches all comments that have been disliked by a specific user, identified by their username.
+// @Tags 			member
+// @Accept 			json
+// @Produce 		json
+// @Param 			username path string true "Username of the member"
+// @Success 		200 {array} models.Comment
+// @Failure 		400 {object} string "Bad Request"
+// @Failure 		404 {object} string "User not found"
+// @Failure 		401 {object} string "Unauthorized"
+// @Router 			/member/{username}/disliked-comments [get]
+func getUserDislikedComments(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	username := c.Param("username")
+
+	var member models.Member
+	if err := db.First(&member, "username = ?", username).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	voted, err := votedComments(member.Username, models.VoteDislike)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": voted})
+}
+
+// GetNotifications godoc
+//
+// @Summary 		Gets notifications for the current user
+// @Description 	Fetches a slice of notifications for the logged-in user. Supports optional query parameters for sorting, limit, and offset.
+// @Tags 			notification
+// @Accept 			json
+// @Produce 		json
+// @Success 		200 {object} map[string]interface{} "Notifications list and count"
+// @Failure 		400 {object} string "Bad Request"
+// @Failure 		401 {object} string "Unauthorized"
+// @Router 			/notification [get]
+func getNotifications(c *gin.Context) {
+
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	//Start by reading in the sorting column and direction
+	var notiQuery models.SearchQuery
+	if err := c.ShouldBindQuery(&notiQuery); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	//If no limit or offset was passed in, set to -1 for the SQL command
+	if notiQuery.Limit == 0 {
+		notiQuery.Limit = -1
+	}
+	if notiQuery.Offset == 0 {
+		notiQuery.Offset = -1
+	}
+
+	//Format the order for sorting
+	var order string
+	if notiQuery.Order != "" {
+		order = notiQuery.Column + " " + notiQuery.Order
+	} else {
+		order = notiQuery.Column
+	}
+
+	var notis []models.Notification
+
+	// Fetch posts ordered by the passed in column, with slices specified
+	result := db.Where("username = ?", getUsername(c)).Order(order).Limit(notiQuery.Limit).Offset(notiQuery.Offset).Find(&notis)
+
+	if result.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	//Get the count
+	var count int64
+	db.Model(&models.Notification{}).Where("username = ?", getUsername(c)).Count(&count)
+
+	c.JSON(http.StatusOK, gin.H{"count": count, "data": notis})
+}
+
+// GetNotificationById godoc
+//
+// @Summary 		Gets a notification by its ID
+// @Description 	Fetches a single notification by its unique ID.
+// @Tags 			notification
+// @Accept 			json
+// @Produce 		json
+// @Param 			id path string true "Notification ID"
+// @Success 		200 {object} models.Notification
+// @Failure 		400 {object} string "No Records Found"
+// @Failure 		401 {object} string "Unauthorized"
+// @Router 			/notification/{id} [get]
+func getNotificationById(c *gin.Context) {
+
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id := c.Param("id")
+
+	var noti models.Notification
+
+	result := db.First(&noti, "id = ?", id)
+
+	if result.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No Records Found"})
+		return
+	} else {
+		c.JSON(http.StatusOK, gin.H{"data": noti})
+	}
+}
+
+// SendNotification godoc
+//
+// @Summary 		Sends a notification to a user
+// @Description 	Sends a notification with a title and content to a specified user.
+// @Tags 			notification
+// @Accept 			json
+// @Produce 		json
+// @Param 			notification body models.Notification true "Notification data"
+// @Success 		201 {object} string "Notification sent"
+// @Failure 		400 {object} string "Notification title, content, and username (recipient) required"
+// @Failure 		401 {object} string "Unauthorized"
+// @Router 			/notification [post]
+func sendNotification(c *gin.Context) {
+
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var noti models.Notification
+	if err := c.ShouldBindJSON(&noti); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if noti.Title == "" || noti.Content == "" || noti.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Notification title, content, and username (recipient) required"})
+		return
+	}
+
+	noti.Id = uuid.New().String()
+	noti.Read = false
+
+	db.Create(&noti)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Notification sent"})
+}
+
+// DeleteNotification godoc
+//
+// @Summary 		Deletes a notification
+// @Description 	Deletes a notification by its unique ID. Only the recipient can delete their own notifications.
+// @Tags 			notification
+// @Accept 			json
+// @Produce 		json
+// @Param 			id path string true "Notification ID"
+// @Success 		200 {object} string "Notification deleted successfully"
+// @Failure 		400 {object} string "Notification not found or not owned by user"
+// @Failure 		401 {object} string "Unauthorized"
+// @Router 			/notification/{id} [delete]
+func deleteNotification(c *gin.Context) {
+
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id := c.Param("id")
+
+	var noti models.Notification
+	if err := db.First(&noti, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	if noti.Username != getUsername(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can only delete your own notifications"})
+		return
+	}
+
+	db.Delete(&noti)
+	c.JSON(http.StatusOK, gin.H{"message": "Notification deleted successfully"})
+}
+
+// UpdateNotification godoc
+//
+// @Summary 		Updates a notification's read status
+// @Description 	Updates the read status of a notification by its unique ID. Only the recipient can update their own notifications.
+// @Tags 			notification
+// @Accept 			json
+// @Produce 		json
+// @Param 			id path string true "Notification ID"
+// @Success 		200 {object} string "Notification updated successfully"
+// @Failure 		404 {object} string "Notification not found"
+// @Failure 		400 {object} string "You can only update your own notifications"
+// @Failure 		401 {object} string "Unauthorized"
+// @Router 			/notification/{id} [put]
+func updateNotification(c *gin.Context) {
+
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id := c.Param("id")
+
+	var noti models.Notification
+	if err := db.First(&noti, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	if noti.Username != getUsername(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can only update your own notifications"})
+		return
+	}
+
+	var updateReq struct {
+		Read bool `json:"read"`
+	}
+	if err := c.ShouldBindJSON(&updateReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db.Model(&models.Notification{}).Where("id = ?", id).Update("read", updateReq.Read)
+	c.JSON(http.StatusOK, gin.H{"message": "Notification updated successfully"})
+}
+
+// UpdateNotifications godoc
+//
+// @Summary 		Bulk update notifications' read status
+// @Description 	Sets all notifications for the logged-in user to read/unread.
+// @Tags 			notification
+// @Accept 			json
+// @Produce 		json
+// @Success 		200 {object} string "Notifications updated successfully"
+// @Failure 		400 {object} string "Bad Request"
+// @Failure 		401 {object} string "Unauthorized"
+// @Router 			/notification [put]
+func updateNotifications(c *gin.Context) {
+
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var updateReq struct {
+		Read bool `json:"read"`
+	}
+	if err := c.ShouldBindJSON(&updateReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db.Model(&models.Notification{}).Where("username = ?", getUsername(c)).Update("read", updateReq.Read)
+	c.JSON(http.StatusOK, gin.H{"message": "Notifications updated successfully"})
+}
+
+// FollowMember godoc
+//
+// @Summary 		Follow a member
+// @Description 	Allows the logged-in user to follow another member by username.
+// @Tags 			member
+// @Accept 			json
+// @Produce 		json
+// @Param 			username path string true "Username of the member to follow"
+// @Success 		200 {object} string "Followed successfully"
+// @Failure 		400 {object} string "Cannot follow yourself or bad request"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		404 {object} string "User not found"
+// @Failure 		500 {object} string "Failed to follow"
+// @Router 			/member/{username}/follow [post]
+func followMember(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	follower := getUsername(c)
+	followee := c.Param("username")
+	if follower == followee {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot follow yourself"})
+		return
+	}
+
+	var followerMember, followeeMember models.Member
+	if db.First(&followerMember, "username = ?", follower).Error != nil ||
+		db.First(&followeeMember, "username = ?", followee).Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Add follow relationship
+	if err := db.Model(&followerMember).Association("Following").Append(&followeeMember); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow"})
+		return
+	}
+
+	// Optionally, send notification
+	if follower != followee {
+		sendAutoNotification(followee, "New follower!", follower+" started following you.")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Followed successfully"})
+}
+
+// UnfollowMember godoc
+//
+// @Summary 		Unfollow a member
+// @Description 	Allows the logged-in user to unfollow another member by username.
+// @Tags 			member
+// @Accept 			json
+// @Produce 		json
+// @Param 			username path string true "Username of the member to unfollow"
+// @Success 		200 {object} string "Unfollowed successfully"
+// @Failure 		400 {object} string "Cannot unfollow yourself or bad request"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		404 {object} string "User not found"
+// @Failure 		500 {object} string "Failed to unfollow"
+// @Router 			/member/{username}/follow [delete]
+func unfollowMember(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	follower := getUsername(c)
+	followee := c.Param("username")
+	if follower == followee {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot unfollow yourself"})
+		return
+	}
+
+	var followerMember, followeeMember models.Member
+	if db.First(&followerMember, "username = ?", follower).Error != nil ||
+		db.First(&followeeMember, "username = ?", followee).Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Remove follow relationship
+	if err := db.Model(&followerMember).Association("Following").Delete(&followeeMember); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unfollow"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unfollowed successfully"})
+}
+
+// GetFollowers godoc
+//
+// @Summary 		Get a member's followers
+// @Description 	Retrieves a list of members who follow the specified user.
+// @Tags 			member
+// @Accept 			json
+// @Produce 		json
+// @Param 			username path string true "Username of the member"
+// @Success 		200 {object} map[string]interface{} "List of followers"
+// @Failure 		404 {object} string "User not found"
+// @Router 			/member/{username}/followers [get]
+func getFollowers(c *gin.Context) {
+	username := c.Param("username")
+	var member models.Member
+	if db.Preload("Followers").First(&member, "username = ?", username).Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": member.Followers})
+}
+
+// GetFollowing godoc
+//
+// @Summary 		Get members a user is following
+// @Description 	Retrieves a list of members that the specified user is following.
+// @Tags 			member
+// @Accept 			json
+// @Produce 		json
+// @Param 			username path string true "Username of the member"
+// @Success 		200 {object} map[string]interface{} "List of following"
+// @Failure 		404 {object} string "User not found"
+// @Router 			/member/{username}/following [get]
+func getFollowing(c *gin.Context) {
+	username := c.Param("username")
+	var member models.Member
+	if db.Preload("Following").First(&member, "username = ?", username).Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": member.Following})
+}
+
+// GetFeed godoc
+//
+// @Summary 		Get the logged-in member's home feed
+// @Description 	Returns the published posts of the members the logged-in user follows, and the posts they reposted, newest first. Reposts are listed at the time of the repost with reposted_by set. Pass the returned next_cursor as the cursor parameter to get the next page; it is empty on the last page.
+// @Tags 			member
+// @Accept 			json
+// @Produce 		json
+// @Param 			cursor query string false "Cursor returned with the previous page"
+// @Param 			limit query int false "Page size, up to 100 (default 20)"
+// @Success 		200 {array} models.Post
+// @Failure 		400 {object} string "Invalid cursor"
+// @Failure 		401 {object} string "Unauthorized"
+// @Router 			/feed [get]
+func getFeed(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	query := struct {
+		Cursor string `form:"cursor"`
+		Limit  int    `form:"limit"`
+	}{Limit: defaultPageSize}
+	if err := c.ShouldBindQuery(&query); err != nil || query.Limit < 1 || query.Limit > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Limit must be between 1 and %d", maxPageSize)})
+		return
+	}
+	after, err := afterCursor("posts.created_at", "posts.post_id", query.Cursor)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Walks the author and creation time index of each followed member
+	// rather than scanning every post
+	following := db.Table("member_followers").Select("username").Where("follower_username = ?", getUsername(c))
+
+	// Fetch one extra post to know whether there is another page
+	var posts []models.Post
+	result := db.Scopes(published, after).
+		Where("posts.author IN (?)", following).
+		Order("posts.created_at desc").
+		Order("posts.post_id desc").
+		Limit(query.Limit + 1).
+		Find(&posts)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	// Reposts page through the same cursor, by repost time and ID
+	repostsAfter, _ := afterCursor("reposts.created_at", "reposts.repost_id", query.Cursor)
+	reposts, err := feedReposts(following, repostsAfter, query.Limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Either list running past the page means there is more, even when
+	// duplicates collapsed this page or were listed on an earlier one
+	entries, err := dropShownEarlier(mergeFeedEntries(posts, reposts), following, query.Cursor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	more := len(posts) > query.Limit || len(reposts) > query.Limit || len(entries) > query.Limit
+
+	nextCursor := ""
+	if len(entries) > query.Limit {
+		entries = entries[:query.Limit]
+	}
+	if more && len(entries) > 0 {
+		last := entries[len(entries)-1]
+		nextCursor = encodeCursor(last.at, last.id)
+	}
+	posts = make([]models.Post, len(entries))
+	for i, entry := range entries {
+		posts[i] = entry.post
+	}
+
+	attachImageDetails(posts)
+	attachQuotedPosts(posts)
+	attachPostMentions(posts)
+	attachBookmarkFlags(posts, getUsername(c))
+	c.JSON(http.StatusOK, gin.H{"data": posts, "next_cursor": nextCursor})
+}
+
+// VolunteerForPost godoc
+//
+// @Summary 		Volunteer to help with a post
+// @Description 	Allows the logged-in user to offer help on an open post. The post's author is notified and can accept the volunteer.
+// @Tags 			assignment
+// @Accept 			json
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Success 		200 {object} models.Assignment "Volunteered successfully"
+// @Failure 		400 {object} string "Post is not open or cannot volunteer on your own post"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		404 {object} string "Post not found"
+// @Failure 		409 {object} string "Already volunteered"
+// @Router 			/post/{postId}/volunteer [post]
+func volunteerForPost(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	username := getUsername(c)
+
+	var post models.Post
+	if err := db.Scopes(published).First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	if post.Author == username {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot volunteer on your own post"})
+		return
+	}
+	if post.Status != models.PostStatusOpen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Post is not open for volunteers"})
+		return
+	}
+
+	var existing models.Assignment
+	if err := db.First(&existing, "post_id = ? AND helper = ?", post.PostId, username).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already volunteered for this post"})
+		return
+	}
+
+	assignment := models.Assignment{
+		AssignmentId: uuid.New().String(),
+		PostID:       post.PostId,
+		Helper:       username,
+		Status:       models.AssignmentVolunteered,
+	}
+	if err := db.Create(&assignment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to volunteer"})
+		return
+	}
+
+	title := "Someone offered to help!"
+	content := fmt.Sprintf("%s volunteered to help with your post: %s", username, post.Title)
+	sendAutoNotification(post.Author, title, content)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Volunteered successfully", "data": assignment})
+}
+
+// WithdrawFromPost godoc
+//
+// @Summary 		Withdraw from helping with a post
+// @Description 	Allows the logged-in user to withdraw their offer, or their accepted assignment, on a post. The post's author is notified.
+// @Tags 			assignment
+// @Accept 			json
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Success 		200 {object} string "Withdrawn successfully"
+// @Failure 		400 {object} string "Post is resolved"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		404 {object} string "Post or assignment not found"
+// @Router 			/post/{postId}/volunteer [delete]
+func withdrawFromPost(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	username := getUsername(c)
+
+	var post models.Post
+	if err := db.First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	var assignment models.Assignment
+	if err := db.First(&assignment, "post_id = ? AND helper = ?", post.PostId, username).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "You have not volunteered for this post"})
+		return
+	}
+
+	// Helpers of a resolved post stay on it, so they can still rate and be rated
+	if post.Status == models.PostStatusResolved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot withdraw from a resolved post"})
+		return
+	}
+
+	if err := db.Delete(&assignment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withdraw"})
+		return
+	}
+
+	title := "A helper withdrew"
+	content := fmt.Sprintf("%s is no longer helping with your post: %s", username, post.Title)
+	sendAutoNotification(post.Author, title, content)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Withdrawn successfully"})
+}
+
+// AcceptHelper godoc
+//
+// @Summary 		Accept a volunteer as a helper
+// @Description 	Allows the author of a post to accept a member who volunteered on it. Several helpers can be accepted on the same post. The helper is notified.
+// @Tags 			assignment
+// @Accept 			json
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Param 			username path string true "Username of the volunteer"
+// @Success 		200 {object} models.Assignment "Helper accepted"
+// @Failure 		400 {object} string "Post is not open"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		403 {object} string "Forbidden - Only the author can accept helpers"
+// @Failure 		404 {object} string "Post or volunteer not found"
+// @Router 			/post/{postId}/helpers/{username} [put]
+func acceptHelper(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
 
-	// Find the post by ID
-	var post models.Post
-	result := db.First(&post, "post_id = ?", postId)
+	if post.Author != getUsername(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only accept helpers on your own posts"})
+		return
+	}
+	if post.Status != models.PostStatusOpen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Post is not open for volunteers"})
+		return
+	}
 
-	if result.Error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Post not found"})
+	var assignment models.Assignment
+	if err := db.First(&assignment, "post_id = ? AND helper = ?", post.PostId, c.Param("username")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "This member has not volunteered for your post"})
 		return
 	}
 
-	// Increment the view count by 1
-	post.Views++
+	if assignment.Status != models.AssignmentAccepted {
+		assignment.Status = models.AssignmentAccepted
+		if err := db.Save(&assignment).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept helper"})
+			return
+		}
 
-	// Save the updated post
-	if err := db.Save(&post).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to update view count"})
-		return
+		title := "You were accepted as a helper!"
+		content := fmt.Sprintf("%s accepted your offer to help with: %s", post.Author, post.Title)
+		sendAutoNotification(assignment.Helper, title, content)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "View count incremented", "views": post.Views})
+	c.JSON(http.StatusOK, gin.H{"message": "Helper accepted", "data": assignment})
 }
 
-// LikeOrDislikePost godoc
+// RemoveHelper godoc
 //
-// @Summary 		Likes or dislikes a post
-// @Description 	This API allows a logged-in user to like or dislike a specific post. The action is specified in the request body as either "like" or "dislike".
-// @Tags 			post
+// @Summary 		Remove a helper or volunteer from a post
+// @Description 	Allows the author of a post to remove a volunteer or an accepted helper from it. The removed member is notified.
+// @Tags 			assignment
 // @Accept 			json
 // @Produce 		json
 // @Param 			postId path string true "Post ID"
-// @Success 		200 {object} map[string]interface{} "Action applied successfully with updated like/dislike counts"
-// @Failure 		400 {object} string "Bad Request or Invalid Action"
+// @Param 			username path string true "Username of the helper"
+// @Success 		200 {object} string "Helper removed"
+// @Failure 		400 {object} string "Post is resolved"
 // @Failure 		401 {object} string "Unauthorized"
-// @Failure 		404 {object} string "Post not found"
-// @Router 			/post/{postId}/like-dislike [put]
-func likeOrDislikePost(c *gin.Context) {
-	// Check if the user is authorized
+// @Failure 		403 {object} string "Forbidden - Only the author can remove helpers"
+// @Failure 		404 {object} string "Post or helper not found"
+// @Router 			/post/{postId}/helpers/{username} [delete]
+func removeHelper(c *gin.Context) {
 	if err := Authorize(c); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	username := getUsername(c)
-	if username == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	postId := c.Param("postId")
 	var post models.Post
-
-	// Fetch the post by ID
-	if err := db.First(&post, "post_id = ?", postId).Error; err != nil {
+	if err := db.First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
 		return
 	}
 
-	// Parse the request body to determine the action (like or dislike)
-	var request struct {
-		Action string `json:"action"` // "like" or "dislike"
+	if post.Author != getUsername(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only remove helpers from your own posts"})
+		return
 	}
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if post.Status == models.PostStatusResolved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Helpers cannot be removed from a resolved post"})
 		return
 	}
 
-	var member models.Member
-	// Fetch the member and preload their liked/disliked posts
-	if err := db.Preload("LikedPosts").Preload("DislikedPosts").First(&member, "username = ?", username).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
-		return
-	}
-
-	switch request.Action {
-	case "like":
-		// Check if the user already liked the post
-		if containsPost(member.LikedPosts, post.PostId) {
-			db.Model(&member).Association("LikedPosts").Delete(&post)
-			post.Likes--
-		} else {
-			// Remove from disliked posts if it exists there
-			if containsPost(member.DislikedPosts, post.PostId) {
-				db.Model(&member).Association("DislikedPosts").Delete(&post)
-				post.Dislikes--
-			}
-			// Add to liked posts and increment likes counter
-			db.Model(&member).Association("LikedPosts").Append(&post)
-			post.Likes++
-		}
-		if post.Author != username {
-			title := "Your post was liked!"
-			content := fmt.Sprintf("%s liked your post: %s", username, post.Title)
-			sendAutoNotification(post.Author, title, content)
-		}
-
-	case "dislike":
-		// Check if the user already disliked the post
-		if containsPost(member.DislikedPosts, post.PostId) {
-			db.Model(&member).Association("DislikedPosts").Delete(&post)
-			post.Dislikes--
-		} else {
-			// Remove from liked posts if it exists there
-			if containsPost(member.LikedPosts, post.PostId) {
-				db.Model(&member).Association("LikedPosts").Delete(&post)
-				post.Likes--
-			}
-			// Add to disliked posts and increment dislikes counter
-			db.Model(&member).Association("DislikedPosts").Append(&post)
-			post.Dislikes++
-		}
-		if post.Author != username {
-			title := "Your post was disliked!"
-			content := fmt.Sprintf("%s disliked your post: %s", username, post.Title)
-			sendAutoNotification(post.Author, title, content)
-		}
-
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action"})
+	var assignment models.Assignment
+	if err := db.First(&assignment, "post_id = ? AND helper = ?", post.PostId, c.Param("username")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "This member is not helping with your post"})
 		return
 	}
 
-	// Save the updated post to update likes/dislikes counters in the database
-	if err := db.Save(&post).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post"})
+	if err := db.Delete(&assignment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove helper"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "Action applied successfully",
-		"likes":    post.Likes,
-		"dislikes": post.Dislikes,
-	})
-}
+	title := "You were removed from a post"
+	content := fmt.Sprintf("%s no longer needs your help with: %s", post.Author, post.Title)
+	sendAutoNotification(assignment.Helper, title, content)
 
-// Helper function to check if a post is in a list of posts
-func containsPost(posts []*models.Post, postId string) bool {
-	for _, p := range posts {
-		if p.PostId == postId {
-			return true
-		}
-	}
-	return false
+	c.JSON(http.StatusOK, gin.H{"message": "Helper removed"})
 }
 
-// GetComments godoc
+// GetMemberAssignments godoc
 //
-// @Summary 		Retrieves all comments for a specific post
-// @Description 	This API fetches all comments associated with a specific post, ordered by creation date (latest first).
-// @Tags 			comment
+// @Summary 		Get a member's assignments
+// @Description 	Retrieves the posts a member has been accepted to help with. Pass status=volunteered to list pending offers instead.
+// @Tags 			assignment
 // @Accept 			json
 // @Produce 		json
-// @Param 			postId path string true "Post ID"
-// @Success 		200 {array} models.Comment "List of comments"
-// @Failure 		400 {object} string "Bad Request"
-// @Failure 		404 {object} string "Post not found"
-// @Router 			/comment/{postId}/ [get]
-func getComments(c *gin.Context) {
-	postId := c.Param("postId")
+// @Param 			username path string true "Username of the member"
+// @Param 			status query string false "Assignment status (accepted or volunteered)"
+// @Success 		200 {array} models.Post
+// @Failure 		400 {object} string "Invalid status"
+// @Failure 		404 {object} string "User not found"
+// @Router 			/member/{username}/assignments [get]
+func getMemberAssignments(c *gin.Context) {
+	username := c.Param("username")
 
-	// Find the post first
-	var post models.Post
-	if err := db.First(&post, "post_id = ?", postId).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Post not found"})
+	var member models.Member
+	if err := db.First(&member, "username = ?", username).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	// Preload comments for the post ordered by createdAt descending (latest first)
-	var comments []models.Comment
-	result := db.Order("created_at desc").Where("post_id = ?", postId).Find(&comments)
+	status := c.DefaultQuery("status", models.AssignmentAccepted)
+	if status != models.AssignmentAccepted && status != models.AssignmentVolunteered {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
 
+	var posts []models.Post
+	result := db.Scopes(published).
+		Joins("JOIN assignments ON assignments.post_id = posts.post_id").
+		Where("assignments.helper = ? AND assignments.status = ?", username, status).
+		Order("assignments.created_at desc").
+		Find(&posts)
 	if result.Error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": result.Error.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": comments})
+	c.JSON(http.StatusOK, gin.H{"data": posts})
 }
 
-// GetCommentById godoc
+// ResolvePost godoc
 //
-// @Summary 		Retrieves a specific comment by its ID
-// @Description 	This API fetches a comment associated with a specific post by its unique comment ID.
-// @Tags 			comment
+// @Summary 		Marks a post as resolved
+// @Description 	Allows the author of a post to mark it as resolved. Volunteers can no longer sign up, and the author and accepted helpers can rate each other.
+// @Tags 			assignment
 // @Accept 			json
 // @Produce 		json
 // @Param 			postId path string true "Post ID"
-// @Param 			commentId path string true "Comment ID"
-// @Success 		200 {object} models.Comment "Comment details"
-// @Failure 		400 {object} string "Bad Request"
-// @Failure 		404 {object} string "Comment not found"
-// @Router 			/comment/{postId}/{commentId} [get]
-func getCommentById(c *gin.Context) {
-	postId := c.Param("postId")
-	commentId := c.Param("commentId")
+// @Success 		200 {object} models.Post
+// @Failure 		400 {object} string "Post is already resolved"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		403 {object} string "Forbidden - Only the author can resolve their own posts"
+// @Failure 		404 {object} string "Post not found"
+// @Router 			/post/{postId}/resolve [put]
+func resolvePost(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
 
-	var comment models.Comment
-	result := db.First(&comment, "comment_id = ? AND post_id = ?", commentId, postId)
+	var post models.Post
+	if err := db.Preload("Assignments").First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
 
+	if post.Author != getUsername(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only resolve your own posts"})
+		return
+	}
+	if post.Status == models.PostStatusResolved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Post is already resolved"})
+		return
+	}
+
+	now := time.Now().UTC()
+	result := db.Model(&post).Where("post_id = ?", post.PostId).Updates(models.Post{
+		Status:     models.PostStatusResolved,
+		ResolvedAt: &now,
+	})
 	if result.Error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve post"})
 		return
-	} else {
-		c.JSON(http.StatusOK, gin.H{"data": comment})
 	}
+
+	for _, assignment := range post.Assignments {
+		if assignment.Status != models.AssignmentAccepted {
+			continue
+		}
+		title := "A post you helped with was resolved!"
+		content := fmt.Sprintf("%s marked %s as resolved. You can now rate each other.", post.Author, post.Title)
+		sendAutoNotification(assignment.Helper, title, content)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Post resolved successfully", "data": post})
 }
 
-// CreateComment godoc
+// RatePostParticipant godoc
 //
-// @Summary 		Creates a new comment on a post
-// @Description 	This API allows a logged-in user to add a new comment to a specific post.
-// @Tags 			comment
+// @Summary 		Rates another participant of a resolved post
+// @Description 	Allows the author of a resolved post and each of its accepted helpers to rate each other once with a score from 1 to 5 and a short review. Ratings stay hidden until both sides have rated or the rating window closes.
+// @Tags 			rating
 // @Accept 			json
 // @Produce 		json
 // @Param 			postId path string true "Post ID"
-// @Param 			comment body models.Comment true "New comment data"
-// @Success 		200 {object} models.Comment "Created comment details"
+// @Param 			rating body models.Rating true "Ratee, score and review"
+// @Success 		201 {object} models.Rating
 // @Failure 		400 {object} string "Bad Request"
 // @Failure 		401 {object} string "Unauthorized"
+// @Failure 		403 {object} string "Forbidden - Only participants of the post can rate each other"
 // @Failure 		404 {object} string "Post not found"
-// @Router 			/comment/{postId} [post]
-func createComment(c *gin.Context) {
-	// Check if user is logged in
+// @Failure 		409 {object} string "Already rated"
+// @Router 			/post/{postId}/ratings [post]
+func ratePostParticipant(c *gin.Context) {
 	if err := Authorize(c); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
 	username := getUsername(c)
-	if username == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	// Get the post ID from URL parameter
-	postId := c.Param("postId")
 
-	// Verify the post exists
 	var post models.Post
-	if err := db.First(&post, "post_id = ?", postId).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Post not found"})
+	if err := db.First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
 		return
 	}
 
-	var newComment models.Comment
-
-	// Bind the JSON request to the comment struct
-	if err := c.ShouldBindJSON(&newComment); err != nil {
+	var rating models.Rating
+	if err := c.ShouldBindJSON(&rating); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Validate comment content
-	if newComment.Content == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment content is required"})
+	if post.Status != models.PostStatusResolved || post.ResolvedAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ratings open once the post is resolved"})
+		return
+	}
+	windowEnd := post.ResolvedAt.Add(ratingWindow)
+	if time.Now().UTC().After(windowEnd) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The rating window for this post has closed"})
+		return
+	}
+	if rating.Score < 1 || rating.Score > 5 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Score must be between 1 and 5"})
+		return
+	}
+	if len(rating.Review) > maxReviewLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Review cannot exceed %d characters", maxReviewLength)})
+		return
+	}
+	if rating.Ratee == username {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot rate yourself"})
 		return
 	}
 
-	// Set comment fields
-	newComment.Author = username
-	newComment.PostID = postId
-	newComment.CommentId = uuid.New().String()
-	newComment.Likes = 0
-	newComment.Dislikes = 0
-
-	// Create the comment in the database
-	result := db.Create(&newComment)
-	if result.Error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": result.Error.Error()})
+	// The author rates helpers and helpers rate the author, nobody else
+	var helper string
+	if post.Author == username {
+		helper = rating.Ratee
+	} else if post.Author == rating.Ratee {
+		helper = username
 	} else {
-		c.JSON(http.StatusOK, gin.H{"message": "Comment created successfully", "data": newComment})
-		if post.Author != username {
-			title := "New comment on your post!"
-			content := fmt.Sprintf("%s commented: %s", username, newComment.Content)
-			sendAutoNotification(post.Author, title, content)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author and accepted helpers of a post can rate each other"})
+		return
+	}
+	var assignment models.Assignment
+	if err := db.First(&assignment, "post_id = ? AND helper = ? AND status = ?", post.PostId, helper, models.AssignmentAccepted).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author and accepted helpers of a post can rate each other"})
+		return
+	}
+
+	rating.RatingId = uuid.New().String()
+	rating.PostID = post.PostId
+	rating.Rater = username
+	rating.CreatedAt = time.Now().UTC()
+	rating.VisibleAt = windowEnd
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var existing models.Rating
+		if err := tx.First(&existing, "post_id = ? AND rater = ? AND ratee = ?", post.PostId, username, rating.Ratee).Error; err == nil {
+			return errAlreadyRated
+		}
+
+		// Reveal both ratings as soon as the other side has rated too
+		reverse := tx.Model(&models.Rating{}).
+			Where("post_id = ? AND rater = ? AND ratee = ?", post.PostId, rating.Ratee, username).
+			Update("visible_at", rating.CreatedAt)
+		if reverse.Error != nil {
+			return reverse.Error
 		}
+		if reverse.RowsAffected > 0 {
+			rating.VisibleAt = rating.CreatedAt
+		}
+
+		return tx.Create(&rating).Error
+	})
+	if errors.Is(err, errAlreadyRated) {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already rated this member for this post"})
+		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rating"})
+		return
+	}
+
+	title := "You received a rating!"
+	content := fmt.Sprintf("%s rated you for: %s", username, post.Title)
+	sendAutoNotification(rating.Ratee, title, content)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Rating submitted", "data": rating})
 }
 
-// UpdateComment godoc
+// GetPostRatings godoc
 //
-// @Summary 		Updates an existing comment
-// @Description 	This API allows the author of a comment to update its content.
-// @Tags 			comment
+// @Summary 		Gets the visible ratings of a post
+// @Description 	Retrieves the ratings exchanged on a post that have been revealed.
+// @Tags 			rating
 // @Accept 			json
 // @Produce 		json
 // @Param 			postId path string true "Post ID"
-// @Param 			commentId path string true "Comment ID"
-// @Success 		200 {object} models.Comment "Updated comment details"
-// @Failure 		400 {object} string "Bad Request or Empty Content"
-// @Failure 		401 {object} string "Unauthorized"
-// @Failure 		403 {object} string "Forbidden - Only the author can update their own comments"
-// @Failure 		404 {object} string "Comment not found"
-// @Router 			/comment/{postId}/{commentId} [put]
-func updateComment(c *gin.Context) {
-	if err := Authorize(c); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+// @Success 		200 {array} models.Rating
+// @Failure 		404 {object} string "Post not found"
+// @Router 			/post/{postId}/ratings [get]
+func getPostRatings(c *gin.Context) {
+	var post models.Post
+	if err := db.First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
 		return
 	}
 
-	postId := c.Param("postId")
-	commentId := c.Param("commentId")
+	var ratings []models.Rating
+	result := db.Where("post_id = ? AND visible_at <= ?", post.PostId, time.Now().UTC()).Order("created_at desc").Find(&ratings)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
 
-	var comment models.Comment
-	if err := db.First(&comment, "comment_id = ? AND post_id = ?", commentId, postId).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+	c.JSON(http.StatusOK, gin.H{"data": ratings})
+}
+
+// GetMemberRatings godoc
+//
+// @Summary 		Gets the ratings a member received
+// @Description 	Retrieves the revealed ratings a member received, along with their average score.
+// @Tags 			rating
+// @Accept 			json
+// @Produce 		json
+// @Param 			username path string true "Username of the member"
+// @Success 		200 {object} map[string]interface{} "Ratings, average and count"
+// @Failure 		404 {object} string "User not found"
+// @Router 			/member/{username}/ratings [get]
+func getMemberRatings(c *gin.Context) {
+	username := c.Param("username")
+
+	var member models.Member
+	if err := db.First(&member, "username = ?", username).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	// Check if the comment belongs to the logged-in user
-	username := getUsername(c)
-	if comment.Author != username {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only update your own comments"})
+	var ratings []models.Rating
+	result := db.Where("ratee = ? AND visible_at <= ?", username, time.Now().UTC()).Order("created_at desc").Find(&ratings)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
 
-	var updateData struct {
-		Content string `json:"content"`
+	average, count := getRatingSummary(username)
+	c.JSON(http.StatusOK, gin.H{"average": average, "count": count, "data": ratings})
+}
+
+// BookmarkPost godoc
+//
+// @Summary 		Bookmarks a post
+// @Description 	Saves a post for the logged-in member to come back to later, optionally filed into one of their collections. Bookmarking a post twice returns the existing bookmark.
+// @Tags 			bookmark
+// @Accept 			json
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Success 		201 {object} models.Bookmark
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		404 {object} string "Post or collection not found"
+// @Router 			/post/{postId}/bookmark [post]
+func bookmarkPost(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var post models.Post
+	if err := db.Scopes(published).First(&post, "post_id = ?", c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
 	}
 
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	saveBookmark(c, models.BookmarkTargetPost, post.PostId)
+}
+
+// UnbookmarkPost godoc
+//
+// @Summary 		Removes the bookmark of a post
+// @Tags 			bookmark
+// @Accept 			json
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Success 		200 {object} string "Bookmark removed"
+// @Failure 		401 {object} string "Unauthorized"
+// @Router 			/post/{postId}/bookmark [delete]
+func unbookmarkPost(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	if updateData.Content == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment content cannot be empty"})
+	db.Where("owner = ? AND target_type = ? AND target_id = ?", getUsername(c), models.BookmarkTargetPost, c.Param("postId")).
+		Delete(&models.Bookmark{})
+	c.JSON(http.StatusOK, gin.H{"message": "Bookmark removed"})
+}
+
+// BookmarkComment godoc
+//
+// @Summary 		Bookmarks a comment
+// @Description 	Saves a comment for the logged-in member to come back to later, optionally filed into one of their collections. Bookmarking a comment twice returns the existing bookmark.
+// @Tags 			bookmark
+// @Accept 			json
+// @Produce 		json
+// @Param 			postId path string true "Post ID"
+// @Param 			commentId path string true "Comment ID"
+// @Success 		201 {object} models.Bookmark
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		404 {object} string "Comment or collection not found"
+// @Router 			/comment/{postId}/{commentId}/bookmark [post]
+func bookmarkComment(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	comment.Content = updateData.Content
-	if err := db.Save(&comment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+	var post models.Post
+	var comment models.Comment
+	if db.Scopes(published).First(&post, "post_id = ?", c.Param("postId")).Error != nil ||
+		db.First(&comment, "comment_id = ? AND post_id = ?", c.Param("commentId"), post.PostId).Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Comment updated successfully",
-		"data":    comment,
-	})
+	saveBookmark(c, models.BookmarkTargetComment, comment.CommentId)
 }
 
-// DeleteComment godoc
+// UnbookmarkComment godoc
 //
-// @Summary 		Deletes an existing comment
-// @Description 	This API allows the author of a comment to delete it from a specific post.
-// @Tags 			comment
+// @Summary 		Removes the bookmark of a comment
+// @Tags 			bookmark
 // @Accept 			json
 // @Produce 		json
 // @Param 			postId path string true "Post ID"
 // @Param 			commentId path string true "Comment ID"
-// @Success 		200 {object} string "Comment deleted successfully"
-// @Failure 		400 {object} string "Bad Request"
+// @Success 		200 {object} string "Bookmark removed"
 // @Failure 		401 {object} string "Unauthorized"
-// @Failure 		403 {object} string "Forbidden - Only the author can delete their own comments"
-// @Failure 		404 {object} string "Comment not found"
-// @Router 			/comment/{postId}/{commentId} [delete]
-func deleteComment(c *gin.Context) {
-	// Check if user is logged in
+// @Router 			/comment/{postId}/{commentId}/bookmark [delete]
+func unbookmarkComment(c *gin.Context) {
 	if err := Authorize(c); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
-		return
-	}
-
-	username := getUsername(c)
-	if username == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	// Get parameters from URL
-	postId := c.Param("postId")
-	commentId := c.Param("commentId")
+	db.Where("owner = ? AND target_type = ? AND target_id = ?", getUsername(c), models.BookmarkTargetComment, c.Param("commentId")).
+		Delete(&models.Bookmark{})
+	c.JSON(http.StatusOK, gin.H{"message": "Bookmark removed"})
+}
 
-	// Find the comment
-	var comment models.Comment
-	result := db.First(&comment, "comment_id = ? AND post_id = ?", commentId, postId)
+// Creates the bookmark for bookmarkPost and bookmarkComment. The body may
+// name a collection to file it into.
+func saveBookmark(c *gin.Context, targetType, targetId string) {
+	var request struct {
+		CollectionID *string `json:"collection_id"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if request.CollectionID != nil && *request.CollectionID == "" {
+		request.CollectionID = nil
+	}
 
-	if result.Error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment not found"})
+	bookmark, created, err := addBookmark(getUsername(c), targetType, targetId, request.CollectionID)
+	if errors.Is(err, errCollectionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
 		return
 	}
-
-	// Check if the user is the author of the comment
-	if comment.Author != username {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "You can only delete your own comments"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save bookmark"})
 		return
 	}
 
-	// Delete the comment
-	db.Delete(&comment)
-	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
+	if !created {
+		c.JSON(http.StatusOK, gin.H{"message": "Already bookmarked", "data": bookmark})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Bookmarked successfully", "data": bookmark})
 }
 
-// LikeOrDislikeComment godoc
+// GetBookmarks godoc
 //
-// @Summary 		Like or dislike action on a comment
-// @Description 	This API allows a logged-in user to like or dislike a specific comment. The action is specified in the request body as either "like" or "dislike".
-// @Tags 			comment
+// @Summary 		Lists the logged-in member's bookmarks
+// @Description 	Returns every bookmark with the post or comment it points at, newest first. With collection_id, returns the bookmarks of that collection in the member's order instead.
+// @Tags 			bookmark
 // @Accept 			json
 // @Produce 		json
-// @Param 			postId path string true "Post ID"
-// @Param 			commentId path string true "Comment ID"
-// @Success 		200 {object} map[string]interface{} "Action applied successfully with updated like/dislike counts"
-// @Failure 		400 {object} string "Invalid action"
+// @Param 			collection_id query string false "Collection ID"
+// @Success 		200 {array} models.Bookmark
 // @Failure 		401 {object} string "Unauthorized"
-// @Router 			/comment/{postId}/{commentId}/like-dislike [put]
-func likeOrDislikeComment(c *gin.Context) {
+// @Failure 		404 {object} string "Collection not found"
+// @Router 			/bookmark [get]
+func getBookmarks(c *gin.Context) {
 	if err := Authorize(c); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
 	username := getUsername(c)
-	if username == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	query := db.Where("owner = ?", username)
+	if collectionId := c.Query("collection_id"); collectionId != "" {
+		if _, err := findCollection(db, username, collectionId); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+			return
+		}
+		query = query.Where("collection_id = ?", collectionId).Order("position asc")
+	} else {
+		query = query.Order("created_at desc")
+	}
+
+	var bookmarks []models.Bookmark
+	if err := query.Find(&bookmarks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	postId := c.Param("postId")
-	commentId := c.Param("commentId")
-	var comment models.Comment
+	c.JSON(http.StatusOK, gin.H{"data": loadBookmarkTargets(bookmarks)})
+}
 
-	if err := db.First(&comment, "comment_id = ? AND post_id = ?", commentId, postId).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+// MoveBookmark godoc
+//
+// @Summary 		Files a bookmark into a collection
+// @Description 	Moves a bookmark to the end of a collection, or out of any collection when collection_id is empty.
+// @Tags 			bookmark
+// @Accept 			json
+// @Produce 		json
+// @Param 			bookmarkId path string true "Bookmark ID"
+// @Success 		200 {object} models.Bookmark
+// @Failure 		400 {object} string "Bad Request"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		404 {object} string "Bookmark or collection not found"
+// @Router 			/bookmark/{bookmarkId} [put]
+func moveBookmark(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
 	var request struct {
-		Action string `json:"action"`
+		CollectionID *string `json:"collection_id"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	var member models.Member
-	if err := db.Preload("LikedComments").Preload("DislikedComments").First(&member, "username = ?", username).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
-		return
+	if request.CollectionID != nil && *request.CollectionID == "" {
+		request.CollectionID = nil
 	}
 
-	switch request.Action {
-	case "like":
-		if containsComment(member.LikedComments, comment.CommentId) {
-			db.Model(&member).Association("LikedComments").Delete(&comment)
-			comment.Likes--
-		} else {
-			if containsComment(member.DislikedComments, comment.CommentId) {
-				db.Model(&member).Association("DislikedComments").Delete(&comment)
-				comment.Dislikes--
-			}
-			db.Model(&member).Association("LikedComments").Append(&comment)
-			comment.Likes++
-		}
-		if comment.Author != username {
-			title := "Your comment was liked!"
-			content := fmt.Sprintf("%s liked your comment: %s", username, comment.Content)
-			sendAutoNotification(comment.Author, title, content)
+	username := getUsername(c)
+	var bookmark models.Bookmark
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&bookmark, "bookmark_id = ? AND owner = ?", c.Param("bookmarkId"), username).Error; err != nil {
+			return err
 		}
-
-	case "dislike":
-		if containsComment(member.DislikedComments, comment.CommentId) {
-			db.Model(&member).Association("DislikedComments").Delete(&comment)
-			comment.Dislikes--
-		} else {
-			if containsComment(member.LikedComments, comment.CommentId) {
-				db.Model(&member).Association("LikedComments").Delete(&comment)
-				comment.Likes--
+		if request.CollectionID != nil {
+			if _, err := findCollection(tx, username, *request.CollectionID); err != nil {
+				return err
 			}
-			db.Model(&member).Association("DislikedComments").Append(&comment)
-			comment.Dislikes++
 		}
-		if comment.Author != username {
-			title := "Your comment was disliked!"
-			content := fmt.Sprintf("%s disliked your comment: %s", username, comment.Content)
-			sendAutoNotification(comment.Author, title, content)
+		position, err := nextBookmarkPosition(tx, username, request.CollectionID)
+		if err != nil {
+			return err
 		}
 
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action"})
+		bookmark.CollectionID = request.CollectionID
+		bookmark.Position = position
+		return tx.Model(&bookmark).Updates(map[string]any{"collection_id": bookmark.CollectionID, "position": bookmark.Position}).Error
+	})
+	if errors.Is(err, errCollectionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
 		return
 	}
-
-	if err := db.Save(&comment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bookmark not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "Action applied successfully",
-		"likes":    comment.Likes,
-		"dislikes": comment.Dislikes,
-	})
+	c.JSON(http.StatusOK, gin.H{"message": "Bookmark moved", "data": bookmark})
 }
 
-// Helper function to check if a comment is in a list of comments
-func containsComment(comments []*models.Comment, commentId string) bool {
-	for _, c := range comments {
-		if c.CommentId == commentId {
-			return true
-		}
+// DeleteBookmark godoc
+//
+// @Summary 		Removes a bookmark
+// @Tags 			bookmark
+// @Accept 			json
+// @Produce 		json
+// @Param 			bookmarkId path string true "Bookmark ID"
+// @Success 		200 {object} string "Bookmark removed"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		404 {object} string "Bookmark not found"
+// @Router 			/bookmark/{bookmarkId} [delete]
+func deleteBookmark(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
 	}
-	return false
+
+	result := db.Where("bookmark_id = ? AND owner = ?", c.Param("bookmarkId"), getUsername(c)).Delete(&models.Bookmark{})
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bookmark not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Bookmark removed"})
 }
 
-// GetUserLikedComments godoc
+// GetCollections godoc
 //
-// @Summary 		Retrieves comments liked by a specific user
-// @Description 	This API fetches all comments that have been liked by a specific user, identified by their username.
-// @Tags 			member
+// @Summary 		Lists the logged-in member's collections
+// @Description 	Returns the member's collections by name, with the number of bookmarks in each.
+// @Tags 			bookmark
 // @Accept 			json
 // @Produce 		json
-// @Param 			username path string true "Username of the member"
-// @Success 		200 {array} models.Comment
-// @Failure 		400 {object} string "Bad Request"
-// @Failure 		404 {object} string "User not found"
+// @Success 		200 {array} models.Collection
 // @Failure 		401 {object} string "Unauthorized"
-// @Router 			/member/{username}/liked-comments [get]
-func getUserLikedComments(c *gin.Context) {
+// @Router 			/collection [get]
+func getCollections(c *gin.Context) {
 	if err := Authorize(c); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	username := c.Param("username")
-
-	var member models.Member
-	if err := db.Preload("LikedComments").First(&member, "username = ?", username).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	username := getUsername(c)
+	var collections []models.Collection
+	if err := db.Where("owner = ?", username).Order("name asc").Find(&collections).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": member.LikedComments})
+	var counts []struct {
+		CollectionID string
+		Count        int64
+	}
+	db.Model(&models.Bookmark{}).
+		Select("collection_id, COUNT(*) AS count").
+		Where("owner = ? AND collection_id IS NOT NULL", username).
+		Group("collection_id").
+		Scan(&counts)
+	byCollection := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		byCollection[count.CollectionID] = count.Count
+	}
+	for i := range collections {
+		collections[i].ItemCount = byCollection[collections[i].CollectionId]
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": collections})
 }
 
-// GetUserDislikedComments godoc
+// CreateCollection godoc
 //
-// @Summary 		Retrieves comments disliked by a specific user
-// @Description 	This API fetches all comments that have been disliked by a specific user, identified by their username.
-// @Tags 			member
+// @Summary 		Creates a collection
+// @Description 	Creates a named collection for the logged-in member to organize bookmarks into. Names are unique per member.
+// @Tags 			bookmark
 // @Accept 			json
 // @Produce 		json
-// @Param 			username path string true "Username of the member"
-// @Success 		200 {array} models.Comment
+// @Success 		201 {object} models.Collection
 // @Failure 		400 {object} string "Bad Request"
-// @Failure 		404 {object} string "User not found"
 // @Failure 		401 {object} string "Unauthorized"
-// @Router 			/member/{username}/disliked-comments [get]
-func getUserDislikedComments(c *gin.Context) {
+// @Failure 		409 {object} string "A collection with that name already exists"
+// @Router 			/collection [post]
+func createCollection(c *gin.Context) {
 	if err := Authorize(c); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	username := c.Param("username")
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(request.Name)
+	if name == "" || len(name) > maxCollectionNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errCollectionName.Error()})
+		return
+	}
 
-	var member models.Member
-	if err := db.Preload("DislikedComments").First(&member, "username = ?", username).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	collection := models.Collection{
+		CollectionId: uuid.New().String(),
+		CreatedAt:    time.Now().UTC(),
+		Owner:        getUsername(c),
+		Name:         name,
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&collection)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create collection"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A collection with that name already exists"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": member.DislikedComments})
+	c.JSON(http.StatusCreated, gin.H{"message": "Collection created successfully", "data": collection})
 }
 
-// GetNotifications godoc
+// RenameCollection godoc
 //
-// @Summary 		Gets notifications for the current user
-// @Description 	Fetches a slice of notifications for the logged-in user. Supports optional query parameters for sorting, limit, and offset.
-// @Tags 			notification
+// @Summary 		Renames a collection
+// @Tags 			bookmark
 // @Accept 			json
 // @Produce 		json
-// @Success 		200 {object} map[string]interface{} "Notifications list and count"
+// @Param 			collectionId path string true "Collection ID"
+// @Success 		200 {object} models.Collection
 // @Failure 		400 {object} string "Bad Request"
 // @Failure 		401 {object} string "Unauthorized"
-// @Router 			/notification [get]
-func getNotifications(c *gin.Context) {
-
+// @Failure 		404 {object} string "Collection not found"
+// @Failure 		409 {object} string "A collection with that name already exists"
+// @Router 			/collection/{collectionId} [put]
+func renameCollection(c *gin.Context) {
 	if err := Authorize(c); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	//Start by reading in the sorting column and direction
-	var notiQuery models.SearchQuery
-	if err := c.ShouldBindQuery(&notiQuery); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	collection, err := findCollection(db, getUsername(c), c.Param("collectionId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
 		return
 	}
 
-	//If no limit or offset was passed in, set to -1 for the SQL command
-	if notiQuery.Limit == 0 {
-		notiQuery.Limit = -1
+	var request struct {
+		Name string `json:"name"`
 	}
-	if notiQuery.Offset == 0 {
-		notiQuery.Offset = -1
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-
-	//Format the order for sorting
-	var order string
-	if notiQuery.Order != "" {
-		order = notiQuery.Column + " " + notiQuery.Order
-	} else {
-		order = notiQuery.Column
+	name := strings.TrimSpace(request.Name)
+	if name == "" || len(name) > maxCollectionNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errCollectionName.Error()})
+		return
 	}
 
-	var notis []models.Notification
+	var taken int64
+	db.Model(&models.Collection{}).
+		Where("owner = ? AND name = ? AND collection_id <> ?", collection.Owner, name, collection.CollectionId).
+		Count(&taken)
+	if taken > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A collection with that name already exists"})
+		return
+	}
 
-	// Fetch posts ordered by the passed in column, with slices specified
-	result := db.Where("username = ?", getUsername(c)).Order(order).Limit(notiQuery.Limit).Offset(notiQuery.Offset).Find(&notis)
+	collection.Name = name
+	if err := db.Model(&collection).Update("name", collection.Name).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A collection with that name already exists"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Collection renamed", "data": collection})
+}
 
-	if result.Error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": result.Error.Error()})
+// DeleteCollection godoc
+//
+// @Summary 		Deletes a collection
+// @Description 	Deletes a collection. Its bookmarks are kept and no longer filed into any collection.
+// @Tags 			bookmark
+// @Accept 			json
+// @Produce 		json
+// @Param 			collectionId path string true "Collection ID"
+// @Success 		200 {object} string "Collection deleted"
+// @Failure 		401 {object} string "Unauthorized"
+// @Failure 		404 {object} string "Collection not found"
+// @Router 			/collection/{collectionId} [delete]
+func deleteCollection(c *gin.Context) {
+	if err := Authorize(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	//Get the count
-	var count int64
-	db.Model(&models.Notification{}).Where("username = ?", getUsername(c)).Count(&count)
+	collection, err := findCollection(db, getUsername(c), c.Param("collectionId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"count": count, "data": notis})
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Bookmark{}).
+			Where("collection_id = ?", collection.CollectionId).
+			Updates(map[string]any{"collection_id": nil, "position": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&collection).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete collection"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Collection deleted"})
 }
 
-// GetNotificationById godoc
+// ReorderCollection godoc
 //
-// @Summary 		Gets a notification by its ID
-// @Description 	Fetches a single notification by its unique ID.
-// @Tags 			notification
+// @Summary 		Reorders the bookmarks of a collection
+// @Description 	Sets the order of a collection's bookmarks. bookmark_ids must list every bookmark of the collection exactly once.
+// @Tags 			bookmark
 // @Accept 			json
 // @Produce 		json
-// @Param 			id path string true "Notification ID"
-// @Success 		200 {object} models.Notification
-// @Failure 		400 {object} string "No Records Found"
+// @Param 			collectionId path string true "Collection ID"
+// @Success 		200 {object} string "Collection reordered"
+// @Failure 		400 {object} string "Bad Request"
 // @Failure 		401 {object} string "Unauthorized"
-// @Router 			/notification/{id} [get]
-func getNotificationById(c *gin.Context) {
-
+// @Failure 		404 {object} string "Collection not found"
+// @Router 			/collection/{collectionId}/order [put]
+func reorderCollectionBookmarks(c *gin.Context) {
 	if err := Authorize(c); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	id := c.Param("id")
-
-	var noti models.Notification
-
-	result := db.First(&noti, "id = ?", id)
-
-	if result.Error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No Records Found"})
+	var request struct {
+		BookmarkIds []string `json:"bookmark_ids"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := reorderCollection(getUsername(c), c.Param("collectionId"), request.BookmarkIds)
+	if errors.Is(err, errCollectionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+	if errors.Is(err, errInvalidOrder) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder collection"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Collection reordered"})
+}
+
+// GetBuildings godoc
+//
+// @Summary 		Lists campus buildings
+// @Description 	Returns the campus buildings posts can be placed at, by name
+// @Tags 			post
+// @Produce 		json
+// @Success 		200 {array} models.Building
+// @Router 			/building [get]
+func getBuildings(c *gin.Context) {
+	var buildings []models.Building
+	if err := db.Order("name asc").Find(&buildings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
-	} else {
-		c.JSON(http.StatusOK, gin.H{"data": noti})
 	}
+	c.JSON(http.StatusOK, gin.H{"data": buildings})
 }
 
-// SendNotification godoc
+// UploadImages godoc
 //
-// @Summary 		Sends a notification to a user
-// @Description 	Sends a notification with a title and content to a specified user.
-// @Tags 			notification
-// @Accept 			json
+// @Summary 		Uploads images
+// @Description 	Stores one or more images and returns their IDs, which are then referenced from a post's images. Send the files as multipart form fields named "image", or a JSON body {"images": [data URLs]}. Alt text and captions can be sent alongside, one per image, as "alt_text"/"caption" form fields or "alt_texts"/"captions" arrays. Metadata such as EXIF GPS tags is stripped and medium and thumbnail variants are generated. Up to 10 images can be sent at once. Identical images are only stored once, but each uploader keeps their own alt text and caption.
+// @Tags 			image
+// @Accept 			multipart/form-data
 // @Produce 		json
-// @Param 			notification body models.Notification true "Notification data"
-// @Success 		201 {object} string "Notification sent"
-// @Failure 		400 {object} string "Notification title, content, and username (recipient) required"
+// @Success 		201 {array} models.Image
+// @Failure 		400 {object} string "Bad Request"
 // @Failure 		401 {object} string "Unauthorized"
-// @Router 			/notification [post]
-func sendNotification(c *gin.Context) {
-
+// @Router 			/image [post]
+func uploadImages(c *gin.Context) {
 	if err := Authorize(c); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	var noti models.Notification
-	if err := c.ShouldBindJSON(&noti); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	username := getUsername(c)
+
+	// Collect the raw bytes of every image in the request, with the
+	// optional alt text and caption sent at the same position
+	var uploads [][]byte
+	var altTexts, captions []string
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		form, err := c.MultipartForm()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(form.File["image"]) > maxImagesPerUpload {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errTooManyImages.Error()})
+			return
+		}
+		for _, header := range form.File["image"] {
+			if header.Size > maxImageSize {
+				c.JSON(http.StatusBadRequest, gin.H{"error": errImageTooLarge.Error()})
+				return
+			}
+			file, err := header.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			data, err := io.ReadAll(io.LimitReader(file, maxImageSize+1))
+			file.Close()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			uploads = append(uploads, data)
+		}
+		altTexts = form.Value["alt_text"]
+		captions = form.Value["caption"]
+	} else {
+		var request struct {
+			Images   []string `json:"images"`
+			AltTexts []string `json:"alt_texts"`
+			Captions []string `json:"captions"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(request.Images) > maxImagesPerUpload {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errTooManyImages.Error()})
+			return
+		}
+		for _, dataURL := range request.Images {
+			data, err := decodeDataURL(dataURL)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			uploads = append(uploads, data)
+		}
+		altTexts = request.AltTexts
+		captions = request.Captions
 	}
 
-	if noti.Title == "" || noti.Content == "" || noti.Username == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Notification title, content, and username (recipient) required"})
+	if len(uploads) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No images were uploaded"})
 		return
 	}
 
-	noti.Id = uuid.New().String()
-	noti.Read = false
-
-	db.Create(&noti)
+	images := []models.Image{}
+	for i, data := range uploads {
+		var altText, caption string
+		if i < len(altTexts) {
+			altText = strings.TrimSpace(altTexts[i])
+		}
+		if i < len(captions) {
+			caption = strings.TrimSpace(captions[i])
+		}
+		image, err := storeImage(data, username, altText, caption)
+		if isImageInputError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image"})
+			return
+		}
+		images = append(images, image)
+	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Notification sent"})
+	c.JSON(http.StatusCreated, gin.H{"message": "Images uploaded successfully", "data": images})
 }
 
-// DeleteNotification godoc
+// GetImage godoc
 //
-// @Summary 		Deletes a notification
-// @Description 	Deletes a notification by its unique ID. Only the recipient can delete their own notifications.
-// @Tags 			notification
-// @Accept 			json
-// @Produce 		json
-// @Param 			id path string true "Notification ID"
-// @Success 		200 {object} string "Notification deleted successfully"
-// @Failure 		400 {object} string "Notification not found or not owned by user"
-// @Failure 		401 {object} string "Unauthorized"
-// @Router 			/notification/{id} [delete]
-func deleteNotification(c *gin.Context) {
-
-	if err := Authorize(c); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+// @Summary 		Serves an image
+// @Description 	Returns the content of an uploaded image, or one of its resized variants. Images never change once uploaded, so responses can be cached indefinitely.
+// @Tags 			image
+// @Produce 		png
+// @Produce 		jpeg
+// @Param 			imageId path string true "Image ID"
+// @Param 			size query string false "original (default), medium (at most 800px) or thumb (at most 200px)"
+// @Success 		200 {file} binary
+// @Success 		304 {object} string "Not Modified"
+// @Failure 		400 {object} string "Invalid size"
+// @Failure 		404 {object} string "Image not found"
+// @Router 			/image/{imageId} [get]
+func getImage(c *gin.Context) {
+	variant := c.DefaultQuery("size", variantOriginal)
+	if _, ok := variantSizes[variant]; !ok && variant != variantOriginal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Size must be original, medium or thumb"})
 		return
 	}
 
-	id := c.Param("id")
+	var image models.Image
+	if err := db.First(&image, "image_id = ?", c.Param("imageId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
 
-	var noti models.Notification
-	if err := db.First(&noti, "id = ?", id).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Notification not found"})
+	etag := `"` + image.ImageId + "-" + variant + `"`
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", etag)
+	c.Header("X-Content-Type-Options", "nosniff")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
-	if noti.Username != getUsername(c) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "You can only delete your own notifications"})
+	data, err := blobStore.Get(imageKey(image.ImageId, variant))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
 		return
 	}
 
-	db.Delete(&noti)
-	c.JSON(http.StatusOK, gin.H{"message": "Notification deleted successfully"})
+	c.Data(http.StatusOK, variantContentType(image.ContentType, variant), data)
 }
 
-// UpdateNotification godoc
+// UpdateImage godoc
 //
-// @Summary 		Updates a notification's read status
-// @Description 	Updates the read status of a notification by its unique ID. Only the recipient can update their own notifications.
-// @Tags 			notification
+// @Summary 		Updates the alt text and caption of an image
+// @Description 	Changes how the signed-in member describes an image they uploaded. Members who uploaded the same file each keep their own description. The image content itself never changes.
+// @Tags 			image
 // @Accept 			json
 // @Produce 		json
-// @Param 			id path string true "Notification ID"
-// @Success 		200 {object} string "Notification updated successfully"
-// @Failure 		404 {object} string "Notification not found"
-// @Failure 		400 {object} string "You can only update your own notifications"
+// @Param 			imageId path string true "Image ID"
+// @Success 		200 {object} models.Image
+// @Failure 		400 {object} string "Bad Request"
 // @Failure 		401 {object} string "Unauthorized"
-// @Router 			/notification/{id} [put]
-func updateNotification(c *gin.Context) {
-
+// @Failure 		403 {object} string "Forbidden"
+// @Failure 		404 {object} string "Image not found"
+// @Router 			/image/{imageId} [put]
+func updateImage(c *gin.Context) {
 	if err := Authorize(c); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	id := c.Param("id")
-
-	var noti models.Notification
-	if err := db.First(&noti, "id = ?", id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+	var image models.Image
+	if err := db.First(&image, "image_id = ?", c.Param("imageId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
 		return
 	}
-
-	if noti.Username != getUsername(c) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "You can only update your own notifications"})
+	var description models.ImageDescription
+	if err := db.First(&description, "image_id = ? AND uploader = ?", image.ImageId, getUsername(c)).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only members who uploaded an image can describe it"})
 		return
 	}
 
-	var updateReq struct {
-		Read bool `json:"read"`
+	var request struct {
+		AltText *string `json:"alt_text"`
+		Caption *string `json:"caption"`
 	}
-	if err := c.ShouldBindJSON(&updateReq); err != nil {
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if request.AltText != nil {
+		description.AltText = strings.TrimSpace(*request.AltText)
+	}
+	if request.Caption != nil {
+		description.Caption = strings.TrimSpace(*request.Caption)
+	}
+	if len(description.AltText) > maxAltTextLength || len(description.Caption) > maxCaptionLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errImageText.Error()})
+		return
+	}
 
-	db.Model(&models.Notification{}).Where("id = ?", id).Update("read", updateReq.Read)
-	c.JSON(http.StatusOK, gin.H{"message": "Notification updated successfully"})
+	if err := db.Model(&description).Select("alt_text", "caption").Updates(description).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update image"})
+		return
+	}
+	image.AltText = description.AltText
+	image.Caption = description.Caption
+	c.JSON(http.StatusOK, gin.H{"message": "Image updated successfully", "data": image})
 }
 
-// UpdateNotifications godoc
+// UploadAttachments godoc
 //
-// @Summary 		Bulk update notifications' read status
-// @Description 	Sets all notifications for the logged-in user to read/unread.
-// @Tags 			notification
-// @Accept 			json
+// @Summary 		Uploads file attachments
+// @Description 	Stores one or more files, sent as multipart form fields named "file", and returns their IDs, which are then referenced from a post's attachments. PDF, plain text, Markdown, CSV and Word, Excel and PowerPoint files are accepted; the type is detected from the content and must agree with the file extension. Files are limited to 10 MB each and 100 MB per member, and are passed through the virus scanner before being stored. If any file is refused, none of the upload is kept.
+// @Tags 			attachment
+// @Accept 			multipart/form-data
 // @Produce 		json
-// @Success 		200 {object} string "Notifications updated successfully"
+// @Success 		201 {array} models.Attachment
 // @Failure 		400 {object} string "Bad Request"
 // @Failure 		401 {object} string "Unauthorized"
-// @Router 			/notification [put]
-func updateNotifications(c *gin.Context) {
-
+// @Router 			/attachment [post]
+func uploadAttachments(c *gin.Context) {
 	if err := Authorize(c); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	var updateReq struct {
-		Read bool `json:"read"`
-	}
-	if err := c.ShouldBindJSON(&updateReq); err != nil {
+	username := getUsername(c)
+
+	form, err := c.MultipartForm()
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	headers := form.File["file"]
+	if len(headers) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files were uploaded"})
+		return
+	}
 
-	db.Model(&models.Notification{}).Where("username = ?", getUsername(c)).Update("read", updateReq.Read)
-	c.JSON(http.StatusOK, gin.H{"message": "Notifications updated successfully"})
+	attachments := []models.Attachment{}
+	for _, header := range headers {
+		data, err := readAttachmentUpload(header)
+		var attachment models.Attachment
+		if err == nil {
+			attachment, err = storeAttachment(data, header.Filename, username)
+		}
+		if err != nil {
+			// An upload is stored whole or not at all
+			discardAttachments(attachments)
+			if isAttachmentInputError(err) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store attachment"})
+			}
+			return
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Attachments uploaded successfully", "data": attachments})
 }
 
-// FollowMember godoc
+// GetAttachments godoc
 //
-// @Summary 		Follow a member
-// @Description 	Allows the logged-in user to follow another member by username.
-// @Tags 			member
-// @Accept 			json
+// @Summary 		Lists the logged-in member's attachments
+// @Description 	Returns every file the member uploaded, newest first, along with how much of their quota is used.
+// @Tags 			attachment
 // @Produce 		json
-// @Param 			username path string true "Username of the member to follow"
-// @Success 		200 {object} string "Followed successfully"
-// @Failure 		400 {object} string "Cannot follow yourself or bad request"
+// @Success 		200 {array} models.Attachment
 // @Failure 		401 {object} string "Unauthorized"
-// @Failure 		404 {object} string "User not found"
-// @Failure 		500 {object} string "Failed to follow"
-// @Router 			/member/{username}/follow [post]
-func followMember(c *gin.Context) {
+// @Router 			/attachment [get]
+func getAttachments(c *gin.Context) {
 	if err := Authorize(c); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	follower := getUsername(c)
-	followee := c.Param("username")
-	if follower == followee {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot follow yourself"})
+
+	username := getUsername(c)
+
+	var attachments []models.Attachment
+	if err := db.Where("uploader = ?", username).Order("created_at desc").Find(&attachments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	used, err := attachmentUsage(db, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	var followerMember, followeeMember models.Member
-	if db.First(&followerMember, "username = ?", follower).Error != nil ||
-		db.First(&followeeMember, "username = ?", followee).Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	c.JSON(http.StatusOK, gin.H{"data": attachments, "used": used, "quota": memberAttachmentQuota})
+}
+
+// GetAttachment godoc
+//
+// @Summary 		Downloads an attachment
+// @Description 	Returns the content of an uploaded file. It is always sent as a download under its original name, never displayed inline.
+// @Tags 			attachment
+// @Produce 		octet-stream
+// @Param 			attachmentId path string true "Attachment ID"
+// @Success 		200 {file} binary
+// @Success 		304 {object} string "Not Modified"
+// @Failure 		404 {object} string "Attachment not found"
+// @Router 			/attachment/{attachmentId} [get]
+func getAttachment(c *gin.Context) {
+	var attachment models.Attachment
+	if err := db.First(&attachment, "attachment_id = ?", c.Param("attachmentId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
 		return
 	}
 
-	// Add follow relationship
-	if err := db.Model(&followerMember).Association("Following").Append(&followeeMember); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow"})
+	etag := `"` + attachment.SHA256 + `"`
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	c.Header("ETag", etag)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+	c.Header("Content-Disposition", contentDisposition(attachment.FileName))
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
-	// Optionally, send notification
-	if follower != followee {
-		sendAutoNotification(followee, "New follower!", follower+" started following you.")
+	data, err := blobStore.Get(attachmentKey(attachment.AttachmentId))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Followed successfully"})
+	c.Data(http.StatusOK, attachment.ContentType, data)
 }
 
-// UnfollowMember godoc
+// DeleteAttachment godoc
 //
-// @Summary 		Unfollow a member
-// @Description 	Allows the logged-in user to unfollow another member by username.
-// @Tags 			member
-// @Accept 			json
+// @Summary 		Deletes an attachment
+// @Description 	Only the member who uploaded a file can delete it, and only once no post refers to it any more. The space it took up is freed from their quota.
+// @Tags 			attachment
 // @Produce 		json
-// @Param 			username path string true "Username of the member to unfollow"
-// @Success 		200 {object} string "Unfollowed successfully"
-// @Failure 		400 {object} string "Cannot unfollow yourself or bad request"
+// @Param 			attachmentId path string true "Attachment ID"
+// @Success 		200 {object} string
 // @Failure 		401 {object} string "Unauthorized"
-// @Failure 		404 {object} string "User not found"
-// @Failure 		500 {object} string "Failed to unfollow"
-// @Router 			/member/{username}/follow [delete]
-func unfollowMember(c *gin.Context) {
+// @Failure 		403 {object} string "Forbidden"
+// @Failure 		404 {object} string "Attachment not found"
+// @Failure 		409 {object} string "Attachment is in use"
+// @Router 			/attachment/{attachmentId} [delete]
+func deleteAttachment(c *gin.Context) {
 	if err := Authorize(c); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	follower := getUsername(c)
-	followee := c.Param("username")
-	if follower == followee {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot unfollow yourself"})
-		return
-	}
 
-	var followerMember, followeeMember models.Member
-	if db.First(&followerMember, "username = ?", follower).Error != nil ||
-		db.First(&followeeMember, "username = ?", followee).Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	var attachment models.Attachment
+	if err := db.First(&attachment, "attachment_id = ?", c.Param("attachmentId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
 		return
 	}
-
-	// Remove follow relationship
-	if err := db.Model(&followerMember).Association("Following").Delete(&followeeMember); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unfollow"})
+	if attachment.Uploader != getUsername(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the uploader can delete an attachment"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Unfollowed successfully"})
-}
-
-// GetFollowers godoc
-//
-// @Summary 		Get a member's followers
-// @Description 	Retrieves a list of members who follow the specified user.
-// @Tags 			member
-// @Accept 			json
-// @Produce 		json
-// @Param 			username path string true "Username of the member"
-// @Success 		200 {object} map[string]interface{} "List of followers"
-// @Failure 		404 {object} string "User not found"
-// @Router 			/member/{username}/followers [get]
-func getFollowers(c *gin.Context) {
-	username := c.Param("username")
-	var member models.Member
-	if db.Preload("Followers").First(&member, "username = ?", username).Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	// Deleted posts count too, as they can still be restored
+	var inUse int64
+	db.Unscoped().Model(&models.Post{}).Where("CAST(attachments AS TEXT) LIKE ?", `%"`+attachment.AttachmentId+`"%`).Count(&inUse)
+	if inUse > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The attachment is still used by a post"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": member.Followers})
-}
 
-// GetFollowing godoc
-//
-// @Summary 		Get members a user is following
-// @Description 	Retrieves a list of members that the specified user is following.
-// @Tags 			member
-// @Accept 			json
-// @Produce 		json
-// @Param 			username path string true "Username of the member"
-// @Success 		200 {object} map[string]interface{} "List of following"
-// @Failure 		404 {object} string "User not found"
-// @Router 			/member/{username}/following [get]
-func getFollowing(c *gin.Context) {
-	username := c.Param("username")
-	var member models.Member
-	if db.Preload("Following").First(&member, "username = ?", username).Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	if err := db.Delete(&attachment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": member.Following})
+	blobStore.Delete(attachmentKey(attachment.AttachmentId))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
 }
@@ -2,18 +2,33 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 
 	"gshare.com/platform/models"
+	"gshare.com/platform/storage"
 )
 
 var testSessionToken string
@@ -58,21 +73,51 @@ func SetUpRouter() *gin.Engine {
 
 		v1.GET("current-user", getCurrentUser)
 		v1.GET("member/:username/liked-posts", getUserLikedPosts)
+		v1.GET("member/:username/disliked-posts", getUserDislikedPosts)
+		v1.GET("member/:username/liked-comments", getUserLikedComments)
+		v1.GET("member/:username/disliked-comments", getUserDislikedComments)
 
 		v1.POST("member/:username/follow", followMember)
 		v1.DELETE("member/:username/follow", unfollowMember)
 		v1.GET("member/:username/followers", getFollowers)
 		v1.GET("member/:username/following", getFollowing)
+		v1.GET("feed", getFeed)
 
 		// post routes
 		v1.GET("post", getPosts)
+		v1.GET("post/drafts", getDrafts)
 		v1.GET("post/:postId", getPostById)
 		v1.POST("post", createPost)
 		v1.DELETE("post/:postId", deletePost)
 		v1.PUT("post/:postId", updatePost)
 		v1.GET("member/:username/posts", getUserPosts)
 		v1.PUT("post/:postId/increment-views", incrementPostViews)
+		v1.GET("post/:postId/views", getPostViews)
 		v1.PUT("post/:postId/like-dislike", likeOrDislikePost)
+		v1.GET("post/:postId/revisions", getPostRevisions)
+		v1.GET("post/:postId/revisions/diff", getPostRevisionDiff)
+		v1.PUT("post/:postId/revisions/:revision/restore", restorePostRevision)
+		v1.POST("post/:postId/poll/vote", votePoll)
+		v1.PUT("post/:postId/pin", pinPost)
+		v1.DELETE("post/:postId/pin", unpinPost)
+		v1.PUT("post/:postId/answer", acceptAnswer)
+		v1.DELETE("post/:postId/answer", unacceptAnswer)
+		v1.PUT("post/:postId/restore", restoreDeletedPost)
+		v1.POST("post/:postId/repost", repostPost)
+		v1.DELETE("post/:postId/repost", undoRepost)
+
+		// assignment routes
+		v1.POST("post/:postId/volunteer", volunteerForPost)
+		v1.DELETE("post/:postId/volunteer", withdrawFromPost)
+		v1.PUT("post/:postId/helpers/:username", acceptHelper)
+		v1.DELETE("post/:postId/helpers/:username", removeHelper)
+		v1.GET("member/:username/assignments", getMemberAssignments)
+		v1.PUT("post/:postId/resolve", resolvePost)
+
+		// rating routes
+		v1.POST("post/:postId/ratings", ratePostParticipant)
+		v1.GET("post/:postId/ratings", getPostRatings)
+		v1.GET("member/:username/ratings", getMemberRatings)
 
 		// comment routes
 		v1.GET("comment/:postId/", getComments)
@@ -81,6 +126,38 @@ func SetUpRouter() *gin.Engine {
 		v1.PUT("comment/:postId/:commentId", updateComment)
 		v1.DELETE("comment/:postId/:commentId", deleteComment)
 		v1.PUT("comment/:postId/:commentId/like-dislike", likeOrDislikeComment)
+		v1.PUT("comment/:postId/:commentId/restore", restoreDeletedComment)
+		v1.GET("comment/:postId/:commentId/revisions", getCommentRevisions)
+		v1.POST("comment/:postId/:commentId/report", reportComment)
+		v1.GET("comment/:postId/:commentId/reports", getCommentReports)
+
+		// bookmark routes
+		v1.POST("post/:postId/bookmark", bookmarkPost)
+		v1.DELETE("post/:postId/bookmark", unbookmarkPost)
+		v1.POST("comment/:postId/:commentId/bookmark", bookmarkComment)
+		v1.DELETE("comment/:postId/:commentId/bookmark", unbookmarkComment)
+		v1.GET("bookmark", getBookmarks)
+		v1.PUT("bookmark/:bookmarkId", moveBookmark)
+		v1.DELETE("bookmark/:bookmarkId", deleteBookmark)
+		v1.GET("collection", getCollections)
+		v1.POST("collection", createCollection)
+		v1.PUT("collection/:collectionId", renameCollection)
+		v1.DELETE("collection/:collectionId", deleteCollection)
+		v1.PUT("collection/:collectionId/order", reorderCollectionBookmarks)
+
+		// building routes
+		v1.GET("building", getBuildings)
+
+		// image routes
+		v1.POST("image", uploadImages)
+		v1.GET("image/:imageId", getImage)
+		v1.PUT("image/:imageId", updateImage)
+
+		// attachment routes
+		v1.POST("attachment", uploadAttachments)
+		v1.GET("attachment", getAttachments)
+		v1.GET("attachment/:attachmentId", getAttachment)
+		v1.DELETE("attachment/:attachmentId", deleteAttachment)
 
 		// notification routes
 		v1.GET("notification", getNotifications)
@@ -1173,3 +1250,2102 @@ func TestFollowUnfollowSystem(t *testing.T) {
 	//Deleting 'saul' user created for testing rest of the APIs
 	TestDeleteMember(t)
 }
+
+// Registers a throwaway member and returns its session and CSRF tokens
+func registerTestMember(t *testing.T, r *gin.Engine, username string) (string, string) {
+	// Clear out whatever an interrupted earlier run left behind
+	deleteTestMembers(username)
+
+	member := models.Member{
+		Email:    username + "@test.com",
+		Username: username,
+		Password: "Password123",
+	}
+	jsonValue, _ := json.Marshal(member)
+	req, _ := http.NewRequest("POST", "/api/v1/register", bytes.NewBuffer(jsonValue))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var sessionToken, csrfToken string
+	for _, cookie := range w.Result().Cookies() {
+		value, _ := url.QueryUnescape(cookie.Value)
+		switch cookie.Name {
+		case "session_token":
+			sessionToken = value
+		case "csrf_token":
+			csrfToken = value
+		}
+	}
+	return sessionToken, csrfToken
+}
+
+// Sends a request as the member owning the given tokens
+func serveAs(r *gin.Engine, method, path string, body interface{}, sessionToken, csrfToken string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		jsonValue, _ := json.Marshal(body)
+		reader = bytes.NewBuffer(jsonValue)
+	}
+	req, _ := http.NewRequest(method, path, reader)
+	if sessionToken != "" {
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+		req.Header.Add("X-CSRF-Token", csrfToken)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// Decodes a JSON response body
+func decodeResponse(w *httptest.ResponseRecorder) map[string]interface{} {
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response
+}
+
+// Removes members created by registerTestMember together with everything
+// they posted, uploaded, rated or were notified about, so that tests can run
+// again against the same database
+func deleteTestMembers(usernames ...string) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var postIds []string
+		if err := tx.Unscoped().Model(&models.Post{}).Where("author IN ?", usernames).Pluck("post_id", &postIds).Error; err != nil {
+			return err
+		}
+		for _, postId := range postIds {
+			if err := deleteBookmarksOfPost(tx, postId); err != nil {
+				return err
+			}
+			if err := deletePinsOfPost(tx, postId); err != nil {
+				return err
+			}
+			if err := deleteRepostsOfPost(tx, postId); err != nil {
+				return err
+			}
+		}
+		if len(postIds) > 0 {
+			if err := deleteMentions(tx, models.MentionInPost, postIds); err != nil {
+				return err
+			}
+		}
+
+		var commentIds []string
+		if err := tx.Unscoped().Model(&models.Comment{}).Where("author IN ? OR post_id IN ?", usernames, postIds).Pluck("comment_id", &commentIds).Error; err != nil {
+			return err
+		}
+		if len(commentIds) > 0 {
+			if err := tx.Where("target_type = ? AND target_id IN ?", models.BookmarkTargetComment, commentIds).Delete(&models.Bookmark{}).Error; err != nil {
+				return err
+			}
+			if err := deleteMentions(tx, models.MentionInComment, commentIds); err != nil {
+				return err
+			}
+			if err := purgeComments(tx, commentIds); err != nil {
+				return err
+			}
+		}
+		if len(postIds) > 0 {
+			if err := purgePosts(tx, postIds); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("rater IN ? OR ratee IN ? OR post_id IN ?", usernames, usernames, postIds).Delete(&models.Rating{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("uploader IN ?", usernames).Delete(&models.Image{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("uploader IN ?", usernames).Delete(&models.ImageDescription{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("uploader IN ?", usernames).Delete(&models.Attachment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("username IN ?", usernames).Delete(&models.Notification{}).Error; err != nil {
+			return err
+		}
+
+		var members []models.Member
+		if err := tx.Where("username IN ?", usernames).Find(&members).Error; err != nil {
+			return err
+		}
+		for _, member := range members {
+			if err := removeMember(tx, member); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	checkErr(err)
+}
+
+func TestAssignments(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	authorSession, authorCSRF := registerTestMember(t, r, "walter")
+	helperSession, helperCSRF := registerTestMember(t, r, "jesse")
+	defer deleteTestMembers("walter", "jesse")
+
+	// 'walter' creates a help request
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Need a lab partner", Content: "Chemistry lab on Friday"}, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	postID := createResponse["data"].(map[string]interface{})["post_id"].(string)
+
+	// The author cannot volunteer on their own post
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/volunteer", nil, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 'jesse' volunteers, but only once
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/volunteer", nil, helperSession, helperCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Volunteered successfully")
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/volunteer", nil, helperSession, helperCSRF)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Only the author can accept helpers
+	w = serveAs(r, "PUT", "/api/v1/post/"+postID+"/helpers/jesse", nil, helperSession, helperCSRF)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveAs(r, "PUT", "/api/v1/post/"+postID+"/helpers/jesse", nil, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "accepted")
+
+	// The post shows its helper and 'jesse' sees the assignment
+	w = serveAs(r, "GET", "/api/v1/post/"+postID, nil, "", "")
+	assert.Contains(t, w.Body.String(), `"helper":"jesse"`)
+	w = serveAs(r, "GET", "/api/v1/member/jesse/assignments", nil, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), postID)
+
+	// Both sides were notified
+	w = serveAs(r, "GET", "/api/v1/notification", nil, authorSession, authorCSRF)
+	assert.Contains(t, w.Body.String(), "jesse volunteered to help")
+	w = serveAs(r, "GET", "/api/v1/notification", nil, helperSession, helperCSRF)
+	assert.Contains(t, w.Body.String(), "walter accepted your offer")
+
+	// 'jesse' withdraws
+	w = serveAs(r, "DELETE", "/api/v1/post/"+postID+"/volunteer", nil, helperSession, helperCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/member/jesse/assignments", nil, "", "")
+	assert.NotContains(t, w.Body.String(), postID)
+
+	w = serveAs(r, "DELETE", "/api/v1/post/"+postID, nil, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRatings(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	authorSession, authorCSRF := registerTestMember(t, r, "skyler")
+	helperSession, helperCSRF := registerTestMember(t, r, "hank")
+	outsiderSession, outsiderCSRF := registerTestMember(t, r, "marie")
+	defer deleteTestMembers("skyler", "hank", "marie")
+
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Need help moving", Content: "Couch to the third floor"}, authorSession, authorCSRF)
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	postID := createResponse["data"].(map[string]interface{})["post_id"].(string)
+
+	serveAs(r, "POST", "/api/v1/post/"+postID+"/volunteer", nil, helperSession, helperCSRF)
+	serveAs(r, "PUT", "/api/v1/post/"+postID+"/helpers/hank", nil, authorSession, authorCSRF)
+
+	// Ratings are only accepted once the post is resolved
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/ratings", map[string]interface{}{"ratee": "hank", "score": 5}, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveAs(r, "PUT", "/api/v1/post/"+postID+"/resolve", nil, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"resolved"`)
+
+	// Helpers stay on a resolved post, so neither side can dodge a rating
+	w = serveAs(r, "DELETE", "/api/v1/post/"+postID+"/helpers/hank", nil, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "DELETE", "/api/v1/post/"+postID+"/volunteer", nil, helperSession, helperCSRF)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Scores are limited to 1-5 and outsiders cannot rate
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/ratings", map[string]interface{}{"ratee": "hank", "score": 6}, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/ratings", map[string]interface{}{"ratee": "skyler", "score": 1}, outsiderSession, outsiderCSRF)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// The author rates the helper exactly once
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/ratings", map[string]interface{}{"ratee": "hank", "score": 4, "review": "Strong and punctual"}, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/ratings", map[string]interface{}{"ratee": "hank", "score": 1}, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// The review stays hidden until the helper rates back
+	w = serveAs(r, "GET", "/api/v1/member/hank/ratings", nil, "", "")
+	assert.NotContains(t, w.Body.String(), "Strong and punctual")
+
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/ratings", map[string]interface{}{"ratee": "skyler", "score": 5, "review": "Great snacks"}, helperSession, helperCSRF)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = serveAs(r, "GET", "/api/v1/member/hank/ratings", nil, "", "")
+	assert.Contains(t, w.Body.String(), "Strong and punctual")
+
+	// The profile carries the aggregate
+	w = serveAs(r, "GET", "/api/v1/member/hank", nil, "", "")
+	assert.Contains(t, w.Body.String(), `"rating_average":4`)
+	assert.Contains(t, w.Body.String(), `"rating_count":1`)
+}
+
+func TestDraftsAndScheduledPosts(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	authorSession, authorCSRF := registerTestMember(t, r, "mike")
+	readerSession, readerCSRF := registerTestMember(t, r, "lydia")
+	defer deleteTestMembers("mike", "lydia")
+
+	// Save a draft
+	w := serveAs(r, "POST", "/api/v1/post", map[string]interface{}{"title": "Unfinished draft", "content": "Work in progress", "draft": true}, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Draft saved successfully")
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	draftID := createResponse["data"].(map[string]interface{})["post_id"].(string)
+
+	// Drafts stay out of listings, search and other members' reach
+	w = serveAs(r, "GET", "/api/v1/post?search_key=Unfinished", nil, "", "")
+	assert.NotContains(t, w.Body.String(), draftID)
+	w = serveAs(r, "GET", "/api/v1/member/mike/posts", nil, "", "")
+	assert.NotContains(t, w.Body.String(), draftID)
+	w = serveAs(r, "GET", "/api/v1/post/"+draftID, nil, readerSession, readerCSRF)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "PUT", "/api/v1/post/"+draftID+"/like-dislike", map[string]string{"action": "like"}, readerSession, readerCSRF)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// The author sees it
+	w = serveAs(r, "GET", "/api/v1/post/"+draftID, nil, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/post/drafts", nil, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), draftID)
+
+	// Publishing it through updatePost makes it public
+	w = serveAs(r, "PUT", "/api/v1/post/"+draftID, map[string]interface{}{"content": "Finished", "draft": false}, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/post?search_key=Unfinished", nil, "", "")
+	assert.Contains(t, w.Body.String(), draftID)
+
+	// A published post cannot go back to being a draft
+	w = serveAs(r, "PUT", "/api/v1/post/"+draftID, map[string]interface{}{"draft": true}, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Schedule a post and let the scheduler publish it once it is due
+	publishAt := time.Now().Add(time.Hour)
+	w = serveAs(r, "POST", "/api/v1/post", map[string]interface{}{"title": "Scheduled post", "content": "Goes live later", "publish_at": publishAt}, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	scheduledID := createResponse["data"].(map[string]interface{})["post_id"].(string)
+
+	publishScheduledPosts(time.Now())
+	w = serveAs(r, "GET", "/api/v1/member/mike/posts", nil, "", "")
+	assert.NotContains(t, w.Body.String(), scheduledID)
+
+	publishScheduledPosts(publishAt.Add(time.Minute))
+	w = serveAs(r, "GET", "/api/v1/member/mike/posts", nil, "", "")
+	assert.Contains(t, w.Body.String(), scheduledID)
+	w = serveAs(r, "GET", "/api/v1/notification", nil, authorSession, authorCSRF)
+	assert.Contains(t, w.Body.String(), "Your scheduled post was published!")
+}
+
+func TestPostRevisions(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	authorSession, authorCSRF := registerTestMember(t, r, "tuco")
+	modSession, modCSRF := registerTestMember(t, r, "hector")
+	otherSession, otherCSRF := registerTestMember(t, r, "salamanca")
+	defer deleteTestMembers("tuco", "hector", "salamanca")
+	db.Model(&models.Member{}).Where("username = ?", "hector").Update("moderator", true)
+
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Selling a bike", Content: "Blue bike\nGood condition"}, authorSession, authorCSRF)
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	postID := createResponse["data"].(map[string]interface{})["post_id"].(string)
+	assert.Equal(t, false, createResponse["data"].(map[string]interface{})["edited"])
+
+	// Editing the post records a revision and marks it edited
+	w = serveAs(r, "PUT", "/api/v1/post/"+postID, map[string]interface{}{"content": "Blue bike\nFair condition"}, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/post/"+postID, nil, "", "")
+	assert.Contains(t, w.Body.String(), `"edited":true`)
+	assert.Contains(t, w.Body.String(), `"title":"Selling a bike"`)
+
+	w = serveAs(r, "GET", "/api/v1/post/"+postID+"/revisions", nil, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var revisionsResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &revisionsResponse)
+	assert.Equal(t, 2, len(revisionsResponse["data"].([]interface{})))
+
+	// The diff shows the changed line
+	w = serveAs(r, "GET", "/api/v1/post/"+postID+"/revisions/diff", nil, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `{"op":"delete","lines":["Good condition"]}`)
+	assert.Contains(t, w.Body.String(), `{"op":"insert","lines":["Fair condition"]}`)
+
+	// Other members cannot restore, moderators can
+	w = serveAs(r, "PUT", "/api/v1/post/"+postID+"/revisions/1/restore", nil, otherSession, otherCSRF)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveAs(r, "PUT", "/api/v1/post/"+postID+"/revisions/1/restore", nil, modSession, modCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Good condition")
+
+	w = serveAs(r, "GET", "/api/v1/post/"+postID+"/revisions", nil, "", "")
+	json.Unmarshal(w.Body.Bytes(), &revisionsResponse)
+	revisions := revisionsResponse["data"].([]interface{})
+	assert.Equal(t, 3, len(revisions))
+	assert.Equal(t, "hector", revisions[2].(map[string]interface{})["editor"])
+
+	// Naming another post in the body only ever edits the member's own post
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Selling a helmet", Content: "Barely used"}, otherSession, otherCSRF)
+	otherPostID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+	w = serveAs(r, "PUT", "/api/v1/post/"+otherPostID, map[string]interface{}{"post_id": postID, "author": "tuco", "title": "Bike stolen"}, otherSession, otherCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/post/"+postID+"/revisions", nil, "", "")
+	assert.Equal(t, 3, len(decodeResponse(w)["data"].([]interface{})))
+	w = serveAs(r, "GET", "/api/v1/post/"+otherPostID, nil, "", "")
+	edited := decodeResponse(w)["data"].(map[string]interface{})
+	assert.Equal(t, "Bike stolen", edited["title"])
+	assert.Equal(t, "salamanca", edited["author"])
+
+	// Revisions too long to diff are refused
+	w = serveAs(r, "PUT", "/api/v1/post/"+postID, map[string]interface{}{"content": strings.Repeat("line\n", maxDiffLines)}, authorSession, authorCSRF)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/post/"+postID+"/revisions/diff", nil, "", "")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestMarkdownContent(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	session, csrf := registerTestMember(t, r, "gale")
+	defer deleteTestMembers("gale")
+
+	content := "**Lab notes** <script>alert(1)</script>\n\n[notes](javascript:alert(1)) [syllabus](https://ufl.edu)"
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Markdown post", Content: content}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	postID := createResponse["data"].(map[string]interface{})["post_id"].(string)
+
+	// The raw source comes back untouched alongside the sanitized HTML
+	w = serveAs(r, "GET", "/api/v1/post/"+postID, nil, "", "")
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	post := response["data"].(map[string]interface{})
+	assert.Equal(t, content, post["content"])
+	html := post["content_html"].(string)
+	assert.Contains(t, html, "<strong>Lab notes</strong>")
+	assert.Contains(t, html, "&lt;script&gt;")
+	assert.NotContains(t, html, "<script>")
+	assert.NotContains(t, html, "javascript:")
+	assert.Contains(t, html, `<a href="https://ufl.edu" rel="nofollow noopener noreferrer">syllabus</a>`)
+
+	// Comments are rendered the same way
+	w = serveAs(r, "POST", "/api/v1/comment/"+postID, models.Comment{Content: "<img src=x onerror=alert(1)> *thanks*"}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	html = response["data"].(map[string]interface{})["content_html"].(string)
+	assert.Contains(t, html, "<em>thanks</em>")
+	assert.NotContains(t, html, "<img")
+
+	// Unmatched brackets and emphasis are shown as text
+	w = serveAs(r, "POST", "/api/v1/comment/"+postID, models.Comment{Content: strings.Repeat("[ _a *b ~~c ", 800)}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	html = response["data"].(map[string]interface{})["content_html"].(string)
+	assert.NotContains(t, html, "<a")
+	assert.NotContains(t, html, "<em>")
+	assert.NotContains(t, html, "<del>")
+
+	// Content has a size limit
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Long post", Content: strings.Repeat("a", maxPostContentLength+1)}, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "POST", "/api/v1/comment/"+postID, models.Comment{Content: strings.Repeat("a", maxCommentContentLength+1)}, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// Encodes a small solid PNG as a data URL
+func testImageDataURL(c color.Color) string {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestImageUploads(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+	defer func(previous storage.BlobStore) { blobStore = previous }(blobStore)
+	blobStore = storage.NewLocalStore(t.TempDir())
+
+	session, csrf := registerTestMember(t, r, "todd")
+	defer deleteTestMembers("todd")
+
+	// Upload the same image twice and get the same ID back
+	dataURL := testImageDataURL(color.RGBA{255, 0, 0, 255})
+	w := serveAs(r, "POST", "/api/v1/image", map[string]interface{}{"images": []string{dataURL, dataURL}}, session, csrf)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var uploadResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &uploadResponse)
+	uploaded := uploadResponse["data"].([]interface{})
+	imageID := uploaded[0].(map[string]interface{})["image_id"].(string)
+	assert.Equal(t, imageID, uploaded[1].(map[string]interface{})["image_id"])
+
+	// Non-images are rejected
+	textURL := "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("not an image"))
+	w = serveAs(r, "POST", "/api/v1/image", map[string]interface{}{"images": []string{textURL}}, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Images are served with cache headers
+	w = serveAs(r, "GET", "/api/v1/image/"+imageID, nil, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Cache-Control"), "immutable")
+	req, _ := http.NewRequest("GET", "/api/v1/image/"+imageID, nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// Posts reference image IDs, and inline data URLs are stored on the way in
+	otherURL := testImageDataURL(color.RGBA{0, 0, 255, 255})
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Found a cat", Content: "See pictures", Images: models.StringArray{imageID, otherURL}}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "data:image")
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	images := createResponse["data"].(map[string]interface{})["images"].([]interface{})
+	assert.Equal(t, 2, len(images))
+	assert.Equal(t, imageID, images[0])
+
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Broken", Content: "Unknown image", Images: models.StringArray{"does-not-exist"}}, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Uploading again puts back blobs the store has lost
+	blobStore = storage.NewLocalStore(t.TempDir())
+	w = serveAs(r, "GET", "/api/v1/image/"+imageID, nil, "", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serveAs(r, "POST", "/api/v1/image", map[string]interface{}{"images": []string{dataURL}}, session, csrf)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = serveAs(r, "GET", "/api/v1/image/"+imageID+"?size=thumb", nil, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// There is a limit on how many images one request can upload
+	tooMany := make([]string, maxImagesPerUpload+1)
+	for i := range tooMany {
+		tooMany[i] = dataURL
+	}
+	w = serveAs(r, "POST", "/api/v1/image", map[string]interface{}{"images": tooMany}, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestS3ImageStore(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	// A local stand-in for an S3-compatible service
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	fakeS3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.Method {
+		case http.MethodPut:
+			objects[req.URL.Path], _ = io.ReadAll(req.Body)
+		case http.MethodGet, http.MethodHead:
+			data, ok := objects[req.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		case http.MethodDelete:
+			delete(objects, req.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer fakeS3.Close()
+	defer func(previous storage.BlobStore) { blobStore = previous }(blobStore)
+	blobStore = storage.NewS3Store(fakeS3.URL, "gatorshare", "us-east-1", "test-key", "test-secret")
+
+	session, csrf := registerTestMember(t, r, "badger")
+	defer deleteTestMembers("badger")
+
+	w := serveAs(r, "POST", "/api/v1/image", map[string]interface{}{"images": []string{testImageDataURL(color.RGBA{0, 255, 0, 255})}}, session, csrf)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var uploadResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &uploadResponse)
+	imageID := uploadResponse["data"].([]interface{})[0].(map[string]interface{})["image_id"].(string)
+	assert.Contains(t, objects, "/gatorshare/images/original/"+imageID)
+
+	w = serveAs(r, "GET", "/api/v1/image/"+imageID, nil, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, objects["/gatorshare/images/original/"+imageID], w.Body.Bytes())
+}
+
+// Encodes a JPEG with an EXIF segment carrying an orientation and GPS tags
+func testJPEGWithExif(width, height, orientation int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, nil)
+	data := buf.Bytes()
+
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0, 0, 0, 0, 0}
+	tiff = append(tiff, []byte("GPSLatitude 29.6436")...)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := append([]byte{0xFF, 0xE1, byte((len(segment) + 2) >> 8), byte(len(segment) + 2)}, segment...)
+	return append(append([]byte{0xFF, 0xD8}, app1...), data[2:]...)
+}
+
+func TestImageVariants(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+	defer func(previous storage.BlobStore) { blobStore = previous }(blobStore)
+	blobStore = storage.NewLocalStore(t.TempDir())
+
+	session, csrf := registerTestMember(t, r, "tulip")
+	otherSession, otherCsrf := registerTestMember(t, r, "iris")
+	defer deleteTestMembers("tulip", "iris")
+
+	// A rotated photo is stored upright with its metadata stripped
+	photo := "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(testJPEGWithExif(600, 300, 6))
+	w := serveAs(r, "POST", "/api/v1/image", map[string]interface{}{
+		"images":    []string{photo},
+		"alt_texts": []string{"Library entrance at night"},
+	}, session, csrf)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var uploadResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &uploadResponse)
+	uploaded := uploadResponse["data"].([]interface{})[0].(map[string]interface{})
+	imageID := uploaded["image_id"].(string)
+	assert.Equal(t, float64(300), uploaded["width"])
+	assert.Equal(t, float64(600), uploaded["height"])
+	assert.Equal(t, "Library entrance at night", uploaded["alt_text"])
+
+	w = serveAs(r, "GET", "/api/v1/image/"+imageID, nil, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "Exif")
+	assert.NotContains(t, w.Body.String(), "GPSLatitude")
+
+	// Variants fit within their size and are cached separately
+	w = serveAs(r, "GET", "/api/v1/image/"+imageID+"?size=thumb", nil, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+	thumbETag := w.Header().Get("ETag")
+	config, _, err := image.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, 100, config.Width)
+	assert.Equal(t, 200, config.Height)
+
+	w = serveAs(r, "GET", "/api/v1/image/"+imageID+"?size=medium", nil, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, thumbETag, w.Header().Get("ETag"))
+	config, _, _ = image.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+	assert.Equal(t, 600, config.Height)
+
+	w = serveAs(r, "GET", "/api/v1/image/"+imageID+"?size=huge", nil, "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Animations are limited by the pixels of all their frames together
+	frame := image.NewPaletted(image.Rect(0, 0, 2000, 2000), color.Palette{color.Black, color.White})
+	animation := &gif.GIF{}
+	for i := 0; i < 11; i++ {
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 10)
+	}
+	var animationData bytes.Buffer
+	gif.EncodeAll(&animationData, animation)
+	w = serveAs(r, "POST", "/api/v1/image", map[string]interface{}{
+		"images": []string{"data:image/gif;base64," + base64.StdEncoding.EncodeToString(animationData.Bytes())},
+	}, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), errImageDimensions.Error())
+
+	// Only the uploader can describe the image
+	w = serveAs(r, "PUT", "/api/v1/image/"+imageID, map[string]string{"caption": "Taken from Turlington"}, otherSession, otherCsrf)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveAs(r, "PUT", "/api/v1/image/"+imageID, map[string]string{"alt_text": strings.Repeat("a", 300)}, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "PUT", "/api/v1/image/"+imageID, map[string]string{"caption": "Taken from Turlington"}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Listings include the alt text and caption of each image
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Study spots", Content: "Open late", Images: models.StringArray{imageID}}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/member/tulip/posts", nil, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var listResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &listResponse)
+	details := listResponse["data"].([]interface{})[0].(map[string]interface{})["image_details"].([]interface{})
+	assert.Equal(t, 1, len(details))
+	assert.Equal(t, "Library entrance at night", details[0].(map[string]interface{})["alt_text"])
+	assert.Equal(t, "Taken from Turlington", details[0].(map[string]interface{})["caption"])
+
+	// Uploading the same file again shares the image but not its description
+	w = serveAs(r, "POST", "/api/v1/image", map[string]interface{}{
+		"images":    []string{photo},
+		"alt_texts": []string{"Dark doorway"},
+	}, otherSession, otherCsrf)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	reuploaded := decodeResponse(w)["data"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, imageID, reuploaded["image_id"])
+	assert.Equal(t, "Dark doorway", reuploaded["alt_text"])
+	assert.Equal(t, "", reuploaded["caption"])
+	w = serveAs(r, "PUT", "/api/v1/image/"+imageID, map[string]string{"caption": "Seen from the lawn"}, otherSession, otherCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Night walk", Content: "Campus after dark", Images: models.StringArray{imageID}}, otherSession, otherCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	listedDetails := func(member string) map[string]interface{} {
+		w := serveAs(r, "GET", "/api/v1/member/"+member+"/posts", nil, "", "")
+		post := decodeResponse(w)["data"].([]interface{})[0].(map[string]interface{})
+		return post["image_details"].([]interface{})[0].(map[string]interface{})
+	}
+	assert.Equal(t, "Dark doorway", listedDetails("iris")["alt_text"])
+	assert.Equal(t, "Seen from the lawn", listedDetails("iris")["caption"])
+	assert.Equal(t, "Library entrance at night", listedDetails("tulip")["alt_text"])
+	assert.Equal(t, "Taken from Turlington", listedDetails("tulip")["caption"])
+}
+
+func TestPostViews(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	session, csrf := registerTestMember(t, r, "heron")
+	otherSession, otherCsrf := registerTestMember(t, r, "egret")
+	defer deleteTestMembers("heron", "egret")
+
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Lost umbrella", Content: "Left it in Marston"}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	postID := createResponse["data"].(map[string]interface{})["post_id"].(string)
+
+	view := func(session, csrf, userAgent string) map[string]interface{} {
+		req, _ := http.NewRequest("PUT", "/api/v1/post/"+postID+"/increment-views", nil)
+		req.Header.Set("User-Agent", userAgent)
+		if session != "" {
+			req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+			req.Header.Set("X-CSRF-Token", csrf)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response
+	}
+
+	// Refreshing does not count again, for members and anonymous clients alike
+	assert.Equal(t, true, view(otherSession, otherCsrf, "phone")["counted"])
+	assert.Equal(t, false, view(otherSession, otherCsrf, "laptop")["counted"])
+	assert.Equal(t, true, view("", "", "phone")["counted"])
+	assert.Equal(t, false, view("", "", "phone")["counted"])
+	response := view("", "", "laptop")
+	assert.Equal(t, true, response["counted"])
+	assert.Equal(t, float64(3), response["views"])
+
+	// Concurrent views from different viewers are all counted
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := recordPostView(postID, "viewer-"+string(rune('a'+i)), time.Now())
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	// The viewer counts again once the window has passed
+	counted, err := recordPostView(postID, "egret", time.Now().Add(viewDedupWindow+time.Minute))
+	assert.Nil(t, err)
+	assert.True(t, counted)
+
+	// Only the author sees the history
+	w = serveAs(r, "GET", "/api/v1/post/"+postID+"/views", nil, otherSession, otherCsrf)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveAs(r, "GET", "/api/v1/post/"+postID+"/views?days=400", nil, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "GET", "/api/v1/post/"+postID+"/views?days=7", nil, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var historyResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &historyResponse)
+	assert.Equal(t, float64(14), historyResponse["total"])
+	history := historyResponse["data"].([]interface{})
+	assert.Equal(t, 7, len(history))
+	today := history[6].(map[string]interface{})
+	assert.Equal(t, time.Now().UTC().Format("2006-01-02"), today["day"])
+	assert.Equal(t, float64(13), today["views"])
+
+	// Pruning forgets stale dedup records but keeps the history
+	assert.Nil(t, pruneViewRecords(time.Now().Add(3*viewDedupWindow)))
+	var remaining int64
+	db.Model(&models.PostView{}).Where("post_id = ?", postID).Count(&remaining)
+	assert.Equal(t, int64(0), remaining)
+	days, err := postViewHistory(postID, 1, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 13, days[0].Views)
+}
+
+func TestPostRankings(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	session, csrf := registerTestMember(t, r, "osprey")
+	likerSession, likerCsrf := registerTestMember(t, r, "kite")
+	defer deleteTestMembers("osprey", "kite")
+
+	createPost := func(title string) string {
+		w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: title, Content: "Ranking test"}, session, csrf)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response["data"].(map[string]interface{})["post_id"].(string)
+	}
+	listTitles := func(query string) []string {
+		w := serveAs(r, "GET", "/api/v1/post?search_key=Ranking+test&"+query, nil, "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		titles := []string{}
+		for _, post := range response["data"].([]interface{}) {
+			titles = append(titles, post.(map[string]interface{})["title"].(string))
+		}
+		return titles
+	}
+
+	// An old post with many likes, and two new posts
+	oldID := createPost("Old favourite")
+	db.Model(&models.Post{}).Where("post_id = ?", oldID).
+		UpdateColumns(map[string]any{"created_at": time.Now().Add(-10 * 24 * time.Hour), "likes": 100})
+	assert.Nil(t, refreshPostRanking(db, oldID, 0, time.Now()))
+	createPost("Quiet newcomer")
+	busyID := createPost("Busy newcomer")
+
+	w := serveAs(r, "PUT", "/api/v1/post/"+busyID+"/like-dislike", map[string]string{"action": "like"}, likerSession, likerCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "POST", "/api/v1/comment/"+busyID, models.Comment{Content: "Me too"}, likerSession, likerCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Hot favours new posts with activity over old ones with many likes
+	assert.Equal(t, []string{"Busy newcomer", "Quiet newcomer", "Old favourite"}, listTitles("column=hot"))
+
+	// Rising only looks at recent posts
+	assert.Equal(t, []string{"Busy newcomer", "Quiet newcomer"}, listTitles("column=rising"))
+
+	// Top ranks by likes within the period
+	assert.Equal(t, []string{"Old favourite", "Busy newcomer", "Quiet newcomer"}, listTitles("column=top&period=all"))
+	assert.Equal(t, []string{"Busy newcomer", "Quiet newcomer"}, listTitles("column=top&period=week"))
+
+	w = serveAs(r, "GET", "/api/v1/post?column=top&period=decade", nil, "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Scores are stored, not computed per request
+	var post models.Post
+	db.First(&post, "post_id = ?", busyID)
+	assert.Equal(t, hotScore(1, 0, 1, 0, post.CreatedAt), post.HotScore)
+	assert.NotZero(t, post.RisingScore)
+}
+
+func TestFeed(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	readerSession, readerCsrf := registerTestMember(t, r, "wren")
+	finchSession, finchCsrf := registerTestMember(t, r, "finch")
+	robinSession, robinCsrf := registerTestMember(t, r, "robin")
+	crowSession, crowCsrf := registerTestMember(t, r, "crow")
+	defer deleteTestMembers("wren", "finch", "robin", "crow")
+
+	for _, username := range []string{"finch", "robin"} {
+		w := serveAs(r, "POST", "/api/v1/member/"+username+"/follow", nil, readerSession, readerCsrf)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	post := func(session, csrf string, post models.Post) {
+		w := serveAs(r, "POST", "/api/v1/post", post, session, csrf)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	post(finchSession, finchCsrf, models.Post{Title: "Feed 1", Content: "Selling a desk"})
+	post(robinSession, robinCsrf, models.Post{Title: "Feed 2", Content: "Need a ride"})
+	post(crowSession, crowCsrf, models.Post{Title: "Not followed", Content: "Free couch"})
+	post(finchSession, finchCsrf, models.Post{Title: "Feed 3", Content: "Study group"})
+	post(robinSession, robinCsrf, models.Post{Title: "Feed 4", Content: "Lost keys"})
+	post(finchSession, finchCsrf, models.Post{Title: "Draft", Content: "Not yet", Draft: true})
+	post(robinSession, robinCsrf, models.Post{Title: "Feed 5", Content: "Found keys"})
+
+	// Page through the feed two posts at a time
+	var titles []string
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		w := serveAs(r, "GET", "/api/v1/feed?limit=2&cursor="+cursor, nil, readerSession, readerCsrf)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		for _, post := range response["data"].([]interface{}) {
+			titles = append(titles, post.(map[string]interface{})["title"].(string))
+		}
+		cursor = response["next_cursor"].(string)
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"Feed 5", "Feed 4", "Feed 3", "Feed 2", "Feed 1"}, titles)
+
+	w := serveAs(r, "GET", "/api/v1/feed?cursor=not-a-cursor", nil, readerSession, readerCsrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "GET", "/api/v1/feed", nil, "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestBookmarks(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	session, csrf := registerTestMember(t, r, "magpie")
+	authorSession, authorCsrf := registerTestMember(t, r, "jay")
+	defer deleteTestMembers("magpie", "jay")
+
+	createPost := func(title string) string {
+		w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: title, Content: "Bookmark test"}, authorSession, authorCsrf)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response["data"].(map[string]interface{})["post_id"].(string)
+	}
+	firstID := createPost("First saved")
+	secondID := createPost("Second saved")
+
+	w := serveAs(r, "POST", "/api/v1/comment/"+firstID, models.Comment{Content: "Useful tip"}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	commentID := decodeResponse(w)["data"].(map[string]interface{})["comment_id"].(string)
+
+	// Collections are named uniquely per member
+	w = serveAs(r, "POST", "/api/v1/collection", map[string]string{"name": "Housing"}, session, csrf)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	collectionID := decodeResponse(w)["data"].(map[string]interface{})["collection_id"].(string)
+	w = serveAs(r, "POST", "/api/v1/collection", map[string]string{"name": "Housing"}, session, csrf)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Bookmark two posts and a comment into the collection
+	var bookmarkIDs []string
+	for _, path := range []string{"post/" + firstID, "post/" + secondID, "comment/" + firstID + "/" + commentID} {
+		w = serveAs(r, "POST", "/api/v1/"+path+"/bookmark", map[string]string{"collection_id": collectionID}, session, csrf)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		bookmarkIDs = append(bookmarkIDs, decodeResponse(w)["data"].(map[string]interface{})["bookmark_id"].(string))
+	}
+	w = serveAs(r, "POST", "/api/v1/post/"+firstID+"/bookmark", nil, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, bookmarkIDs[0], decodeResponse(w)["data"].(map[string]interface{})["bookmark_id"])
+
+	// Post responses carry the flag for the current member only
+	w = serveAs(r, "GET", "/api/v1/post/"+firstID, nil, session, csrf)
+	post := decodeResponse(w)["data"].(map[string]interface{})
+	assert.Equal(t, true, post["bookmarked"])
+	assert.Equal(t, true, post["comments"].([]interface{})[0].(map[string]interface{})["bookmarked"])
+	w = serveAs(r, "GET", "/api/v1/post/"+firstID, nil, authorSession, authorCsrf)
+	assert.Equal(t, false, decodeResponse(w)["data"].(map[string]interface{})["bookmarked"])
+
+	// Reorder the collection and list it back in that order
+	order := []string{bookmarkIDs[2], bookmarkIDs[0], bookmarkIDs[1]}
+	w = serveAs(r, "PUT", "/api/v1/collection/"+collectionID+"/order", map[string]interface{}{"bookmark_ids": order[:2]}, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "PUT", "/api/v1/collection/"+collectionID+"/order", map[string]interface{}{"bookmark_ids": order}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serveAs(r, "GET", "/api/v1/bookmark?collection_id="+collectionID, nil, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	items := decodeResponse(w)["data"].([]interface{})
+	assert.Equal(t, 3, len(items))
+	assert.Equal(t, "Useful tip", items[0].(map[string]interface{})["comment"].(map[string]interface{})["content"])
+	assert.Equal(t, "First saved", items[1].(map[string]interface{})["post"].(map[string]interface{})["title"])
+
+	// Other members cannot see or change the collection
+	w = serveAs(r, "GET", "/api/v1/bookmark?collection_id="+collectionID, nil, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serveAs(r, "DELETE", "/api/v1/bookmark/"+bookmarkIDs[0], nil, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Remove an item, then delete the collection while keeping its bookmarks
+	w = serveAs(r, "DELETE", "/api/v1/bookmark/"+bookmarkIDs[2], nil, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/collection", nil, session, csrf)
+	assert.Equal(t, float64(2), decodeResponse(w)["data"].([]interface{})[0].(map[string]interface{})["item_count"])
+	w = serveAs(r, "DELETE", "/api/v1/collection/"+collectionID, nil, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/bookmark", nil, session, csrf)
+	items = decodeResponse(w)["data"].([]interface{})
+	assert.Equal(t, 2, len(items))
+	assert.Nil(t, items[0].(map[string]interface{})["collection_id"])
+
+	// Deleting a post removes its bookmarks
+	w = serveAs(r, "DELETE", "/api/v1/post/"+secondID, nil, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var remaining int64
+	db.Model(&models.Bookmark{}).Where("target_id = ?", secondID).Count(&remaining)
+	assert.Equal(t, int64(0), remaining)
+}
+
+func TestExpiringPosts(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	session, csrf := registerTestMember(t, r, "plover")
+	helperSession, helperCsrf := registerTestMember(t, r, "sandpiper")
+	defer deleteTestMembers("plover", "sandpiper")
+
+	past := time.Now().Add(-time.Hour)
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Too late", Content: "Expiry test", ExpiresAt: &past}, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Deadlines sent with a UTC offset behind the server's still count as future
+	deadline := time.Now().Add(time.Hour).In(time.FixedZone("HST", -10*60*60))
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Need a ride Friday", Content: "Expiry test", ExpiresAt: &deadline}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var createResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &createResponse)
+	postID := createResponse["data"].(map[string]interface{})["post_id"].(string)
+
+	countPosts := func(query string) float64 {
+		w := serveAs(r, "GET", "/api/v1/post?search_key=Expiry+test"+query, nil, "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response["count"].(float64)
+	}
+	assert.Equal(t, float64(1), countPosts(""))
+
+	// Once the deadline passes the post is hidden, even before the job runs
+	db.Model(&models.Post{}).Where("post_id = ?", postID).Update("expires_at", past)
+	assert.Equal(t, float64(0), countPosts(""))
+	assert.Equal(t, float64(1), countPosts("&include_expired=true"))
+
+	// The job closes it and lets the author know
+	assert.Nil(t, closeExpiredPosts(time.Now()))
+	var post models.Post
+	db.First(&post, "post_id = ?", postID)
+	assert.Equal(t, models.PostStatusExpired, post.Status)
+	var notifications int64
+	db.Model(&models.Notification{}).Where("username = ? AND title = ?", "plover", "Your post has expired").Count(&notifications)
+	assert.Equal(t, int64(1), notifications)
+
+	// Closing twice does not notify twice
+	assert.Nil(t, closeExpiredPosts(time.Now()))
+	db.Model(&models.Notification{}).Where("username = ? AND title = ?", "plover", "Your post has expired").Count(&notifications)
+	assert.Equal(t, int64(1), notifications)
+
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/volunteer", nil, helperSession, helperCsrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Moving the deadline reopens the post
+	later := time.Now().Add(24 * time.Hour)
+	w = serveAs(r, "PUT", "/api/v1/post/"+postID, map[string]interface{}{"expires_at": later}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	db.First(&post, "post_id = ?", postID)
+	assert.Equal(t, models.PostStatusOpen, post.Status)
+	assert.Equal(t, float64(1), countPosts(""))
+}
+
+func TestPostLocations(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	session, csrf := registerTestMember(t, r, "gecko")
+	defer deleteTestMembers("gecko")
+
+	w := serveAs(r, "GET", "/api/v1/building", nil, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Marston Science Library")
+
+	post := func(post models.Post) int {
+		post.Content = "Location test"
+		return serveAs(r, "POST", "/api/v1/post", post, session, csrf).Code
+	}
+	lat, lng := 29.6470, -82.3440 // between Marston and Broward
+	farLat, farLng := 29.6383, -82.3686
+	assert.Equal(t, http.StatusOK, post(models.Post{Title: "At Marston", Building: "MSL"}))
+	assert.Equal(t, http.StatusOK, post(models.Post{Title: "Near Broward", Latitude: &lat, Longitude: &lng}))
+	assert.Equal(t, http.StatusOK, post(models.Post{Title: "At the rec", Latitude: &farLat, Longitude: &farLng}))
+	assert.Equal(t, http.StatusOK, post(models.Post{Title: "Nowhere in particular"}))
+	assert.Equal(t, http.StatusBadRequest, post(models.Post{Title: "Unknown", Building: "NOPE"}))
+	assert.Equal(t, http.StatusBadRequest, post(models.Post{Title: "Half a point", Latitude: &lat}))
+
+	titles := func(query string) []string {
+		w := serveAs(r, "GET", "/api/v1/post?search_key=Location+test&"+query, nil, "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		titles := []string{}
+		for _, post := range response["data"].([]interface{}) {
+			titles = append(titles, post.(map[string]interface{})["title"].(string))
+		}
+		return titles
+	}
+
+	assert.Equal(t, []string{"At Marston"}, titles("building=MSL"))
+
+	// Marston is about 130m from the point and the rec center about 2.6km
+	assert.ElementsMatch(t, []string{"At Marston", "Near Broward"}, titles("lat=29.6470&lng=-82.3440&radius=300"))
+	assert.Equal(t, []string{"Near Broward"}, titles("lat=29.6470&lng=-82.3440&radius=50"))
+	assert.Equal(t, []string{"Near Broward", "At Marston", "At the rec"}, titles("lat=29.6470&lng=-82.3440&radius=5000&column=distance"))
+
+	w = serveAs(r, "GET", "/api/v1/post?lat=29.6470&lng=-82.3440&radius=50000", nil, "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "GET", "/api/v1/post?lat=29.6470", nil, "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "GET", "/api/v1/post?column=distance", nil, "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPolls(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	session, csrf := registerTestMember(t, r, "lynx")
+	voterSession, voterCsrf := registerTestMember(t, r, "ocelot")
+	defer deleteTestMembers("lynx", "ocelot")
+
+	// Polls need at least two distinct options
+	tooFew := &models.Poll{Question: "Lunch?", Options: []models.PollOption{{Text: "Pizza"}}}
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Lunch", Content: "Poll test", Poll: tooFew}, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	poll := &models.Poll{
+		Question:    "Best study spot?",
+		HideResults: true,
+		Options:     []models.PollOption{{Text: "Marston"}, {Text: "Library West"}, {Text: "The Hub"}},
+	}
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Study spots", Content: "Poll test", Poll: poll}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	created := decodeResponse(w)["data"].(map[string]interface{})
+	postID := created["post_id"].(string)
+	options := created["poll"].(map[string]interface{})["options"].([]interface{})
+	assert.Equal(t, 3, len(options))
+	marston := options[0].(map[string]interface{})["option_id"].(string)
+	hub := options[2].(map[string]interface{})["option_id"].(string)
+
+	// Results stay hidden until the member votes
+	w = serveAs(r, "GET", "/api/v1/post/"+postID, nil, voterSession, voterCsrf)
+	got := decodeResponse(w)["data"].(map[string]interface{})["poll"].(map[string]interface{})
+	assert.Equal(t, false, got["results_visible"])
+	assert.Nil(t, got["options"].([]interface{})[0].(map[string]interface{})["votes"])
+
+	// Single choice polls take exactly one option, and members vote once
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/poll/vote", map[string]interface{}{"option_ids": []string{marston, hub}}, voterSession, voterCsrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/poll/vote", map[string]interface{}{"option_ids": []string{"nope"}}, voterSession, voterCsrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/poll/vote", map[string]interface{}{"option_ids": []string{marston}}, voterSession, voterCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	got = decodeResponse(w)["data"].(map[string]interface{})
+	assert.Equal(t, true, got["results_visible"])
+	assert.Equal(t, float64(1), got["total_voters"])
+	assert.Equal(t, float64(1), got["options"].([]interface{})[0].(map[string]interface{})["votes"])
+	assert.Equal(t, []interface{}{marston}, got["my_choices"])
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/poll/vote", map[string]interface{}{"option_ids": []string{hub}}, voterSession, voterCsrf)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// The database itself refuses a second ballot
+	err = db.Create(&models.PollBallot{PollID: got["poll_id"].(string), Voter: "ocelot"}).Error
+	assert.NotNil(t, err)
+
+	// The author has not voted, so still sees no results until the poll closes
+	w = serveAs(r, "GET", "/api/v1/post/"+postID, nil, session, csrf)
+	assert.Equal(t, false, decodeResponse(w)["data"].(map[string]interface{})["poll"].(map[string]interface{})["results_visible"])
+	db.Model(&models.Poll{}).Where("post_id = ?", postID).Update("closes_at", time.Now().Add(-time.Minute))
+	w = serveAs(r, "GET", "/api/v1/post/"+postID, nil, session, csrf)
+	got = decodeResponse(w)["data"].(map[string]interface{})["poll"].(map[string]interface{})
+	assert.Equal(t, true, got["closed"])
+	assert.Equal(t, true, got["results_visible"])
+	w = serveAs(r, "POST", "/api/v1/post/"+postID+"/poll/vote", map[string]interface{}{"option_ids": []string{hub}}, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Multiple choice polls take several options in one vote
+	multi := &models.Poll{Question: "Which days work?", MultipleChoice: true, Options: []models.PollOption{{Text: "Mon"}, {Text: "Tue"}, {Text: "Wed"}}}
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Meetup", Content: "Poll test", Poll: multi}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	created = decodeResponse(w)["data"].(map[string]interface{})
+	options = created["poll"].(map[string]interface{})["options"].([]interface{})
+	w = serveAs(r, "POST", "/api/v1/post/"+created["post_id"].(string)+"/poll/vote", map[string]interface{}{"option_ids": []string{
+		options[0].(map[string]interface{})["option_id"].(string),
+		options[2].(map[string]interface{})["option_id"].(string),
+	}}, voterSession, voterCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	got = decodeResponse(w)["data"].(map[string]interface{})
+	assert.Equal(t, float64(1), got["total_voters"])
+	assert.Equal(t, 2, len(got["my_choices"].([]interface{})))
+}
+
+// Scanner that rejects files containing the EICAR test string
+type eicarScanner struct{}
+
+func (eicarScanner) Scan(fileName string, data []byte) error {
+	if bytes.Contains(data, []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")) {
+		return errInfected
+	}
+	return nil
+}
+
+func TestAttachments(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+	blobDir := t.TempDir()
+	defer func(previous storage.BlobStore) { blobStore = previous }(blobStore)
+	blobStore = storage.NewLocalStore(blobDir)
+	defer func(previous virusScanner) { attachmentScanner = previous }(attachmentScanner)
+	attachmentScanner = eicarScanner{}
+
+	session, csrf := registerTestMember(t, r, "wombat")
+	otherSession, otherCsrf := registerTestMember(t, r, "quokka")
+	defer deleteTestMembers("wombat", "quokka")
+
+	uploadFiles := func(fileNames []string, contents [][]byte, sessionToken, csrfToken string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for i, fileName := range fileNames {
+			part, _ := writer.CreateFormFile("file", fileName)
+			part.Write(contents[i])
+		}
+		writer.Close()
+		req, _ := http.NewRequest("POST", "/api/v1/attachment", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+		req.Header.Add("X-CSRF-Token", csrfToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	upload := func(fileName string, content []byte, sessionToken, csrfToken string) *httptest.ResponseRecorder {
+		return uploadFiles([]string{fileName}, [][]byte{content}, sessionToken, csrfToken)
+	}
+
+	// The content decides the type, and the extension has to agree with it
+	pdf := []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n%%EOF\n")
+	w := upload("../../Lecture notes \"week 1\".pdf", pdf, session, csrf)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	attachment := decodeResponse(w)["data"].([]interface{})[0].(map[string]interface{})
+	attachmentID := attachment["attachment_id"].(string)
+	assert.Equal(t, "Lecture notes week 1.pdf", attachment["file_name"])
+	assert.Equal(t, "application/pdf", attachment["content_type"])
+
+	w = upload("notes.md", []byte("# Week 1\n\nBring a calculator."), session, csrf)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "text/markdown; charset=utf-8", decodeResponse(w)["data"].([]interface{})[0].(map[string]interface{})["content_type"])
+	w = upload("page.html", []byte("<html><script>alert(1)</script></html>"), session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = upload("notes.docx", pdf, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Files the scanner flags are not stored
+	eicar := []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+	w = upload("eicar.txt", eicar, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// One refused file fails the whole upload, and the others are not kept
+	w = uploadFiles([]string{"agenda.txt", "eicar.txt"}, [][]byte{[]byte("Meeting at noon"), eicar}, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var kept int64
+	db.Model(&models.Attachment{}).Where("uploader = ? AND file_name = ?", "wombat", "agenda.txt").Count(&kept)
+	assert.Equal(t, int64(0), kept)
+
+	// Downloads are never displayed inline
+	w = serveAs(r, "GET", "/api/v1/attachment/"+attachmentID, nil, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, pdf, w.Body.Bytes())
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment;"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "filename*=UTF-8''Lecture%20notes%20week%201.pdf")
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+	// Members only attach their own files to posts
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Notes", Content: "Week 1", Attachments: models.StringArray{attachmentID}}, otherSession, otherCsrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Notes", Content: "Week 1", Attachments: models.StringArray{attachmentID}}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	postID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+	w = serveAs(r, "GET", "/api/v1/post/"+postID, nil, "", "")
+	details := decodeResponse(w)["data"].(map[string]interface{})["attachment_details"].([]interface{})
+	assert.Equal(t, 1, len(details))
+	assert.Equal(t, float64(len(pdf)), details[0].(map[string]interface{})["size"])
+
+	// Attachments in use, even by a deleted post, cannot be deleted, and only
+	// by their uploader
+	w = serveAs(r, "DELETE", "/api/v1/attachment/"+attachmentID, nil, otherSession, otherCsrf)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveAs(r, "DELETE", "/api/v1/attachment/"+attachmentID, nil, session, csrf)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = serveAs(r, "DELETE", "/api/v1/post/"+postID, nil, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "DELETE", "/api/v1/attachment/"+attachmentID, nil, session, csrf)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	_, err = undeletePost(postID, time.Now().UTC())
+	assert.NoError(t, err)
+	w = serveAs(r, "PUT", "/api/v1/post/"+postID, map[string]interface{}{"attachments": []string{}}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "DELETE", "/api/v1/attachment/"+attachmentID, nil, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/attachment/"+attachmentID, nil, "", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Uploads stop once the member's quota is used up
+	w = serveAs(r, "GET", "/api/v1/attachment", nil, session, csrf)
+	listed := decodeResponse(w)
+	assert.Equal(t, 1, len(listed["data"].([]interface{})))
+	used := int64(listed["used"].(float64))
+	db.Create(&models.Attachment{AttachmentId: "quota-filler", Uploader: "wombat", FileName: "big.pdf", Size: memberAttachmentQuota - used})
+	w = upload("more.txt", []byte("one byte too many"), session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "per member")
+	stored, _ := os.ReadDir(filepath.Join(blobDir, "attachments"))
+	assert.Equal(t, 1, len(stored))
+}
+
+func TestDuplicatePosts(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	session, csrf := registerTestMember(t, r, "magpie")
+	otherSession, otherCsrf := registerTestMember(t, r, "jackdaw")
+	defer deleteTestMembers("magpie", "jackdaw")
+
+	original := models.Post{Title: "Need a calculus tutor", Content: "Looking for someone to help with MAC2311 limits and derivatives before the midterm next week."}
+	w := serveAs(r, "POST", "/api/v1/post", original, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	postID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+
+	// Reposting the same text, even with different case and punctuation, is refused
+	repost := models.Post{Title: "need a CALCULUS tutor!", Content: "Looking for someone to help with MAC2311 limits and derivatives, before the midterm next week"}
+	w = serveAs(r, "POST", "/api/v1/post?confirm_duplicate=true", repost, session, csrf)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, postID, decodeResponse(w)["data"].(map[string]interface{})["post_id"])
+
+	// A near duplicate comes back as a warning listing the similar post
+	similar := models.Post{Title: "Need a calculus tutor", Content: "Looking for someone to help with MAC2311 limits and derivatives before the midterm next Tuesday."}
+	w = serveAs(r, "POST", "/api/v1/post", similar, otherSession, otherCsrf)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	response := decodeResponse(w)
+	assert.NotEmpty(t, response["warning"])
+	candidates := response["data"].([]interface{})
+	assert.Equal(t, 1, len(candidates))
+	candidate := candidates[0].(map[string]interface{})
+	assert.Equal(t, postID, candidate["post_id"])
+	assert.Greater(t, candidate["similarity"].(float64), duplicateThreshold)
+
+	// The author can confirm past the warning
+	w = serveAs(r, "POST", "/api/v1/post?confirm_duplicate=true", similar, otherSession, otherCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Unrelated posts are not flagged
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Lost umbrella", Content: "Left a green umbrella in Library West on Monday."}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Drafts do not block posting the same text, but are checked once they go live
+	desk := models.Post{Title: "Selling a desk", Content: "Small wooden desk, pickup near Broward Hall.", Draft: true}
+	w = serveAs(r, "POST", "/api/v1/post?confirm_duplicate=true", desk, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	draftID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+	desk.Draft = false
+	w = serveAs(r, "POST", "/api/v1/post?confirm_duplicate=true", desk, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	deskID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+	w = serveAs(r, "PUT", "/api/v1/post/"+draftID, map[string]interface{}{"draft": false}, session, csrf)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, deskID, decodeResponse(w)["data"].(map[string]interface{})["post_id"])
+
+	// Exact reposts are allowed again once the window has passed
+	defer func(previous time.Duration) { duplicateRepostWindow = previous }(duplicateRepostWindow)
+	duplicateRepostWindow = time.Nanosecond
+	w = serveAs(r, "POST", "/api/v1/post?confirm_duplicate=true", repost, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestPinnedPosts(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	session, csrf := registerTestMember(t, r, "kestrel")
+	modSession, modCsrf := registerTestMember(t, r, "condor")
+	defer deleteTestMembers("kestrel", "condor")
+	db.Model(&models.Member{}).Where("username = ?", "condor").Update("moderator", true)
+
+	postIDs := []string{}
+	for i, category := range []string{"tutoring", "tutoring", "rides", "rides", "events"} {
+		post := models.Post{Title: fmt.Sprintf("Pin test %d", i), Content: fmt.Sprintf("Pin test number %d about %s", i, category), Category: category}
+		w := serveAs(r, "POST", "/api/v1/post?confirm_duplicate=true", post, session, csrf)
+		assert.Equal(t, http.StatusOK, w.Code)
+		postIDs = append(postIDs, decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string))
+	}
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Bad", Content: "Pin test", Category: "nonsense"}, session, csrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	listed := func(path string) []string {
+		w := serveAs(r, "GET", path, nil, "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		ids := []string{}
+		for _, post := range decodeResponse(w)["data"].([]interface{}) {
+			ids = append(ids, post.(map[string]interface{})["post_id"].(string))
+		}
+		return ids
+	}
+
+	// Only moderators feature posts
+	w = serveAs(r, "PUT", "/api/v1/post/"+postIDs[0]+"/pin", map[string]interface{}{"scope": "global"}, session, csrf)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveAs(r, "PUT", "/api/v1/post/"+postIDs[0]+"/pin", map[string]interface{}{"scope": "global"}, modSession, modCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "PUT", "/api/v1/post/"+postIDs[2]+"/pin", map[string]interface{}{"scope": "category"}, modSession, modCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Pinned posts lead whatever the sort, and pages continue after them
+	ids := listed("/api/v1/post?search_key=Pin+test&column=created_at&order=asc")
+	assert.Equal(t, []string{postIDs[0], postIDs[1], postIDs[2], postIDs[3], postIDs[4]}, ids)
+	ids = listed("/api/v1/post?search_key=Pin+test&column=created_at&order=desc")
+	assert.Equal(t, []string{postIDs[0], postIDs[4], postIDs[3], postIDs[2], postIDs[1]}, ids)
+	ids = listed("/api/v1/post?search_key=Pin+test&column=created_at&order=desc&category=rides")
+	assert.Equal(t, []string{postIDs[2], postIDs[3]}, ids)
+	ids = listed("/api/v1/post?search_key=Pin+test&column=created_at&order=desc&limit=2&offset=2")
+	assert.Equal(t, []string{postIDs[3], postIDs[2]}, ids)
+	w = serveAs(r, "GET", "/api/v1/post?search_key=Pin+test&limit=1", nil, "", "")
+	response := decodeResponse(w)
+	assert.Equal(t, float64(5), response["count"])
+	assert.Equal(t, true, response["data"].([]interface{})[0].(map[string]interface{})["pinned"])
+
+	// Expired pins stop counting
+	past := time.Now().Add(-time.Minute)
+	db.Model(&models.Pin{}).Where("post_id = ?", postIDs[0]).Update("expires_at", past)
+	ids = listed("/api/v1/post?search_key=Pin+test&column=created_at&order=desc")
+	assert.Equal(t, postIDs[4], ids[0])
+	runScheduledJobs(time.Now())
+	var remaining int64
+	db.Model(&models.Pin{}).Where("post_id = ?", postIDs[0]).Count(&remaining)
+	assert.Equal(t, int64(0), remaining)
+
+	// Members pin a limited number of their own posts on their profile
+	for _, postID := range postIDs[1:4] {
+		w = serveAs(r, "PUT", "/api/v1/post/"+postID+"/pin", map[string]interface{}{"scope": "profile"}, session, csrf)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	w = serveAs(r, "PUT", "/api/v1/post/"+postIDs[4]+"/pin", map[string]interface{}{"scope": "profile"}, session, csrf)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = serveAs(r, "PUT", "/api/v1/post/"+postIDs[4]+"/pin", map[string]interface{}{"scope": "profile"}, modSession, modCsrf)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	ids = listed("/api/v1/member/kestrel/posts")
+	assert.Equal(t, []string{postIDs[3], postIDs[2], postIDs[1]}, ids[:3])
+	assert.Equal(t, 5, len(ids))
+
+	w = serveAs(r, "DELETE", "/api/v1/post/"+postIDs[3]+"/pin?scope=profile", nil, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "DELETE", "/api/v1/post/"+postIDs[3]+"/pin?scope=profile", nil, session, csrf)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serveAs(r, "PUT", "/api/v1/post/"+postIDs[4]+"/pin", map[string]interface{}{"scope": "profile"}, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Deleting a post removes its pins
+	w = serveAs(r, "DELETE", "/api/v1/post/"+postIDs[2], nil, session, csrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	db.Model(&models.Pin{}).Where("post_id = ?", postIDs[2]).Count(&remaining)
+	assert.Equal(t, int64(0), remaining)
+}
+
+func TestRepostsAndQuotes(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	authorSession, authorCsrf := registerTestMember(t, r, "puffin")
+	sharerSession, sharerCsrf := registerTestMember(t, r, "gannet")
+	readerSession, readerCsrf := registerTestMember(t, r, "tern")
+	defer deleteTestMembers("puffin", "gannet", "tern")
+
+	getPost := func(postID string) map[string]interface{} {
+		w := serveAs(r, "GET", "/api/v1/post/"+postID, nil, "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		return decodeResponse(w)["data"].(map[string]interface{})
+	}
+
+	w := serveAs(r, "POST", "/api/v1/member/gannet/follow", nil, readerSession, readerCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Need a chemistry lab partner", Content: "CHM2045 lab on Thursdays"}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	originalID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+
+	// Reposts reach the reposter's followers and notify the author once
+	w = serveAs(r, "POST", "/api/v1/post/"+originalID+"/repost", nil, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "POST", "/api/v1/post/"+originalID+"/repost", nil, sharerSession, sharerCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, float64(1), decodeResponse(w)["data"].(map[string]interface{})["reposts"])
+	w = serveAs(r, "POST", "/api/v1/post/"+originalID+"/repost", nil, sharerSession, sharerCsrf)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var notifications int64
+	db.Model(&models.Notification{}).Where("username = ? AND title = ?", "puffin", "Your post was reposted").Count(&notifications)
+	assert.Equal(t, int64(1), notifications)
+
+	w = serveAs(r, "GET", "/api/v1/feed", nil, readerSession, readerCsrf)
+	feed := decodeResponse(w)["data"].([]interface{})
+	assert.Equal(t, 1, len(feed))
+	assert.Equal(t, originalID, feed[0].(map[string]interface{})["post_id"])
+	assert.Equal(t, "gannet", feed[0].(map[string]interface{})["reposted_by"])
+
+	// Quote posts embed the original as it currently reads
+	quoteOf := "does-not-exist"
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Bad quote", Content: "Nothing here", QuoteOf: &quoteOf}, sharerSession, sharerCsrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	quoteOf = originalID
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Anyone?", Content: "My roommate is in this section too", QuoteOf: &quoteOf}, sharerSession, sharerCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	quoteID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+	assert.Equal(t, float64(1), getPost(originalID)["quotes"])
+	db.Model(&models.Notification{}).Where("username = ? AND title = ?", "puffin", "Your post was quoted").Count(&notifications)
+	assert.Equal(t, int64(1), notifications)
+
+	w = serveAs(r, "PUT", "/api/v1/post/"+originalID, map[string]interface{}{"title": "Found a chemistry lab partner"}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	quote := getPost(quoteID)
+	quoted := quote["quoted"].(map[string]interface{})
+	assert.Equal(t, "Found a chemistry lab partner", quoted["title"])
+	assert.Equal(t, true, quoted["edited"])
+	assert.Equal(t, float64(1), quote["quote_revision"])
+
+	// The feed pages reposts and posts together
+	w = serveAs(r, "GET", "/api/v1/feed?limit=1", nil, readerSession, readerCsrf)
+	response := decodeResponse(w)
+	assert.Equal(t, quoteID, response["data"].([]interface{})[0].(map[string]interface{})["post_id"])
+	w = serveAs(r, "GET", "/api/v1/feed?limit=1&cursor="+response["next_cursor"].(string), nil, readerSession, readerCsrf)
+	response = decodeResponse(w)
+	assert.Equal(t, originalID, response["data"].([]interface{})[0].(map[string]interface{})["post_id"])
+	assert.Equal(t, "", response["next_cursor"])
+
+	// Once the original is gone, reposts disappear and quotes say so
+	w = serveAs(r, "DELETE", "/api/v1/post/"+originalID, nil, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	quote = getPost(quoteID)
+	assert.Nil(t, quote["quoted"])
+	assert.Equal(t, true, quote["quote_unavailable"])
+	w = serveAs(r, "GET", "/api/v1/feed", nil, readerSession, readerCsrf)
+	assert.Equal(t, 1, len(decodeResponse(w)["data"].([]interface{})))
+	var reposts int64
+	db.Model(&models.Repost{}).Where("post_id = ?", originalID).Count(&reposts)
+	assert.Equal(t, int64(0), reposts)
+
+	// A post listed through a repost does not come back on a later page
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Selling a lab coat", Content: "Size M, worn once"}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	olderID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Selling safety goggles", Content: "Never used"}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	newerID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+	w = serveAs(r, "POST", "/api/v1/post/"+newerID+"/repost", nil, sharerSession, sharerCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "POST", "/api/v1/member/puffin/follow", nil, readerSession, readerCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var listed []string
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		w = serveAs(r, "GET", "/api/v1/feed?limit=1&cursor="+cursor, nil, readerSession, readerCsrf)
+		assert.Equal(t, http.StatusOK, w.Code)
+		response = decodeResponse(w)
+		for _, post := range response["data"].([]interface{}) {
+			listed = append(listed, post.(map[string]interface{})["post_id"].(string))
+		}
+		if cursor = response["next_cursor"].(string); cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{newerID, olderID, quoteID}, listed)
+}
+
+func TestCommentThreads(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	authorSession, authorCsrf := registerTestMember(t, r, "otter")
+	askerSession, askerCsrf := registerTestMember(t, r, "beaver")
+	replierSession, replierCsrf := registerTestMember(t, r, "muskrat")
+	defer deleteTestMembers("otter", "beaver", "muskrat")
+
+	comment := func(postID string, parentID *string, session, csrf string) *httptest.ResponseRecorder {
+		return serveAs(r, "POST", "/api/v1/comment/"+postID, models.Comment{Content: "Thread test", ParentID: parentID}, session, csrf)
+	}
+
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Bike repair", Content: "Who fixes flat tires near campus?"}, authorSession, authorCsrf)
+	postID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+
+	// Build a chain of replies as deep as allowed
+	w = comment(postID, nil, askerSession, askerCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	rootID := decodeResponse(w)["data"].(map[string]interface{})["comment_id"].(string)
+	parentID := rootID
+	chain := []string{rootID}
+	for depth := 1; depth <= maxCommentDepth; depth++ {
+		w = comment(postID, &parentID, replierSession, replierCsrf)
+		assert.Equal(t, http.StatusOK, w.Code)
+		created := decodeResponse(w)["data"].(map[string]interface{})
+		assert.Equal(t, float64(depth), created["depth"])
+		parentID = created["comment_id"].(string)
+		chain = append(chain, parentID)
+	}
+	w = comment(postID, &parentID, replierSession, replierCsrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	missing := "does-not-exist"
+	w = comment(postID, &missing, replierSession, replierCsrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The first reply notified the asker rather than only the post author
+	var notifications int64
+	db.Model(&models.Notification{}).Where("username = ? AND title = ?", "beaver", "New reply to your comment!").Count(&notifications)
+	assert.Equal(t, int64(1), notifications)
+
+	// Threads nest and are cut off at the requested depth
+	w = comment(postID, nil, replierSession, replierCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/comment/"+postID+"/?depth=2", nil, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	response := decodeResponse(w)
+	assert.Equal(t, float64(2), response["count"])
+	threads := response["data"].([]interface{})
+	root := threads[1].(map[string]interface{})
+	assert.Equal(t, rootID, root["comment_id"])
+	reply := root["replies"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, chain[1], reply["comment_id"])
+	assert.Equal(t, float64(1), reply["reply_count"])
+	assert.Empty(t, reply["replies"])
+
+	// The rest of a thread is fetched from where it was cut off
+	w = serveAs(r, "GET", "/api/v1/comment/"+postID+"/?depth=1&parent_id="+chain[1], nil, "", "")
+	subtree := decodeResponse(w)["data"].([]interface{})
+	assert.Equal(t, chain[2], subtree[0].(map[string]interface{})["comment_id"])
+	w = serveAs(r, "GET", "/api/v1/comment/"+postID+"/?limit=1", nil, "", "")
+	assert.Equal(t, 1, len(decodeResponse(w)["data"].([]interface{})))
+
+	// Posts come with their comments threaded
+	w = serveAs(r, "GET", "/api/v1/post/"+postID, nil, "", "")
+	comments := decodeResponse(w)["data"].(map[string]interface{})["comments"].([]interface{})
+	assert.Equal(t, 2, len(comments))
+
+	// Deleting a comment with replies leaves a tombstone above them
+	w = serveAs(r, "DELETE", "/api/v1/comment/"+postID+"/"+chain[1], nil, replierSession, replierCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var remaining int64
+	db.Model(&models.Comment{}).Where("comment_id IN ?", chain).Count(&remaining)
+	assert.Equal(t, int64(len(chain)), remaining)
+	var tombstone models.Comment
+	db.First(&tombstone, "comment_id = ?", chain[1])
+	assert.Equal(t, tombstoneText, tombstone.Content)
+}
+
+func TestMentions(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	authorSession, authorCsrf := registerTestMember(t, r, "badger")
+	otherSession, otherCsrf := registerTestMember(t, r, "stoat")
+	registerTestMember(t, r, "ferret")
+	defer deleteTestMembers("badger", "stoat", "ferret")
+
+	notified := func(username, title string) int64 {
+		var count int64
+		db.Model(&models.Notification{}).Where("username = ? AND title = ?", username, title).Count(&count)
+		return count
+	}
+
+	// Only existing members count, and addresses are not mentions
+	content := "Ask @stoat or @nobody, or mail badger@ufl.edu. Thanks @stoat."
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Mentions", Content: content}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	created := decodeResponse(w)["data"].(map[string]interface{})
+	postID := created["post_id"].(string)
+	mentions := created["mentions"].([]interface{})
+	assert.Equal(t, 2, len(mentions))
+	span := mentions[1].(map[string]interface{})
+	assert.Equal(t, "stoat", span["username"])
+	assert.Equal(t, "@stoat", string([]rune(content)[int(span["start"].(float64)):int(span["end"].(float64))]))
+	assert.Equal(t, int64(1), notified("stoat", "You were mentioned in a post"))
+
+	// Edits notify newly mentioned members only, and dropped mentions lose their span
+	w = serveAs(r, "PUT", "/api/v1/post/"+postID, map[string]interface{}{"content": "Ask @ferret"}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "PUT", "/api/v1/post/"+postID, map[string]interface{}{"content": "Ask @ferret and @stoat"}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(1), notified("stoat", "You were mentioned in a post"))
+	assert.Equal(t, int64(1), notified("ferret", "You were mentioned in a post"))
+	w = serveAs(r, "PUT", "/api/v1/post/"+postID, map[string]interface{}{"content": "Ask @ferret"}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/post/"+postID, nil, "", "")
+	mentions = decodeResponse(w)["data"].(map[string]interface{})["mentions"].([]interface{})
+	assert.Equal(t, 1, len(mentions))
+	assert.Equal(t, "ferret", mentions[0].(map[string]interface{})["username"])
+
+	// Comments mention members the same way
+	w = serveAs(r, "POST", "/api/v1/comment/"+postID, models.Comment{Content: "@stoat can you help?"}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(1), notified("stoat", "You were mentioned in a comment"))
+	w = serveAs(r, "GET", "/api/v1/comment/"+postID+"/", nil, "", "")
+	comment := decodeResponse(w)["data"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, float64(0), comment["mentions"].([]interface{})[0].(map[string]interface{})["start"])
+
+	// Drafts mention no one until they are published
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Draft mention", Content: "Hi @ferret", Draft: true}, authorSession, authorCsrf)
+	draftID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+	assert.Equal(t, int64(1), notified("ferret", "You were mentioned in a post"))
+	w = serveAs(r, "PUT", "/api/v1/post/"+draftID, map[string]interface{}{"draft": false}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(2), notified("ferret", "You were mentioned in a post"))
+
+	// Content mentioning too many members is refused
+	crowd := strings.Repeat("@stoat ", maxMentions)
+	for i := 0; i <= maxMentions; i++ {
+		crowd += fmt.Sprintf("@member%d ", i)
+	}
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Everyone", Content: crowd}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "PUT", "/api/v1/post/"+postID, map[string]interface{}{"content": crowd}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "POST", "/api/v1/comment/"+postID, models.Comment{Content: crowd}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "POST", "/api/v1/comment/"+postID, models.Comment{Content: strings.Repeat("@stoat ", maxMentions+1)}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Another member cannot rewrite the mentions of this post through their own
+	w = serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Own post", Content: "Nothing yet"}, otherSession, otherCsrf)
+	otherPostID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+	w = serveAs(r, "PUT", "/api/v1/post/"+otherPostID, map[string]interface{}{"post_id": postID, "author": "badger", "content": "Thanks @badger"}, otherSession, otherCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", "/api/v1/post/"+postID, nil, "", "")
+	mentions = decodeResponse(w)["data"].(map[string]interface{})["mentions"].([]interface{})
+	assert.Equal(t, 1, len(mentions))
+	assert.Equal(t, "ferret", mentions[0].(map[string]interface{})["username"])
+	var notification models.Notification
+	db.Where("username = ? AND title = ?", "badger", "You were mentioned in a post").First(&notification)
+	assert.True(t, strings.HasPrefix(notification.Content, "stoat mentioned you"))
+}
+
+func TestPaginatedComments(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	authorSession, authorCsrf := registerTestMember(t, r, "lynx")
+	firstSession, firstCsrf := registerTestMember(t, r, "marten")
+	secondSession, secondCsrf := registerTestMember(t, r, "wolverine")
+	defer deleteTestMembers("lynx", "marten", "wolverine")
+
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Best study spots", Content: "Where do you study late?"}, authorSession, authorCsrf)
+	postID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+
+	var ids []string
+	for i := 0; i < 4; i++ {
+		w = serveAs(r, "POST", "/api/v1/comment/"+postID, models.Comment{Content: fmt.Sprintf("Spot %d", i)}, authorSession, authorCsrf)
+		assert.Equal(t, http.StatusOK, w.Code)
+		ids = append(ids, decodeResponse(w)["data"].(map[string]interface{})["comment_id"].(string))
+	}
+	vote := func(commentID, action, session, csrf string) {
+		w := serveAs(r, "PUT", "/api/v1/comment/"+postID+"/"+commentID+"/like-dislike", map[string]string{"action": action}, session, csrf)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	vote(ids[1], "like", firstSession, firstCsrf)
+	vote(ids[1], "like", secondSession, secondCsrf)
+	vote(ids[2], "like", firstSession, firstCsrf)
+	vote(ids[3], "dislike", secondSession, secondCsrf)
+
+	listed := func(query string) ([]string, string) {
+		w := serveAs(r, "GET", "/api/v1/comment/"+postID+"/?"+query, nil, "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		response := decodeResponse(w)
+		assert.Equal(t, float64(4), response["count"])
+		var listed []string
+		for _, comment := range response["data"].([]interface{}) {
+			listed = append(listed, comment.(map[string]interface{})["comment_id"].(string))
+		}
+		return listed, response["next_cursor"].(string)
+	}
+
+	// Newest first, paged by cursor
+	page, cursor := listed("limit=3")
+	assert.Equal(t, []string{ids[3], ids[2], ids[1]}, page)
+	assert.NotEmpty(t, cursor)
+	page, cursor = listed("limit=3&cursor=" + cursor)
+	assert.Equal(t, []string{ids[0]}, page)
+	assert.Empty(t, cursor)
+
+	// Oldest first keeps its order across pages
+	page, cursor = listed("sort=oldest&limit=2")
+	assert.Equal(t, []string{ids[0], ids[1]}, page)
+	page, _ = listed("sort=oldest&limit=2&cursor=" + cursor)
+	assert.Equal(t, []string{ids[2], ids[3]}, page)
+
+	// Top and best put the liked comments first, across pages
+	page, cursor = listed("sort=top&limit=1")
+	assert.Equal(t, []string{ids[1]}, page)
+	page, _ = listed("sort=top&limit=1&cursor=" + cursor)
+	assert.Equal(t, []string{ids[2]}, page)
+	page, cursor = listed("sort=best&limit=1")
+	assert.Equal(t, []string{ids[1]}, page)
+	page, _ = listed("sort=best&limit=1&cursor=" + cursor)
+	assert.Equal(t, []string{ids[2]}, page)
+	assert.Greater(t, confidenceScore(10, 1), confidenceScore(1, 0))
+
+	w = serveAs(r, "GET", "/api/v1/comment/"+postID+"/?sort=loudest", nil, "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "GET", "/api/v1/comment/"+postID+"/?cursor=bogus", nil, "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Posts come with the first page of comments and the total
+	w = serveAs(r, "GET", "/api/v1/post/"+postID, nil, "", "")
+	post := decodeResponse(w)["data"].(map[string]interface{})
+	assert.Equal(t, float64(4), post["comment_count"])
+	assert.Equal(t, 4, len(post["comments"].([]interface{})))
+	assert.Empty(t, post["comments_next_cursor"])
+}
+
+func TestAcceptedAnswers(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	authorSession, authorCsrf := registerTestMember(t, r, "ibex")
+	answererSession, answererCsrf := registerTestMember(t, r, "oryx")
+	otherSession, otherCsrf := registerTestMember(t, r, "gazelle")
+	defer deleteTestMembers("ibex", "oryx", "gazelle")
+
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Calculus help", Content: "How do I integrate by parts?"}, authorSession, authorCsrf)
+	postID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+	comment := func(parentID *string, session, csrf string) string {
+		w := serveAs(r, "POST", "/api/v1/comment/"+postID, models.Comment{Content: "Try this", ParentID: parentID}, session, csrf)
+		assert.Equal(t, http.StatusOK, w.Code)
+		return decodeResponse(w)["data"].(map[string]interface{})["comment_id"].(string)
+	}
+	answerID := comment(nil, answererSession, answererCsrf)
+	otherID := comment(nil, otherSession, otherCsrf)
+	replyID := comment(&answerID, otherSession, otherCsrf)
+
+	// Only the post's author accepts, and only top-level comments
+	accept := func(commentID, session, csrf string) *httptest.ResponseRecorder {
+		return serveAs(r, "PUT", "/api/v1/post/"+postID+"/answer", map[string]string{"comment_id": commentID}, session, csrf)
+	}
+	assert.Equal(t, http.StatusForbidden, accept(answerID, answererSession, answererCsrf).Code)
+	assert.Equal(t, http.StatusBadRequest, accept(replyID, authorSession, authorCsrf).Code)
+	assert.Equal(t, http.StatusNotFound, accept("does-not-exist", authorSession, authorCsrf).Code)
+	assert.Equal(t, http.StatusOK, accept(answerID, authorSession, authorCsrf).Code)
+	assert.Equal(t, http.StatusOK, accept(answerID, authorSession, authorCsrf).Code)
+	var notifications int64
+	db.Model(&models.Notification{}).Where("username = ? AND title = ?", "oryx", "Your answer was accepted").Count(&notifications)
+	assert.Equal(t, int64(1), notifications)
+
+	// The accepted answer leads the comments though it is not the newest
+	listed := func(query string) []interface{} {
+		w := serveAs(r, "GET", "/api/v1/comment/"+postID+"/?"+query, nil, "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		return decodeResponse(w)["data"].([]interface{})
+	}
+	comments := listed("")
+	assert.Equal(t, 2, len(comments))
+	assert.Equal(t, answerID, comments[0].(map[string]interface{})["comment_id"])
+	assert.Equal(t, true, comments[0].(map[string]interface{})["accepted"])
+	w = serveAs(r, "GET", "/api/v1/comment/"+postID+"/?limit=1", nil, "", "")
+	response := decodeResponse(w)
+	assert.Equal(t, 2, len(response["data"].([]interface{})))
+	assert.Empty(t, response["next_cursor"])
+	w = serveAs(r, "GET", "/api/v1/post/"+postID, nil, "", "")
+	post := decodeResponse(w)["data"].(map[string]interface{})
+	assert.Equal(t, answerID, post["accepted_comment_id"])
+
+	// Accepting another comment replaces the answer, and it can be taken back
+	assert.Equal(t, http.StatusOK, accept(otherID, authorSession, authorCsrf).Code)
+	assert.Equal(t, otherID, listed("")[0].(map[string]interface{})["comment_id"])
+	w = serveAs(r, "DELETE", "/api/v1/post/"+postID+"/answer", nil, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "DELETE", "/api/v1/post/"+postID+"/answer", nil, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, otherID, listed("")[0].(map[string]interface{})["comment_id"])
+	assert.Equal(t, false, listed("")[0].(map[string]interface{})["accepted"])
+
+	// Deleting the accepted answer clears it from the post
+	assert.Equal(t, http.StatusOK, accept(answerID, authorSession, authorCsrf).Code)
+	w = serveAs(r, "DELETE", "/api/v1/comment/"+postID+"/"+answerID, nil, answererSession, answererCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stored models.Post
+	db.First(&stored, "post_id = ?", postID)
+	assert.Nil(t, stored.AcceptedCommentID)
+}
+
+func TestCommentEditHistory(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	authorSession, authorCsrf := registerTestMember(t, r, "weasel")
+	reporterSession, reporterCsrf := registerTestMember(t, r, "mink")
+	modSession, modCsrf := registerTestMember(t, r, "ermine")
+	defer deleteTestMembers("weasel", "mink", "ermine")
+	db.Model(&models.Member{}).Where("username = ?", "ermine").Update("moderator", true)
+
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Lost keys", Content: "Left them in the library"}, authorSession, authorCsrf)
+	postID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+	w = serveAs(r, "POST", "/api/v1/comment/"+postID, models.Comment{Content: "You should have been more careful"}, authorSession, authorCsrf)
+	created := decodeResponse(w)["data"].(map[string]interface{})
+	assert.Equal(t, false, created["edited"])
+	commentURL := "/api/v1/comment/" + postID + "/" + created["comment_id"].(string)
+
+	// Reporting keeps the text as reported
+	w = serveAs(r, "POST", commentURL+"/report", map[string]string{"reason": "Rude"}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serveAs(r, "POST", commentURL+"/report", map[string]string{"reason": "Rude"}, reporterSession, reporterCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "POST", commentURL+"/report", map[string]string{"reason": "Rude"}, reporterSession, reporterCsrf)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Editing marks the comment and keeps the text it replaced
+	w = serveAs(r, "PUT", commentURL, map[string]string{"content": "Hope you find them"}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	updated := decodeResponse(w)["data"].(map[string]interface{})
+	assert.Equal(t, true, updated["edited"])
+	assert.NotNil(t, updated["edited_at"])
+	w = serveAs(r, "GET", commentURL, nil, "", "")
+	assert.Equal(t, true, decodeResponse(w)["data"].(map[string]interface{})["edited"])
+
+	w = serveAs(r, "GET", commentURL+"/revisions", nil, reporterSession, reporterCsrf)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveAs(r, "GET", commentURL+"/revisions", nil, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	revisions := decodeResponse(w)["data"].([]interface{})
+	assert.Equal(t, 2, len(revisions))
+	assert.Equal(t, "You should have been more careful", revisions[0].(map[string]interface{})["content"])
+	assert.Equal(t, "Hope you find them", revisions[1].(map[string]interface{})["content"])
+
+	// Moderators see what was reported, not what the comment says now
+	w = serveAs(r, "GET", commentURL+"/reports", nil, reporterSession, reporterCsrf)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = serveAs(r, "GET", commentURL+"/reports", nil, modSession, modCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	reports := decodeResponse(w)["data"].([]interface{})
+	assert.Equal(t, 1, len(reports))
+	report := reports[0].(map[string]interface{})
+	assert.Equal(t, "You should have been more careful", report["reported_content"])
+	assert.Equal(t, true, report["edited_since_report"])
+	assert.Equal(t, "mink", report["reporter"])
+
+	// Deleting the comment keeps its history until the comment is purged
+	w = serveAs(r, "DELETE", commentURL, nil, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, purgeDeletedContent(time.Now().Add(deletionRetention+time.Hour)))
+	var remaining int64
+	db.Model(&models.CommentRevision{}).Where("comment_id = ?", created["comment_id"]).Count(&remaining)
+	assert.Equal(t, int64(0), remaining)
+}
+
+func TestDeletionAndRestore(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	authorSession, authorCsrf := registerTestMember(t, r, "puma")
+	replierSession, replierCsrf := registerTestMember(t, r, "jaguar")
+	modSession, modCsrf := registerTestMember(t, r, "ocelot")
+	defer deleteTestMembers("puma", "jaguar", "ocelot")
+	db.Model(&models.Member{}).Where("username = ?", "ocelot").Update("moderator", true)
+
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Selling a desk", Content: "Sturdy oak desk, pick up only"}, authorSession, authorCsrf)
+	postID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+	w = serveAs(r, "POST", "/api/v1/comment/"+postID, models.Comment{Content: "Is it still available?"}, replierSession, replierCsrf)
+	questionID := decodeResponse(w)["data"].(map[string]interface{})["comment_id"].(string)
+	w = serveAs(r, "POST", "/api/v1/comment/"+postID, models.Comment{Content: "Yes it is", ParentID: &questionID}, authorSession, authorCsrf)
+	answerID := decodeResponse(w)["data"].(map[string]interface{})["comment_id"].(string)
+	w = serveAs(r, "PUT", "/api/v1/post/"+postID+"/like-dislike", map[string]string{"action": "like"}, replierSession, replierCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "PUT", "/api/v1/comment/"+postID+"/"+questionID+"/like-dislike", map[string]string{"action": "like"}, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	threads := func() []interface{} {
+		w := serveAs(r, "GET", "/api/v1/comment/"+postID+"/", nil, "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		return decodeResponse(w)["data"].([]interface{})
+	}
+	restore := func(url, session, csrf string) int {
+		return serveAs(r, "PUT", url+"/restore", nil, session, csrf).Code
+	}
+	questionURL := "/api/v1/comment/" + postID + "/" + questionID
+	answerURL := "/api/v1/comment/" + postID + "/" + answerID
+
+	// A deleted comment with replies stays as a tombstone above them
+	w = serveAs(r, "DELETE", questionURL, nil, replierSession, replierCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	listed := threads()
+	assert.Equal(t, 1, len(listed))
+	question := listed[0].(map[string]interface{})
+	assert.Equal(t, tombstoneText, question["content"])
+	assert.NotNil(t, question["removed_at"])
+	assert.Equal(t, answerID, question["replies"].([]interface{})[0].(map[string]interface{})["comment_id"])
+
+	// Once its last reply goes, the tombstone goes with it
+	w = serveAs(r, "DELETE", answerURL, nil, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, threads())
+
+	// Moderators bring back a reply along with the tombstone above it, and
+	// the tombstone's text
+	assert.Equal(t, http.StatusForbidden, restore(answerURL, authorSession, authorCsrf))
+	assert.Equal(t, http.StatusOK, restore(answerURL, modSession, modCsrf))
+	assert.Equal(t, tombstoneText, threads()[0].(map[string]interface{})["content"])
+	assert.Equal(t, http.StatusOK, restore(questionURL, modSession, modCsrf))
+	assert.Equal(t, "Is it still available?", threads()[0].(map[string]interface{})["content"])
+	assert.Equal(t, http.StatusNotFound, restore(questionURL, modSession, modCsrf))
+
+	// A parent deleted outright by its author only comes back as a tombstone
+	// when a reply under it is restored
+	w = serveAs(r, "DELETE", answerURL, nil, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "DELETE", questionURL, nil, replierSession, replierCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, threads())
+	assert.Equal(t, http.StatusOK, restore(answerURL, modSession, modCsrf))
+	assert.Equal(t, tombstoneText, threads()[0].(map[string]interface{})["content"])
+	assert.Equal(t, http.StatusOK, restore(questionURL, modSession, modCsrf))
+	assert.Equal(t, "Is it still available?", threads()[0].(map[string]interface{})["content"])
+
+	// Deleting a post hides it and its comments until it is restored
+	postURL := "/api/v1/post/" + postID
+	w = serveAs(r, "DELETE", postURL, nil, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serveAs(r, "GET", postURL, nil, "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var comments int64
+	db.Model(&models.Comment{}).Where("post_id = ?", postID).Count(&comments)
+	assert.Equal(t, int64(0), comments)
+	assert.Equal(t, http.StatusConflict, restore(questionURL, modSession, modCsrf))
+	assert.Equal(t, http.StatusOK, restore(postURL, modSession, modCsrf))
+	w = serveAs(r, "GET", postURL, nil, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, float64(2), decodeResponse(w)["data"].(map[string]interface{})["comment_count"])
+
+	// Past the retention window it cannot be restored, and is purged with its votes
+	w = serveAs(r, "DELETE", postURL, nil, authorSession, authorCsrf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	db.Unscoped().Model(&models.Post{}).Where("post_id = ?", postID).Update("deleted_at", time.Now().Add(-deletionRetention-time.Hour))
+	db.Unscoped().Model(&models.Comment{}).Where("post_id = ?", postID).Update("deleted_at", time.Now().Add(-deletionRetention-time.Hour))
+	assert.Equal(t, http.StatusGone, restore(postURL, modSession, modCsrf))
+	assert.NoError(t, purgeDeletedContent(time.Now()))
+
+	var posts, votes int64
+	db.Unscoped().Model(&models.Post{}).Where("post_id = ?", postID).Count(&posts)
+	assert.Equal(t, int64(0), posts)
+	db.Unscoped().Model(&models.Comment{}).Where("post_id = ?", postID).Count(&comments)
+	assert.Equal(t, int64(0), comments)
+	db.Model(&models.Vote{}).Where("target_type = ? AND target_id = ?", models.VoteTargetPost, postID).Count(&votes)
+	assert.Equal(t, int64(0), votes)
+	db.Model(&models.Vote{}).Where("target_type = ? AND target_id = ?", models.VoteTargetComment, questionID).Count(&votes)
+	assert.Equal(t, int64(0), votes)
+}
+
+func TestVoting(t *testing.T) {
+	err := connectDatabase()
+	checkErr(err)
+	r := SetUpRouter()
+
+	authorSession, authorCsrf := registerTestMember(t, r, "bison")
+	voterSession, voterCsrf := registerTestMember(t, r, "yak")
+	otherSession, otherCsrf := registerTestMember(t, r, "tapir")
+	defer deleteTestMembers("bison", "yak", "tapir")
+
+	w := serveAs(r, "POST", "/api/v1/post", models.Post{Title: "Carpool to Orlando", Content: "Leaving Friday at noon"}, authorSession, authorCsrf)
+	postID := decodeResponse(w)["data"].(map[string]interface{})["post_id"].(string)
+	w = serveAs(r, "POST", "/api/v1/comment/"+postID, models.Comment{Content: "Count me in"}, authorSession, authorCsrf)
+	commentID := decodeResponse(w)["data"].(map[string]interface{})["comment_id"].(string)
+
+	vote := func(url, action, session, csrf string) (float64, float64) {
+		w := serveAs(r, "PUT", url+"/like-dislike", map[string]string{"action": action}, session, csrf)
+		assert.Equal(t, http.StatusOK, w.Code)
+		response := decodeResponse(w)
+		return response["likes"].(float64), response["dislikes"].(float64)
+	}
+	postURL := "/api/v1/post/" + postID
+	commentURL := "/api/v1/comment/" + postID + "/" + commentID
+
+	// Votes toggle and switch, one per member
+	likes, dislikes := vote(postURL, "like", voterSession, voterCsrf)
+	assert.Equal(t, []float64{1, 0}, []float64{likes, dislikes})
+	likes, dislikes = vote(postURL, "dislike", voterSession, voterCsrf)
+	assert.Equal(t, []float64{0, 1}, []float64{likes, dislikes})
+	likes, dislikes = vote(postURL, "like", otherSession, otherCsrf)
+	assert.Equal(t, []float64{1, 1}, []float64{likes, dislikes})
+	likes, dislikes = vote(postURL, "like", otherSession, otherCsrf)
+	assert.Equal(t, []float64{0, 1}, []float64{likes, dislikes})
+	likes, dislikes = vote(commentURL, "like", voterSession, voterCsrf)
+	assert.Equal(t, []float64{1, 0}, []float64{likes, dislikes})
+	w = serveAs(r, "PUT", postURL+"/like-dislike", map[string]string{"action": "love"}, voterSession, voterCsrf)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveAs(r, "GET", "/api/v1/member/yak/disliked-posts", nil, voterSession, voterCsrf)
+	assert.Equal(t, postID, decodeResponse(w)["data"].([]interface{})[0].(map[string]interface{})["post_id"])
+	w = serveAs(r, "GET", "/api/v1/member/yak/liked-comments", nil, voterSession, voterCsrf)
+	assert.Equal(t, commentID, decodeResponse(w)["data"].([]interface{})[0].(map[string]interface{})["comment_id"])
+
+	// The table refuses a second vote by the same member
+	duplicate := models.Vote{Member: "yak", TargetType: models.VoteTargetPost, TargetID: postID, Value: models.VoteLike}
+	assert.Error(t, db.Create(&duplicate).Error)
+
+	// Recounting repairs counters that drifted from the votes
+	db.Model(&models.Post{}).Where("post_id = ?", postID).UpdateColumns(map[string]any{"likes": 7, "dislikes": 0})
+	db.Model(&models.Comment{}).Where("comment_id = ?", commentID).UpdateColumns(map[string]any{"likes": 0, "best_score": 0})
+	assert.NoError(t, runCommand("recount-votes"))
+	var post models.Post
+	db.First(&post, "post_id = ?", postID)
+	assert.Equal(t, []int{0, 1}, []int{post.Likes, post.Dislikes})
+	var comment models.Comment
+	db.First(&comment, "comment_id = ?", commentID)
+	assert.Equal(t, 1, comment.Likes)
+	assert.Equal(t, confidenceScore(1, 0), comment.BestScore)
+	assert.Error(t, runCommand("no-such-command"))
+
+	// Votes kept in the old join tables move into the votes table
+	db.Exec("CREATE TABLE member_likes (member_username text, post_post_id text)")
+	db.Exec("INSERT INTO member_likes VALUES (?, ?)", "bison", postID)
+	defer db.Migrator().DropTable("member_likes_migrated")
+	assert.NoError(t, runCommand("migrate-votes"))
+	assert.False(t, db.Migrator().HasTable("member_likes"))
+	assert.True(t, db.Migrator().HasTable("member_likes_migrated"))
+	db.First(&post, "post_id = ?", postID)
+	assert.Equal(t, []int{1, 1}, []int{post.Likes, post.Dislikes})
+}
@@ -0,0 +1,456 @@
+// Package markdown renders the Markdown dialect used for post and comment
+// content into HTML that is safe to insert into a page as is.
+//
+// Supported syntax:
+//
+//	# Heading (levels 1-6)      > blockquote
+//	- item / * item / + item    1. ordered item
+//	```lang fenced code```      --- horizontal rule
+//	**bold** __bold__           *italic* _italic_
+//	~~strikethrough~~           `inline code`
+//	[text](url)                 bare http(s):// links
+//
+// Single line breaks inside a paragraph are kept as <br>. Raw HTML is never
+// passed through, it is escaped and shown as text, so the only tags in the
+// output are the ones the renderer emits. Link targets are limited to http,
+// https, mailto and relative URLs.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Nesting limit for blockquotes and lists, deeper levels are shown as text
+const maxDepth = 8
+
+var (
+	headingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	rulePattern        = regexp.MustCompile(`^\s{0,3}(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	bulletPattern      = regexp.MustCompile(`^(\s*)([-*+])\s+(.*)$`)
+	orderedPattern     = regexp.MustCompile(`^(\s*)(\d{1,9})[.)]\s+(.*)$`)
+	fencePattern       = regexp.MustCompile("^\\s{0,3}(```+|~~~+)\\s*([A-Za-z0-9_+-]*)\\s*$")
+	languageCharacters = regexp.MustCompile(`^[A-Za-z0-9_+-]{1,32}$`)
+)
+
+// ToHTML renders Markdown source into sanitized HTML
+func ToHTML(source string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+	source = strings.ReplaceAll(source, "\x00", "�")
+
+	var out strings.Builder
+	renderBlocks(&out, strings.Split(source, "\n"), 0)
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+func renderBlocks(out *strings.Builder, lines []string, depth int) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			i++
+
+		case fencePattern.MatchString(line):
+			i = renderFence(out, lines, i)
+
+		case headingPattern.MatchString(trimmed):
+			match := headingPattern.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(match[1])))
+			out.WriteString("<h" + level + ">")
+			renderInline(out, match[2], true)
+			out.WriteString("</h" + level + ">\n")
+			i++
+
+		case rulePattern.MatchString(line):
+			out.WriteString("<hr>\n")
+			i++
+
+		case strings.HasPrefix(trimmed, ">") && depth < maxDepth:
+			var quoted []string
+			for ; i < len(lines); i++ {
+				t := strings.TrimSpace(lines[i])
+				if !strings.HasPrefix(t, ">") {
+					break
+				}
+				t = strings.TrimPrefix(t, ">")
+				quoted = append(quoted, strings.TrimPrefix(t, " "))
+			}
+			out.WriteString("<blockquote>\n")
+			renderBlocks(out, quoted, depth+1)
+			out.WriteString("</blockquote>\n")
+
+		case isListItem(line) && depth < maxDepth:
+			i = renderList(out, lines, i, depth)
+
+		default:
+			i = renderParagraph(out, lines, i, depth)
+		}
+	}
+}
+
+func renderFence(out *strings.Builder, lines []string, start int) int {
+	match := fencePattern.FindStringSubmatch(lines[start])
+	fence := match[1]
+
+	out.WriteString("<pre><code")
+	if languageCharacters.MatchString(match[2]) {
+		out.WriteString(` class="language-` + match[2] + `"`)
+	}
+	out.WriteString(">")
+
+	i := start + 1
+	for ; i < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) && strings.Trim(strings.TrimSpace(lines[i]), fence[:1]) == "" {
+			i++
+			break
+		}
+		out.WriteString(html.EscapeString(lines[i]) + "\n")
+	}
+	out.WriteString("</code></pre>\n")
+	return i
+}
+
+func isListItem(line string) bool {
+	return bulletPattern.MatchString(line) || orderedPattern.MatchString(line)
+}
+
+// Splits a list item line into its indentation, whether it is ordered and its text
+func parseListItem(line string) (int, bool, string) {
+	if match := bulletPattern.FindStringSubmatch(line); match != nil {
+		return len(match[1]), false, match[3]
+	}
+	match := orderedPattern.FindStringSubmatch(line)
+	return len(match[1]), true, match[3]
+}
+
+func renderList(out *strings.Builder, lines []string, start, depth int) int {
+	indent, ordered, _ := parseListItem(lines[start])
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	out.WriteString("<" + tag + ">\n")
+
+	i := start
+	for i < len(lines) {
+		if !isListItem(lines[i]) {
+			break
+		}
+		itemIndent, itemOrdered, text := parseListItem(lines[i])
+		if itemIndent != indent || itemOrdered != ordered {
+			break
+		}
+
+		// Everything indented past the marker belongs to this item, including nested lists
+		body := []string{text}
+		i++
+		for i < len(lines) {
+			next := lines[i]
+			if strings.TrimSpace(next) == "" {
+				if i+1 < len(lines) && leadingSpaces(lines[i+1]) > indent {
+					body = append(body, "")
+					i++
+					continue
+				}
+				break
+			}
+			if leadingSpaces(next) <= indent {
+				break
+			}
+			body = append(body, strings.TrimPrefix(next, strings.Repeat(" ", indent)))
+			i++
+		}
+
+		var item strings.Builder
+		renderBlocks(&item, body, depth+1)
+		rendered := strings.TrimSuffix(item.String(), "\n")
+
+		// Tight items are not wrapped in a paragraph
+		if strings.HasPrefix(rendered, "<p>") && strings.Count(rendered, "<p>") == 1 {
+			rendered = strings.Replace(strings.Replace(rendered, "<p>", "", 1), "</p>", "", 1)
+		}
+		out.WriteString("<li>" + rendered + "</li>\n")
+
+		// A blank line between items of the same list keeps the list going
+		if i < len(lines) && strings.TrimSpace(lines[i]) == "" && i+1 < len(lines) && isListItem(lines[i+1]) {
+			if nextIndent, nextOrdered, _ := parseListItem(lines[i+1]); nextIndent == indent && nextOrdered == ordered {
+				i++
+			}
+		}
+	}
+
+	out.WriteString("</" + tag + ">\n")
+	return i
+}
+
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+func renderParagraph(out *strings.Builder, lines []string, start, depth int) int {
+	var paragraph []string
+	i := start
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			break
+		}
+		// Any other block ends the paragraph
+		if i > start && (fencePattern.MatchString(line) || headingPattern.MatchString(trimmed) ||
+			rulePattern.MatchString(line) || strings.HasPrefix(trimmed, ">") || isListItem(line)) {
+			break
+		}
+		paragraph = append(paragraph, trimmed)
+	}
+
+	out.WriteString("<p>")
+	for j, line := range paragraph {
+		if j > 0 {
+			out.WriteString("<br>\n")
+		}
+		renderInline(out, line, true)
+	}
+	out.WriteString("</p>\n")
+	return i
+}
+
+// Renders emphasis, code spans and links. Nested links are not allowed, so
+// link text is rendered with allowLinks set to false.
+//
+// Every closer is only searched for once: brackets are paired up front, and
+// once a search for a closing delimiter or backtick run fails, later openers
+// of the same kind are known to fail too, since they search a suffix of the
+// same text. This keeps rendering linear on input full of unmatched openers.
+func renderInline(out *strings.Builder, text string, allowLinks bool) {
+	var brackets, parens []int
+	unclosed := map[string]int{}
+	for i := 0; i < len(text); {
+		c := text[i]
+		rest := text[i:]
+
+		switch {
+		case c == '\\' && i+1 < len(text) && isPunctuation(text[i+1]):
+			out.WriteString(html.EscapeString(text[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '`':
+			ticks := len(rest) - len(strings.TrimLeft(rest, "`"))
+			if failed, ok := unclosed[rest[:ticks]]; !ok || i < failed {
+				if end := strings.Index(rest[ticks:], rest[:ticks]); end >= 0 {
+					code := strings.TrimSpace(rest[ticks : ticks+end])
+					out.WriteString("<code>" + html.EscapeString(code) + "</code>")
+					i += ticks + end + ticks
+					continue
+				}
+				unclosed[rest[:ticks]] = i
+			}
+			out.WriteString(html.EscapeString(rest[:ticks]))
+			i += ticks
+			continue
+
+		case c == '[' && allowLinks:
+			if brackets == nil {
+				brackets = matchPairs(text, '[', ']', true)
+				parens = matchPairs(text, '(', ')', false)
+			}
+			if label, target, length, ok := parseLink(text, i, brackets, parens); ok {
+				if href, safe := safeURL(target); safe {
+					out.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer">`)
+					renderInline(out, label, false)
+					out.WriteString("</a>")
+				} else {
+					renderInline(out, label, false)
+				}
+				i += length
+				continue
+			}
+
+		case allowLinks && (strings.HasPrefix(rest, "http://") || strings.HasPrefix(rest, "https://")) && atWordStart(text, i):
+			link := bareLink(rest)
+			if href, safe := safeURL(link); safe && len(link) > len("https://") {
+				escaped := html.EscapeString(href)
+				out.WriteString(`<a href="` + escaped + `" rel="nofollow noopener noreferrer">` + escaped + "</a>")
+				i += len(link)
+				continue
+			}
+			// Not a usable link, and neither is anything that starts inside it
+			out.WriteString(html.EscapeString(link))
+			i += len(link)
+			continue
+
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__"):
+			if inner, length, ok := delimited(text, i, rest[:2], unclosed); ok {
+				out.WriteString("<strong>")
+				renderInline(out, inner, allowLinks)
+				out.WriteString("</strong>")
+				i += length
+				continue
+			}
+
+		case strings.HasPrefix(rest, "~~"):
+			if inner, length, ok := delimited(text, i, "~~", unclosed); ok {
+				out.WriteString("<del>")
+				renderInline(out, inner, allowLinks)
+				out.WriteString("</del>")
+				i += length
+				continue
+			}
+
+		case c == '*' || c == '_':
+			if inner, length, ok := delimited(text, i, rest[:1], unclosed); ok {
+				out.WriteString("<em>")
+				renderInline(out, inner, allowLinks)
+				out.WriteString("</em>")
+				i += length
+				continue
+			}
+		}
+
+		// Plain text, copied one rune at a time
+		_, size := utf8.DecodeRuneInString(rest)
+		out.WriteString(html.EscapeString(rest[:size]))
+		i += size
+	}
+}
+
+// Finds the closing delimiter for an emphasis run starting at text[start].
+// Returns the enclosed text and the total length consumed. Where the search
+// for each delimiter first failed is kept in unclosed.
+func delimited(text string, start int, delimiter string, unclosed map[string]int) (string, int, bool) {
+	// Underscores inside words, like snake_case, are not emphasis
+	if delimiter[0] == '_' && start > 0 && isWordByte(text[start-1]) {
+		return "", 0, false
+	}
+
+	open := start + len(delimiter)
+	if open >= len(text) || text[open] == ' ' {
+		return "", 0, false
+	}
+	if failed, ok := unclosed[delimiter]; ok && start >= failed {
+		return "", 0, false
+	}
+
+	for j := open + 1; j+len(delimiter) <= len(text); j++ {
+		if text[j-1] == '\\' || !strings.HasPrefix(text[j:], delimiter) || text[j-1] == ' ' {
+			continue
+		}
+		after := j + len(delimiter)
+		// A single * or _ must not be part of a double delimiter
+		if len(delimiter) == 1 && after < len(text) && text[after] == delimiter[0] {
+			j++
+			continue
+		}
+		if delimiter[0] == '_' && after < len(text) && isWordByte(text[after]) {
+			continue
+		}
+		return text[open:j], after - start, true
+	}
+	unclosed[delimiter] = start
+	return "", 0, false
+}
+
+// Parses [label](target) starting at text[start], using the bracket and
+// parenthesis pairs found by matchPairs
+func parseLink(text string, start int, brackets, parens []int) (string, string, int, bool) {
+	closeLabel := brackets[start]
+	if closeLabel < 0 || closeLabel+1 >= len(text) || text[closeLabel+1] != '(' {
+		return "", "", 0, false
+	}
+
+	// Parentheses inside the target are allowed as long as they are balanced
+	closeTarget := parens[closeLabel+1]
+	if closeTarget < 0 {
+		return "", "", 0, false
+	}
+	target := strings.TrimSpace(text[closeLabel+2 : closeTarget])
+	return text[start+1 : closeLabel], target, closeTarget + 1 - start, true
+}
+
+// Pairs every opening byte in text with the closing byte that balances it,
+// in a single pass. Returns, for each position, the index of the matching
+// closer, or -1 where there is none. With escapes set, a byte after a
+// backslash is never paired.
+func matchPairs(text string, open, close byte, escapes bool) []int {
+	matches := make([]int, len(text))
+	for j := range matches {
+		matches[j] = -1
+	}
+	var openers []int
+	for j := 0; j < len(text); j++ {
+		switch text[j] {
+		case '\\':
+			if escapes {
+				j++
+			}
+		case open:
+			openers = append(openers, j)
+		case close:
+			if len(openers) > 0 {
+				matches[openers[len(openers)-1]] = j
+				openers = openers[:len(openers)-1]
+			}
+		}
+	}
+	return matches
+}
+
+// Returns the URL at the start of text, without trailing punctuation
+func bareLink(text string) string {
+	end := strings.IndexFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '<' || r == '>' || r == '"'
+	})
+	if end < 0 {
+		end = len(text)
+	}
+	return strings.TrimRight(text[:end], ".,:;!?)]}'*_~")
+}
+
+// Only http, https, mailto and relative links are allowed. Anything else,
+// such as javascript: or data: URLs, is dropped.
+func safeURL(raw string) (string, bool) {
+	if raw == "" {
+		return "", false
+	}
+	for _, r := range raw {
+		if unicode.IsControl(r) || unicode.IsSpace(r) {
+			return "", false
+		}
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https", "mailto":
+		return parsed.String(), true
+	case "":
+		// Relative links must not smuggle a scheme past the parser
+		if strings.Contains(strings.SplitN(raw, "/", 2)[0], ":") {
+			return "", false
+		}
+		return parsed.String(), true
+	}
+	return "", false
+}
+
+func atWordStart(text string, i int) bool {
+	return i == 0 || !isWordByte(text[i-1])
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= 0x80
+}
+
+func isPunctuation(b byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", b) >= 0
+}
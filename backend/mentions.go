@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gshare.com/platform/models"
+)
+
+// An @ that starts a word, followed by a username. Addresses like
+// name@example.com are not mentions because the @ follows a word character.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])(@[\w.-]+)`)
+
+// Finds every @username in the content, whether or not the member exists.
+// Trailing dots and dashes are taken as punctuation, not part of the name.
+func parseMentions(content string) []models.MentionSpan {
+	spans := []models.MentionSpan{}
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		start, end := match[2], match[3]
+		name := strings.TrimRight(content[start+1:end], ".-")
+		if name == "" {
+			continue
+		}
+		end = start + 1 + len(name)
+		runeStart := utf8.RuneCountInString(content[:start])
+		spans = append(spans, models.MentionSpan{
+			Username: name,
+			Start:    runeStart,
+			End:      runeStart + utf8.RuneCountInString(content[start:end]),
+		})
+	}
+	return spans
+}
+
+// Keeps the spans whose username is in the set
+func filterSpans(spans []models.MentionSpan, keep map[string]bool) []models.MentionSpan {
+	kept := []models.MentionSpan{}
+	for _, span := range spans {
+		if keep[span.Username] {
+			kept = append(kept, span)
+		}
+	}
+	return kept
+}
+
+func usernameSet(usernames []string) map[string]bool {
+	set := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		set[username] = true
+	}
+	return set
+}
+
+// Most members a post or comment can mention. Content mentioning more is
+// refused, which also keeps the lookup of who exists to a few variables.
+const maxMentions = 10
+
+var errTooManyMentions = fmt.Errorf("a post or comment can mention at most %d members", maxMentions)
+
+// Distinct usernames mentioned in the content, in the order first mentioned
+func mentionedNames(content string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, span := range parseMentions(content) {
+		if !seen[span.Username] {
+			seen[span.Username] = true
+			names = append(names, span.Username)
+		}
+	}
+	return names
+}
+
+// Refuses content that mentions more than maxMentions members
+func checkMentions(content string) error {
+	if len(mentionedNames(content)) > maxMentions {
+		return errTooManyMentions
+	}
+	return nil
+}
+
+// Usernames mentioned in the content that belong to existing members. Only
+// the first maxMentions names count, for content saved before the limit.
+func mentionedMembers(content string) []string {
+	names := mentionedNames(content)
+	if len(names) == 0 {
+		return names
+	}
+	if len(names) > maxMentions {
+		names = names[:maxMentions]
+	}
+	var members []string
+	db.Model(&models.Member{}).Where("username IN ?", names).Pluck("username", &members)
+	return members
+}
+
+// Brings the mention records of a post or comment in line with its content.
+// Returns the members it mentions, and those mentioned there for the first
+// time.
+func syncMentions(targetType, targetId, content string, now time.Time) ([]string, []string, error) {
+	members := mentionedMembers(content)
+	var newlyMentioned []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&models.Mention{}).Where("target_type = ? AND target_id = ?", targetType, targetId)
+		if len(members) > 0 {
+			query = query.Where("username NOT IN ?", members)
+		}
+		if err := query.Update("removed", true).Error; err != nil {
+			return err
+		}
+
+		for _, username := range members {
+			mention := models.Mention{TargetType: targetType, TargetID: targetId, Username: username, CreatedAt: now}
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&mention)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				newlyMentioned = append(newlyMentioned, username)
+				continue
+			}
+			if err := tx.Model(&models.Mention{}).
+				Where("target_type = ? AND target_id = ? AND username = ?", targetType, targetId, username).
+				Update("removed", false).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return members, newlyMentioned, err
+}
+
+// Records the mentions of a published post, sets its mention spans and
+// notifies the members it mentions for the first time. Drafts mention no one
+// until they are published.
+func recordPostMentions(post *models.Post) error {
+	post.Mentions = []models.MentionSpan{}
+	if post.Draft {
+		return nil
+	}
+	members, newlyMentioned, err := syncMentions(models.MentionInPost, post.PostId, post.Content, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	post.Mentions = filterSpans(parseMentions(post.Content), usernameSet(members))
+	for _, username := range newlyMentioned {
+		if username != post.Author {
+			title := "You were mentioned in a post"
+			content := fmt.Sprintf("%s mentioned you in %s", post.Author, post.Title)
+			sendAutoNotification(username, title, content)
+		}
+	}
+	return nil
+}
+
+// Records the mentions of a comment, sets its mention spans and notifies the
+// members it mentions for the first time
+func recordCommentMentions(comment *models.Comment, post models.Post) error {
+	comment.Mentions = []models.MentionSpan{}
+	members, newlyMentioned, err := syncMentions(models.MentionInComment, comment.CommentId, comment.Content, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	comment.Mentions = filterSpans(parseMentions(comment.Content), usernameSet(members))
+	for _, username := range newlyMentioned {
+		if username != comment.Author {
+			title := "You were mentioned in a comment"
+			content := fmt.Sprintf("%s mentioned you on %s: %s", comment.Author, post.Title, comment.Content)
+			sendAutoNotification(username, title, content)
+		}
+	}
+	return nil
+}
+
+// Current mentions of the given posts or comments, by target ID
+func activeMentions(targetType string, targetIds []string) map[string]map[string]bool {
+	var mentions []models.Mention
+	db.Where("target_type = ? AND target_id IN ? AND removed = ?", targetType, targetIds, false).Find(&mentions)
+	byTarget := map[string]map[string]bool{}
+	for _, mention := range mentions {
+		if byTarget[mention.TargetID] == nil {
+			byTarget[mention.TargetID] = map[string]bool{}
+		}
+		byTarget[mention.TargetID][mention.Username] = true
+	}
+	return byTarget
+}
+
+// Sets the mention spans of posts
+func attachPostMentions(posts []models.Post) {
+	if len(posts) == 0 {
+		return
+	}
+	postIds := make([]string, len(posts))
+	for i, post := range posts {
+		postIds[i] = post.PostId
+	}
+	mentions := activeMentions(models.MentionInPost, postIds)
+	for i := range posts {
+		posts[i].Mentions = filterSpans(parseMentions(posts[i].Content), mentions[posts[i].PostId])
+	}
+}
+
+// Sets the mention spans of comments
+func attachCommentMentions(comments []models.Comment) {
+	if len(comments) == 0 {
+		return
+	}
+	commentIds := make([]string, len(comments))
+	for i, comment := range comments {
+		commentIds[i] = comment.CommentId
+	}
+	mentions := activeMentions(models.MentionInComment, commentIds)
+	for i := range comments {
+		comments[i].Mentions = filterSpans(parseMentions(comments[i].Content), mentions[comments[i].CommentId])
+	}
+}
+
+// Removes the mention records of deleted posts or comments
+func deleteMentions(tx *gorm.DB, targetType string, targetIds []string) error {
+	return tx.Where("target_type = ? AND target_id IN ?", targetType, targetIds).Delete(&models.Mention{}).Error
+}
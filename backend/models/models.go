@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"time"
+
+	"gorm.io/gorm"
+	"gshare.com/platform/markdown"
 )
 
 type Member struct {
@@ -16,19 +19,26 @@ type Member struct {
 	Bio          string `json:"bio"`
 	SessionToken string `json:"session_token"`
 	CSRFToken    string `json:"csrf_token"`
+	Moderator    bool   `json:"moderator"`
+
+	// Aggregated from visible ratings, not stored
+	RatingAverage float64 `json:"rating_average" gorm:"-"`
+	RatingCount   int64   `json:"rating_count" gorm:"-"`
 
 	// Relationships
-	LikedPosts       []*Post    `gorm:"many2many:member_likes;" json:"liked_posts"`
-	DislikedPosts    []*Post    `gorm:"many2many:member_dislikes;" json:"disliked_posts"`
-	LikedComments    []*Comment `gorm:"many2many:member_comment_likes;" json:"liked_comments"`
-	DislikedComments []*Comment `gorm:"many2many:member_comment_dislikes;" json:"disliked_comments"`
-	Followers        []*Member  `gorm:"many2many:member_followers;joinForeignKey:username;joinReferences:follower_username" json:"followers"`
-	Following        []*Member  `gorm:"many2many:member_followers;joinForeignKey:follower_username;joinReferences:username" json:"following"`
+	Followers []*Member `gorm:"many2many:member_followers;joinForeignKey:username;joinReferences:follower_username" json:"followers"`
+	Following []*Member `gorm:"many2many:member_followers;joinForeignKey:follower_username;joinReferences:username" json:"following"`
 }
 
 type StringArray []string
 
 func (sa *StringArray) Scan(value interface{}) error {
+	// Columns added after a row was written are NULL
+	if value == nil {
+		*sa = nil
+		return nil
+	}
+
 	bytes, ok := value.([]byte)
 	if !ok {
 		return errors.New("Failed to unmarshal StringArray value")
@@ -45,34 +55,412 @@ func (sa StringArray) Value() (driver.Value, error) {
 }
 
 type Post struct {
-	PostId    string `json:"post_id" gorm:"primaryKey"`
-	CreatedAt time.Time
-	Author    string      `json:"author"`
-	Title     string      `json:"title"`
-	Content   string      `json:"content"`
-	Likes     int         `json:"likes"`
-	Dislikes  int         `json:"dislikes"`
-	Views     int         `json:"views"`
-	Comments  []Comment   `json:"comments" gorm:"foreignKey:PostID;references:PostId"`
-	Images    StringArray `json:"images" gorm:"type:text"`
+	PostId       string      `json:"post_id" gorm:"primaryKey"`
+	CreatedAt    time.Time   `gorm:"index:idx_post_author_created,priority:2"`
+	Author       string      `json:"author" gorm:"index:idx_post_author_created,priority:1"`
+	Title        string      `json:"title"`
+	Content      string      `json:"content"`
+	ContentHTML  string      `json:"content_html" gorm:"-"`
+	ContentHash  string      `json:"-" gorm:"index"`
+	Likes        int         `json:"likes"`
+	Dislikes     int         `json:"dislikes"`
+	Views        int         `json:"views"`
+	Comments     []Comment   `json:"comments" gorm:"foreignKey:PostID;references:PostId"`
+	Images       StringArray `json:"images" gorm:"type:text"`
+	ImageDetails []Image     `json:"image_details" gorm:"-"`
+	Status       string      `json:"status" gorm:"default:open"`
+	ResolvedAt   *time.Time  `json:"resolved_at"`
+	Draft        bool        `json:"draft" gorm:"default:false;index"`
+	PublishAt    *time.Time  `json:"publish_at"`
+	ExpiresAt    *time.Time  `json:"expires_at" gorm:"index"`
+	Building     string      `json:"building" gorm:"index"`
+	Latitude     *float64    `json:"latitude" gorm:"index:idx_post_location"`
+	Longitude    *float64    `json:"longitude" gorm:"index:idx_post_location"`
+	Edited       bool        `json:"edited"`
+	EditedAt     *time.Time  `json:"edited_at"`
+	HotScore     float64     `json:"hot_score" gorm:"index"`
+	RisingScore  float64     `json:"-" gorm:"index"`
+	Bookmarked   bool        `json:"bookmarked" gorm:"-"`
+	Category     string      `json:"category" gorm:"index"`
+	Pinned       bool        `json:"pinned" gorm:"-"`
+
+	// Files attached to the post, listed by ID like its images
+	Attachments       StringArray  `json:"attachments" gorm:"type:text"`
+	AttachmentDetails []Attachment `json:"attachment_details" gorm:"-"`
+
+	// Where the content mentions members with @username
+	Mentions []MentionSpan `json:"mentions" gorm:"-"`
+
+	// Posts are loaded with the first page of their comments. CommentCount
+	// counts every comment, replies included.
+	CommentCount       int64  `json:"comment_count" gorm:"-"`
+	CommentsNextCursor string `json:"comments_next_cursor" gorm:"-"`
+
+	// Quote posts embed the post they quote, as it currently reads.
+	// QuoteRevision is the revision that was quoted, and QuoteUnavailable
+	// is set once the quoted post has been deleted.
+	QuoteOf          *string `json:"quote_of" gorm:"index"`
+	QuoteRevision    int     `json:"quote_revision"`
+	Quoted           *Post   `json:"quoted,omitempty" gorm:"-"`
+	QuoteUnavailable bool    `json:"quote_unavailable" gorm:"-"`
+	Reposts          int     `json:"reposts"`
+	Quotes           int     `json:"quotes"`
+
+	// The top-level comment the author accepted as the answer, which leads
+	// the post's comments
+	AcceptedCommentID *string    `json:"accepted_comment_id" gorm:"index"`
+	AcceptedAt        *time.Time `json:"accepted_at"`
+
+	// Set on feed entries that are there because a followed member reposted them
+	RepostedBy string     `json:"reposted_by,omitempty" gorm:"-"`
+	RepostedAt *time.Time `json:"reposted_at,omitempty" gorm:"-"`
+
+	// Deleted posts are hidden but kept until the retention window for
+	// restoring them has passed
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
-	LikedByMembers    []*Member `gorm:"many2many:member_likes;" json:"liked_by_members"`
-	DislikedByMembers []*Member `gorm:"many2many:member_dislikes;" json:"disliked_by_members"`
+	Assignments []Assignment `json:"assignments" gorm:"foreignKey:PostID;references:PostId"`
+	Poll        *Poll        `json:"poll,omitempty" gorm:"foreignKey:PostID;references:PostId"`
+}
+
+// Content is stored as Markdown and rendered to sanitized HTML whenever a
+// post is loaded or saved
+func (p *Post) AfterFind(tx *gorm.DB) error {
+	p.ContentHTML = markdown.ToHTML(p.Content)
+	return nil
+}
+
+func (p *Post) AfterSave(tx *gorm.DB) error {
+	p.ContentHTML = markdown.ToHTML(p.Content)
+	return nil
+}
+
+// Post statuses
+const (
+	PostStatusOpen     = "open"
+	PostStatusResolved = "resolved"
+	PostStatusExpired  = "expired"
+)
+
+// Assignment records a member volunteering to help with a post. The post's
+// author accepts volunteers, which turns them into assigned helpers.
+type Assignment struct {
+	AssignmentId string `json:"assignment_id" gorm:"primaryKey"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	PostID       string `json:"post_id" gorm:"uniqueIndex:idx_assignment_post_helper"`
+	Helper       string `json:"helper" gorm:"uniqueIndex:idx_assignment_post_helper"`
+	Status       string `json:"status"`
+}
+
+// Assignment statuses
+const (
+	AssignmentVolunteered = "volunteered"
+	AssignmentAccepted    = "accepted"
+)
+
+// PostView remembers when a viewer last counted as a view of a post, so
+// refreshes within the dedup window are not counted again. Viewer is a
+// username, or a fingerprint of the client for anonymous visitors.
+type PostView struct {
+	PostID   string    `json:"post_id" gorm:"primaryKey"`
+	Viewer   string    `json:"viewer" gorm:"primaryKey"`
+	ViewedAt time.Time `json:"viewed_at" gorm:"index"`
+}
+
+// PostViewDay is the number of counted views of a post on one UTC day
+type PostViewDay struct {
+	PostID string `json:"post_id" gorm:"primaryKey"`
+	Day    string `json:"day" gorm:"primaryKey"` // YYYY-MM-DD
+	Views  int    `json:"views"`
+}
+
+// Image is an uploaded picture kept in the blob store. Its ID is the SHA-256
+// of the content, so uploading the same file twice yields the same image.
+type Image struct {
+	ImageId     string `json:"image_id" gorm:"primaryKey"`
+	CreatedAt   time.Time
+	Uploader    string `json:"uploader"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	AltText     string `json:"alt_text" gorm:"-"`
+	Caption     string `json:"caption" gorm:"-"`
+}
+
+// ImageDescription is the alt text and caption a member gave an image they
+// uploaded. Identical uploads share one Image, so each uploader describes it
+// separately.
+type ImageDescription struct {
+	ImageID  string `json:"image_id" gorm:"primaryKey"`
+	Uploader string `json:"uploader" gorm:"primaryKey;index"`
+	AltText  string `json:"alt_text"`
+	Caption  string `json:"caption"`
+}
+
+// PostRevision is a snapshot of a post's title, content and images, taken
+// every time the post is created, edited or restored.
+type PostRevision struct {
+	RevisionId string `json:"revision_id" gorm:"primaryKey"`
+	PostID     string `json:"post_id" gorm:"uniqueIndex:idx_post_revision"`
+	Revision   int    `json:"revision" gorm:"uniqueIndex:idx_post_revision"`
+	CreatedAt  time.Time
+	Editor     string      `json:"editor"`
+	Title      string      `json:"title"`
+	Content    string      `json:"content"`
+	Images     StringArray `json:"images" gorm:"type:text"`
 }
 
 type Comment struct {
-	CommentId string `json:"comment_id" gorm:"primaryKey"`
-	PostID    string `json:"post_id" gorm:"index"`
+	CommentId   string `json:"comment_id" gorm:"primaryKey"`
+	PostID      string `json:"post_id" gorm:"index"`
+	CreatedAt   time.Time
+	Author      string `json:"author"`
+	Content     string `json:"content"`
+	ContentHTML string `json:"content_html" gorm:"-"`
+	Likes       int    `json:"likes"`
+	Dislikes    int    `json:"dislikes"`
+	Bookmarked  bool   `json:"bookmarked" gorm:"-"`
+	Accepted    bool   `json:"accepted" gorm:"-"`
+
+	// EditedAt is set once the author changes the content after posting
+	UpdatedAt time.Time
+	Edited    bool       `json:"edited"`
+	EditedAt  *time.Time `json:"edited_at"`
+
+	// Lower bound of the comment's approval, which the best sort orders by
+	BestScore float64 `json:"-" gorm:"index"`
+
+	// Where the content mentions members with @username
+	Mentions []MentionSpan `json:"mentions" gorm:"-"`
+
+	// Replies point at the comment they answer; top-level comments have no
+	// parent and a depth of zero. ReplyCount is the number of direct replies,
+	// which may be more than Replies holds when a thread is cut off.
+	ParentID   *string   `json:"parent_id" gorm:"index"`
+	Depth      int       `json:"depth"`
+	Replies    []Comment `json:"replies" gorm:"-"`
+	ReplyCount int       `json:"reply_count" gorm:"-"`
+
+	// Deleted comments are hidden like deleted posts. A comment deleted while
+	// it has replies stays in its thread as a tombstone reading "[removed]"
+	// instead, its text kept in its revisions until it can no longer be
+	// restored.
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	RemovedAt *time.Time     `json:"removed_at"`
+}
+
+// CommentRevision is the text of a comment before or after an edit. Comments
+// get their first revision, the text as posted, when they are first edited
+// or reported.
+type CommentRevision struct {
+	RevisionId string `json:"revision_id" gorm:"primaryKey"`
+	CommentID  string `json:"comment_id" gorm:"uniqueIndex:idx_comment_revision"`
+	Revision   int    `json:"revision" gorm:"uniqueIndex:idx_comment_revision"`
+	CreatedAt  time.Time
+	Content    string `json:"content"`
+}
+
+// CommentReport is a member flagging a comment to the moderators. Revision is
+// the revision of the comment that was reported, so moderators see what was
+// reported even if the comment is edited afterwards.
+type CommentReport struct {
+	ReportId  string `json:"report_id" gorm:"primaryKey"`
+	CommentID string `json:"comment_id" gorm:"uniqueIndex:idx_comment_report"`
+	Reporter  string `json:"reporter" gorm:"uniqueIndex:idx_comment_report;index"`
 	CreatedAt time.Time
-	Author    string `json:"author"`
-	Content   string `json:"content"`
-	Likes     int    `json:"likes"`
-	Dislikes  int    `json:"dislikes"`
+	Reason    string `json:"reason"`
+	Revision  int    `json:"revision"`
+}
 
-	// Relationships
-	LikedByMembers    []*Member `gorm:"many2many:member_comment_likes;" json:"liked_comments"`
-	DislikedByMembers []*Member `gorm:"many2many:member_comment_dislikes;" json:"disliked_comments"`
+// Attachment is a non-image file, such as a PDF of notes, shared with posts.
+// Its type is sniffed from the content on upload and it is always served as
+// a download.
+type Attachment struct {
+	AttachmentId string `json:"attachment_id" gorm:"primaryKey"`
+	CreatedAt    time.Time
+	Uploader     string `json:"uploader" gorm:"index"`
+	FileName     string `json:"file_name"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	SHA256       string `json:"sha256"`
+}
+
+// Poll is an optional question attached to a post. Results can be hidden
+// from a member until they vote or the poll closes.
+type Poll struct {
+	PollId         string `json:"poll_id" gorm:"primaryKey"`
+	PostID         string `json:"post_id" gorm:"uniqueIndex"`
+	CreatedAt      time.Time
+	Question       string       `json:"question"`
+	MultipleChoice bool         `json:"multiple_choice"`
+	ClosesAt       *time.Time   `json:"closes_at"`
+	HideResults    bool         `json:"hide_results"`
+	Options        []PollOption `json:"options" gorm:"foreignKey:PollID;references:PollId"`
+
+	// Filled in for the member viewing the poll, not stored
+	Closed         bool     `json:"closed" gorm:"-"`
+	ResultsVisible bool     `json:"results_visible" gorm:"-"`
+	TotalVoters    *int64   `json:"total_voters" gorm:"-"`
+	MyChoices      []string `json:"my_choices" gorm:"-"`
+}
+
+type PollOption struct {
+	OptionId string `json:"option_id" gorm:"primaryKey"`
+	PollID   string `json:"poll_id" gorm:"index"`
+	Position int    `json:"position"`
+	Text     string `json:"text"`
+	Votes    *int64 `json:"votes" gorm:"-"` // nil while results are hidden
+}
+
+// PollBallot is a member's vote on a poll. Its primary key is what limits
+// members to voting once; the options they picked are PollChoices.
+type PollBallot struct {
+	PollID    string `json:"poll_id" gorm:"primaryKey"`
+	Voter     string `json:"voter" gorm:"primaryKey"`
+	CreatedAt time.Time
+}
+
+type PollChoice struct {
+	PollID   string `json:"poll_id" gorm:"primaryKey"`
+	Voter    string `json:"voter" gorm:"primaryKey"`
+	OptionID string `json:"option_id" gorm:"primaryKey;index"`
+}
+
+// Building is a campus building posts can be placed at, seeded at startup
+type Building struct {
+	BuildingId string  `json:"building_id" gorm:"primaryKey"`
+	Name       string  `json:"name"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+}
+
+// Bookmark is a post or comment a member saved to come back to later. It
+// can be filed into one of the member's collections, where Position orders it.
+type Bookmark struct {
+	BookmarkId   string `json:"bookmark_id" gorm:"primaryKey"`
+	CreatedAt    time.Time
+	Owner        string   `json:"owner" gorm:"uniqueIndex:idx_bookmark_owner_target"`
+	TargetType   string   `json:"target_type" gorm:"uniqueIndex:idx_bookmark_owner_target;index:idx_bookmark_target"`
+	TargetID     string   `json:"target_id" gorm:"uniqueIndex:idx_bookmark_owner_target;index:idx_bookmark_target"`
+	CollectionID *string  `json:"collection_id" gorm:"index"`
+	Position     int      `json:"position"`
+	Post         *Post    `json:"post,omitempty" gorm:"-"`
+	Comment      *Comment `json:"comment,omitempty" gorm:"-"`
+}
+
+// What a bookmark points at
+const (
+	BookmarkTargetPost    = "post"
+	BookmarkTargetComment = "comment"
+)
+
+// Vote is a member's like or dislike of a post or comment. A member has at
+// most one vote on each target; the likes and dislikes counters of posts and
+// comments are kept in step with these rows.
+type Vote struct {
+	Member     string `json:"member" gorm:"primaryKey"`
+	TargetType string `json:"target_type" gorm:"primaryKey;index:idx_vote_target"`
+	TargetID   string `json:"target_id" gorm:"primaryKey;index:idx_vote_target"`
+	Value      int    `json:"value"`
+	CreatedAt  time.Time
+}
+
+// What a vote is on, and which way it goes
+const (
+	VoteTargetPost    = "post"
+	VoteTargetComment = "comment"
+	VoteLike          = 1
+	VoteDislike       = -1
+)
+
+// Mention records that a post or comment mentions a member with @username.
+// Records are kept when an edit drops the mention, marked removed, so that
+// members are only notified the first time they are mentioned.
+type Mention struct {
+	TargetType string `json:"target_type" gorm:"primaryKey"`
+	TargetID   string `json:"target_id" gorm:"primaryKey"`
+	Username   string `json:"username" gorm:"primaryKey;index"`
+	CreatedAt  time.Time
+	Removed    bool `json:"removed"`
+}
+
+// Where a mention was made
+const (
+	MentionInPost    = "post"
+	MentionInComment = "comment"
+)
+
+// MentionSpan locates a mention in a post's or comment's content. Start and
+// End count characters (Unicode code points), End exclusive, and cover the @.
+type MentionSpan struct {
+	Username string `json:"username"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// Repost shares a post with the reposting member's followers, who see it in
+// their feeds. Members repost a post at most once.
+type Repost struct {
+	RepostId  string    `json:"repost_id" gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index"`
+	PostID    string    `json:"post_id" gorm:"uniqueIndex:idx_repost_post_member"`
+	Member    string    `json:"member" gorm:"uniqueIndex:idx_repost_post_member;index"`
+}
+
+// Pin keeps a post at the top of a listing. Moderators pin posts to the top
+// of all posts or of a category; members pin their own posts on their
+// profile. A pin without an expiry stays until it is removed.
+type Pin struct {
+	PinId     string `json:"pin_id" gorm:"primaryKey"`
+	CreatedAt time.Time
+	PostID    string     `json:"post_id" gorm:"uniqueIndex:idx_pin_post_scope"`
+	Scope     string     `json:"scope" gorm:"uniqueIndex:idx_pin_post_scope;index:idx_pin_scope"`
+	Category  string     `json:"category" gorm:"index:idx_pin_scope"`
+	PinnedBy  string     `json:"pinned_by"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Where a post is pinned
+const (
+	PinScopeGlobal   = "global"
+	PinScopeCategory = "category"
+	PinScopeProfile  = "profile"
+)
+
+// Collection is a named group of a member's bookmarks
+type Collection struct {
+	CollectionId string `json:"collection_id" gorm:"primaryKey"`
+	CreatedAt    time.Time
+	Owner        string `json:"owner" gorm:"uniqueIndex:idx_collection_owner_name"`
+	Name         string `json:"name" gorm:"uniqueIndex:idx_collection_owner_name"`
+	ItemCount    int64  `json:"item_count" gorm:"-"`
+}
+
+// Rating is the feedback one participant of a resolved post leaves for
+// another. It stays hidden until VisibleAt, which is pulled forward to the
+// moment both sides have rated each other.
+type Rating struct {
+	RatingId  string `json:"rating_id" gorm:"primaryKey"`
+	CreatedAt time.Time
+	PostID    string    `json:"post_id" gorm:"uniqueIndex:idx_rating_post_rater_ratee"`
+	Rater     string    `json:"rater" gorm:"uniqueIndex:idx_rating_post_rater_ratee"`
+	Ratee     string    `json:"ratee" gorm:"uniqueIndex:idx_rating_post_rater_ratee;index"`
+	Score     int       `json:"score"`
+	Review    string    `json:"review"`
+	VisibleAt time.Time `json:"visible_at" gorm:"index"`
+}
+
+func (c *Comment) AfterFind(tx *gorm.DB) error {
+	c.ContentHTML = markdown.ToHTML(c.Content)
+	return nil
+}
+
+func (c *Comment) AfterSave(tx *gorm.DB) error {
+	c.ContentHTML = markdown.ToHTML(c.Content)
+	return nil
 }
 
 type Notification struct {
@@ -90,4 +478,14 @@ type SearchQuery struct {
 	Limit     int    `form:"limit"`
 	Offset    int    `form:"offset"`
 	SearchKey string `form:"search_key"`
+	Period    string `form:"period"`
+
+	IncludeExpired bool   `form:"include_expired"`
+	Category       string `form:"category"`
+
+	// Location filters: a building, or a radius in meters around a point
+	Building string   `form:"building"`
+	Lat      *float64 `form:"lat"`
+	Lng      *float64 `form:"lng"`
+	Radius   float64  `form:"radius"`
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Page sizes of cursor-paginated listings
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Cursors point just past the last item of a page, identified by its
+// timestamp and ID so that items sharing a timestamp are neither skipped
+// nor repeated. They are opaque to clients.
+func encodeCursor(at time.Time, id string) string {
+	raw := strconv.FormatInt(at.UnixNano(), 10) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return time.Time{}, "", errInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, "", errInvalidCursor
+	}
+	return time.Unix(0, n).UTC(), id, nil
+}
+
+// Scope that continues a newest-first listing after the cursor. The columns
+// are the timestamp and ID the listing is ordered by.
+func afterCursor(timeColumn, idColumn, cursor string) (func(*gorm.DB) *gorm.DB, error) {
+	if cursor == "" {
+		return func(db *gorm.DB) *gorm.DB { return db }, nil
+	}
+	at, id, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(timeColumn+" < ? OR ("+timeColumn+" = ? AND "+idColumn+" < ?)", at, at, id)
+	}, nil
+}
+
+// Cursors of listings ordered by a score rather than a time
+func encodeScoreCursor(score float64, id string) string {
+	raw := strconv.FormatFloat(score, 'g', -1, 64) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeScoreCursor(cursor string) (float64, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", errInvalidCursor
+	}
+	value, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return 0, "", errInvalidCursor
+	}
+	score, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, "", errInvalidCursor
+	}
+	return score, id, nil
+}
+
+// Scope that continues an oldest-first listing after the cursor
+func afterCursorAsc(timeColumn, idColumn, cursor string) (func(*gorm.DB) *gorm.DB, error) {
+	if cursor == "" {
+		return func(db *gorm.DB) *gorm.DB { return db }, nil
+	}
+	at, id, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(timeColumn+" > ? OR ("+timeColumn+" = ? AND "+idColumn+" > ?)", at, at, id)
+	}, nil
+}
+
+// Scope that continues a highest-first listing by score after the cursor
+func afterScoreCursor(scoreColumn, idColumn, cursor string) (func(*gorm.DB) *gorm.DB, error) {
+	if cursor == "" {
+		return func(db *gorm.DB) *gorm.DB { return db }, nil
+	}
+	score, id, err := decodeScoreCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(scoreColumn+" < ? OR ("+scoreColumn+" = ? AND "+idColumn+" < ?)", score, score, id)
+	}, nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gshare.com/platform/models"
+)
+
+// Categories a post can be filed under. Posts without one are uncategorized.
+var postCategories = []string{"announcements", "events", "housing", "lost-and-found", "marketplace", "rides", "study", "tutoring"}
+
+// Members can pin this many of their own posts on their profile
+const maxProfilePins = 3
+
+var (
+	errUnknownCategory = fmt.Errorf("category must be one of %v", postCategories)
+	errPinScope        = errors.New("scope must be global, category or profile")
+	errPinExpiry       = errors.New("pin expiry must be in the future")
+	errNoCategory      = errors.New("the post has no category to be pinned in")
+	errTooManyPins     = fmt.Errorf("you can pin at most %d posts on your profile", maxProfilePins)
+	errNotPinned       = errors.New("the post is not pinned there")
+)
+
+// Checks that a post's category, if it has one, is a known category
+func validateCategory(category string) error {
+	if category != "" && !slices.Contains(postCategories, category) {
+		return errUnknownCategory
+	}
+	return nil
+}
+
+// Filters pins down to those that have not expired
+func activePins(now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("pins.expires_at IS NULL OR pins.expires_at > ?", now.UTC())
+	}
+}
+
+// Reports whether a member may pin or unpin a post in a scope: moderators
+// pin globally and in categories, authors on their own profile
+func canPin(post models.Post, scope, username string) bool {
+	if scope == models.PinScopeProfile {
+		return post.Author == username
+	}
+	return isModerator(username)
+}
+
+// Pins a post, or moves the expiry of an existing pin. Global and category
+// pins are up to moderators; profile pins are limited per member.
+func savePin(post models.Post, scope, pinnedBy string, expiresAt *time.Time, now time.Time) (models.Pin, error) {
+	if expiresAt != nil && !expiresAt.After(now) {
+		return models.Pin{}, errPinExpiry
+	}
+
+	pin := models.Pin{
+		PinId:     uuid.New().String(),
+		CreatedAt: now,
+		PostID:    post.PostId,
+		Scope:     scope,
+		PinnedBy:  pinnedBy,
+		ExpiresAt: utcTime(expiresAt),
+	}
+	switch scope {
+	case models.PinScopeGlobal:
+	case models.PinScopeCategory:
+		if post.Category == "" {
+			return models.Pin{}, errNoCategory
+		}
+		pin.Category = post.Category
+	case models.PinScopeProfile:
+	default:
+		return models.Pin{}, errPinScope
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var existing models.Pin
+		if tx.First(&existing, "post_id = ? AND scope = ?", post.PostId, scope).Error == nil {
+			pin.PinId = existing.PinId
+			pin.CreatedAt = existing.CreatedAt
+			return tx.Model(&existing).Updates(map[string]any{
+				"category":   pin.Category,
+				"pinned_by":  pin.PinnedBy,
+				"expires_at": pin.ExpiresAt,
+			}).Error
+		}
+
+		if scope == models.PinScopeProfile {
+			var pinned int64
+			if err := tx.Model(&models.Pin{}).Scopes(activePins(now)).
+				Where("scope = ? AND post_id IN (?)", scope, tx.Model(&models.Post{}).Select("post_id").Where("author = ?", post.Author)).
+				Count(&pinned).Error; err != nil {
+				return err
+			}
+			if pinned >= maxProfilePins {
+				return errTooManyPins
+			}
+		}
+		return tx.Create(&pin).Error
+	})
+	if err != nil {
+		return models.Pin{}, err
+	}
+	return pin, nil
+}
+
+// Removes a pin of a post
+func removePin(postId, scope string) error {
+	result := db.Where("post_id = ? AND scope = ?", postId, scope).Delete(&models.Pin{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errNotPinned
+	}
+	return nil
+}
+
+// IDs of the posts pinned to the top of all posts, followed by those pinned
+// in the category if one is given. Within each, the latest pin comes first.
+func pinnedPostIds(category string, now time.Time) []string {
+	where := db.Where("scope = ?", models.PinScopeGlobal)
+	if category != "" {
+		where = where.Or("scope = ? AND category = ?", models.PinScopeCategory, category)
+	}
+	var pins []models.Pin
+	db.Scopes(activePins(now)).Where(where).Order("created_at desc").Find(&pins)
+
+	slices.SortStableFunc(pins, func(a, b models.Pin) int {
+		if a.Scope == b.Scope {
+			return 0
+		}
+		if a.Scope == models.PinScopeGlobal {
+			return -1
+		}
+		return 1
+	})
+	postIds := []string{}
+	for _, pin := range pins {
+		if !slices.Contains(postIds, pin.PostID) {
+			postIds = append(postIds, pin.PostID)
+		}
+	}
+	return postIds
+}
+
+// IDs of the posts a member pinned on their profile, latest pin first
+func profilePinnedPostIds(author string, now time.Time) []string {
+	var postIds []string
+	db.Model(&models.Pin{}).Scopes(activePins(now)).
+		Where("scope = ? AND post_id IN (?)", models.PinScopeProfile, db.Model(&models.Post{}).Select("post_id").Where("author = ?", author)).
+		Order("created_at desc").
+		Pluck("post_id", &postIds)
+	return postIds
+}
+
+// Loads pinned posts through the given query, in pin order, leaving out any
+// the query filters away
+func loadPinnedPosts(query *gorm.DB, postIds []string) ([]models.Post, error) {
+	pinned := []models.Post{}
+	if len(postIds) == 0 {
+		return pinned, nil
+	}
+	var posts []models.Post
+	if err := query.Where("posts.post_id IN ?", postIds).Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	for _, postId := range postIds {
+		for _, post := range posts {
+			if post.PostId == postId {
+				post.Pinned = true
+				pinned = append(pinned, post)
+			}
+		}
+	}
+	return pinned, nil
+}
+
+// Scope leaving the given posts out of a listing
+func excludingPosts(postIds []string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(postIds) == 0 {
+			return db
+		}
+		return db.Where("posts.post_id NOT IN ?", postIds)
+	}
+}
+
+// Splits a page of a listing that starts with its pinned posts into the
+// pinned posts on the page and the offset and limit of the remaining posts.
+// As in getPosts, -1 stands for no offset or no limit.
+func pinnedPage(pinned []models.Post, offset, limit int) ([]models.Post, int, int) {
+	offset = max(offset, 0)
+	start := min(offset, len(pinned))
+	end := len(pinned)
+	if limit >= 0 {
+		end = max(start, min(end, offset+limit))
+	}
+	page := pinned[start:end]
+
+	restOffset := offset - len(pinned)
+	if restOffset <= 0 {
+		restOffset = -1
+	}
+	restLimit := limit
+	if limit >= 0 {
+		restLimit = limit - len(page)
+	}
+	return page, restOffset, restLimit
+}
+
+// Removes every pin of a post
+func deletePinsOfPost(tx *gorm.DB, postId string) error {
+	return tx.Where("post_id = ?", postId).Delete(&models.Pin{}).Error
+}
+
+// Forgets pins that have expired
+func pruneExpiredPins(now time.Time) error {
+	return db.Where("expires_at IS NOT NULL AND expires_at <= ?", now.UTC()).Delete(&models.Pin{}).Error
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gshare.com/platform/models"
+)
+
+// Limits on the size of a poll
+const (
+	minPollOptions        = 2
+	maxPollOptions        = 10
+	maxPollQuestionLength = 200
+	maxPollOptionLength   = 100
+)
+
+var (
+	errPollQuestion  = fmt.Errorf("a poll needs a question of at most %d characters", maxPollQuestionLength)
+	errPollOptions   = fmt.Errorf("a poll needs between %d and %d distinct options of at most %d characters", minPollOptions, maxPollOptions, maxPollOptionLength)
+	errPollClosesAt  = errors.New("poll close time must be in the future")
+	errPollClosed    = errors.New("the poll is closed")
+	errAlreadyVoted  = errors.New("you have already voted on this poll")
+	errInvalidChoice = errors.New("pick one of the poll's options, or several if it allows multiple choices")
+)
+
+// Validates a poll submitted with a new post and assigns its IDs
+func preparePoll(poll *models.Poll, postId string, now time.Time) error {
+	poll.Question = strings.TrimSpace(poll.Question)
+	if poll.Question == "" || len(poll.Question) > maxPollQuestionLength {
+		return errPollQuestion
+	}
+	if poll.ClosesAt != nil && !poll.ClosesAt.After(now) {
+		return errPollClosesAt
+	}
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		return errPollOptions
+	}
+
+	seen := map[string]bool{}
+	poll.PollId = uuid.New().String()
+	poll.PostID = postId
+	for i := range poll.Options {
+		option := &poll.Options[i]
+		option.Text = strings.TrimSpace(option.Text)
+		if option.Text == "" || len(option.Text) > maxPollOptionLength || seen[option.Text] {
+			return errPollOptions
+		}
+		seen[option.Text] = true
+		option.OptionId = uuid.New().String()
+		option.PollID = poll.PollId
+		option.Position = i
+		option.Votes = nil
+	}
+	return nil
+}
+
+// Records a member's vote. The ballot's primary key makes a second vote fail
+// even when two requests race.
+func castPollVote(poll models.Poll, voter string, optionIds []string, now time.Time) error {
+	if poll.ClosesAt != nil && !poll.ClosesAt.After(now) {
+		return errPollClosed
+	}
+	if len(optionIds) == 0 || (!poll.MultipleChoice && len(optionIds) > 1) {
+		return errInvalidChoice
+	}
+	valid := map[string]bool{}
+	for _, option := range poll.Options {
+		valid[option.OptionId] = true
+	}
+	picked := map[string]bool{}
+	for _, optionId := range optionIds {
+		if !valid[optionId] || picked[optionId] {
+			return errInvalidChoice
+		}
+		picked[optionId] = true
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		ballot := models.PollBallot{PollID: poll.PollId, Voter: voter, CreatedAt: now}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ballot)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAlreadyVoted
+		}
+
+		choices := make([]models.PollChoice, len(optionIds))
+		for i, optionId := range optionIds {
+			choices[i] = models.PollChoice{PollID: poll.PollId, Voter: voter, OptionID: optionId}
+		}
+		return tx.Create(&choices).Error
+	})
+}
+
+// Loads the poll of a post, if it has one, with the results the viewer is
+// allowed to see
+func loadPoll(postId, viewer string, now time.Time) (*models.Poll, error) {
+	var poll models.Poll
+	err := db.Preload("Options", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc")
+	}).First(&poll, "post_id = ?", postId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	poll.Closed = poll.ClosesAt != nil && !poll.ClosesAt.After(now)
+	poll.MyChoices = []string{}
+	if viewer != "" {
+		db.Model(&models.PollChoice{}).
+			Where("poll_id = ? AND voter = ?", poll.PollId, viewer).
+			Pluck("option_id", &poll.MyChoices)
+	}
+
+	poll.ResultsVisible = !poll.HideResults || poll.Closed || len(poll.MyChoices) > 0
+	if !poll.ResultsVisible {
+		return &poll, nil
+	}
+
+	var total int64
+	db.Model(&models.PollBallot{}).Where("poll_id = ?", poll.PollId).Count(&total)
+	poll.TotalVoters = &total
+
+	var counts []struct {
+		OptionID string
+		Votes    int64
+	}
+	db.Model(&models.PollChoice{}).
+		Select("option_id, COUNT(*) AS votes").
+		Where("poll_id = ?", poll.PollId).
+		Group("option_id").
+		Scan(&counts)
+	byOption := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		byOption[count.OptionID] = count.Votes
+	}
+	for i := range poll.Options {
+		votes := byOption[poll.Options[i].OptionId]
+		poll.Options[i].Votes = &votes
+	}
+	return &poll, nil
+}
+
+// Removes the poll of a post along with its options and votes
+func deletePoll(tx *gorm.DB, postId string) error {
+	var pollIds []string
+	if err := tx.Model(&models.Poll{}).Where("post_id = ?", postId).Pluck("poll_id", &pollIds).Error; err != nil {
+		return err
+	}
+	if len(pollIds) == 0 {
+		return nil
+	}
+	for _, model := range []any{&models.PollChoice{}, &models.PollBallot{}, &models.PollOption{}, &models.Poll{}} {
+		if err := tx.Where("poll_id IN ?", pollIds).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gshare.com/platform/models"
+)
+
+// Ranking modes selectable through the column parameter of getPosts
+const (
+	rankingHot    = "hot"
+	rankingRising = "rising"
+	rankingTop    = "top"
+)
+
+// Periods of the top ranking and how far back each one looks
+var topPeriods = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"all":   0,
+}
+
+var errInvalidPeriod = errors.New("period must be day, week, month or all")
+
+// Scores are measured from a fixed epoch so they never need to be recomputed
+// just because time passed
+var rankingEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// A post needs ten times the engagement to rank as high as one posted this
+// much later (12.5 hours)
+const hotDecay = 45000 * time.Second
+
+// Rising counts recent activity, halving its weight every risingHalfLife,
+// and only considers posts younger than risingMaxAge
+const (
+	risingHalfLife = 6 * time.Hour
+	risingMaxAge   = 48 * time.Hour
+)
+
+// How much each kind of activity moves a post up the rising ranking
+const (
+	activityView    = 0.1
+	activityLike    = 1
+	activityComment = 2
+)
+
+// Time-decayed score of a post's engagement. Newer posts get a head start
+// that grows linearly, while engagement counts logarithmically, so old posts
+// with many likes eventually give way to new ones.
+func hotScore(likes, dislikes, comments, views int, createdAt time.Time) float64 {
+	engagement := float64(likes-dislikes) + 2*float64(comments) + float64(views)/10
+
+	order := math.Log10(math.Max(math.Abs(engagement), 1))
+	if engagement < 0 {
+		order = -order
+	}
+	return order + createdAt.Sub(rankingEpoch).Seconds()/hotDecay.Seconds()
+}
+
+// Adds activity to a rising score. The score is kept as the logarithm of the
+// sum of every activity's weight grown exponentially from the epoch, so that
+// comparing stored scores compares the decayed totals as of any moment,
+// without ever rewriting the scores of idle posts. Zero means no activity.
+func addRisingActivity(score, weight float64, at time.Time) float64 {
+	rate := math.Ln2 / risingHalfLife.Hours()
+	added := math.Log(weight) + rate*at.Sub(rankingEpoch).Hours()
+	if score == 0 {
+		return added
+	}
+	// log(e^score + e^added) without overflowing
+	high, low := math.Max(score, added), math.Min(score, added)
+	return high + math.Log1p(math.Exp(low-high))
+}
+
+// Recomputes a post's hot score from its counters and records any new
+// activity in its rising score. Called whenever likes, dislikes, comments or
+// views change, so listings can sort on the stored scores.
+func refreshPostRanking(tx *gorm.DB, postId string, activity float64, now time.Time) error {
+	var post models.Post
+	if err := tx.Select("post_id", "created_at", "likes", "dislikes", "views", "rising_score").
+		First(&post, "post_id = ?", postId).Error; err != nil {
+		return err
+	}
+	var comments int64
+	if err := tx.Model(&models.Comment{}).Where("post_id = ?", postId).Count(&comments).Error; err != nil {
+		return err
+	}
+
+	updates := map[string]any{
+		"hot_score": hotScore(post.Likes, post.Dislikes, int(comments), post.Views, post.CreatedAt),
+	}
+	if activity > 0 {
+		updates["rising_score"] = addRisingActivity(post.RisingScore, activity, now)
+	}
+	return tx.Model(&models.Post{}).Where("post_id = ?", postId).UpdateColumns(updates).Error
+}
+
+// Orders and filters a post listing by one of the ranking modes
+func rankingScope(mode, period string, now time.Time) (func(*gorm.DB) *gorm.DB, error) {
+	switch mode {
+	case rankingHot:
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Order("hot_score desc")
+		}, nil
+
+	case rankingRising:
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("posts.created_at >= ?", now.Add(-risingMaxAge)).
+				Order("rising_score desc").
+				Order("created_at desc")
+		}, nil
+
+	case rankingTop:
+		if period == "" {
+			period = "all"
+		}
+		window, ok := topPeriods[period]
+		if !ok {
+			return nil, errInvalidPeriod
+		}
+		return func(db *gorm.DB) *gorm.DB {
+			if window > 0 {
+				db = db.Where("posts.created_at >= ?", now.Add(-window))
+			}
+			return db.Order("likes - dislikes desc").Order("created_at desc")
+		}, nil
+	}
+	return nil, nil
+}
+
+// Fills in the scores of posts created before rankings existed
+func backfillPostRankings() {
+	var postIds []string
+	db.Model(&models.Post{}).Where("hot_score = ? OR hot_score IS NULL", 0).Pluck("post_id", &postIds)
+	for _, postId := range postIds {
+		refreshPostRanking(db, postId, 0, time.Now().UTC())
+	}
+}
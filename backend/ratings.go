@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"gshare.com/platform/models"
+)
+
+// How long participants of a resolved post have to rate each other. Ratings
+// are revealed when the window closes if the other side never rated.
+const ratingWindow = 14 * 24 * time.Hour
+
+const maxReviewLength = 500
+
+var errAlreadyRated = errors.New("already rated")
+
+// Returns the average score and number of revealed ratings a member received
+func getRatingSummary(username string) (float64, int64) {
+	var summary struct {
+		Average float64
+		Count   int64
+	}
+	db.Model(&models.Rating{}).
+		Select("COALESCE(AVG(score), 0) AS average, COUNT(*) AS count").
+		Where("ratee = ? AND visible_at <= ?", username, time.Now().UTC()).
+		Scan(&summary)
+	return summary.Average, summary.Count
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gshare.com/platform/models"
+)
+
+var (
+	errOwnRepost       = errors.New("you cannot repost your own post")
+	errAlreadyReposted = errors.New("you have already reposted this post")
+	errNotReposted     = errors.New("you have not reposted this post")
+	errQuoteNotFound   = errors.New("the quoted post does not exist")
+)
+
+// Reposts a post for the member's followers
+func addRepost(post models.Post, member string, now time.Time) error {
+	if post.Author == member {
+		return errOwnRepost
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		repost := models.Repost{RepostId: uuid.New().String(), CreatedAt: now, PostID: post.PostId, Member: member}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&repost)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAlreadyReposted
+		}
+		return refreshRepostCount(tx, post.PostId)
+	})
+}
+
+// Takes back a member's repost
+func removeRepost(postId, member string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("post_id = ? AND member = ?", postId, member).Delete(&models.Repost{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errNotReposted
+		}
+		return refreshRepostCount(tx, postId)
+	})
+}
+
+// Recounts the reposts of a post. Counting rather than incrementing keeps
+// the counter right however requests interleave.
+func refreshRepostCount(tx *gorm.DB, postId string) error {
+	count := tx.Model(&models.Repost{}).Select("COUNT(*)").Where("post_id = ?", postId)
+	return tx.Model(&models.Post{}).Where("post_id = ?", postId).Update("reposts", count).Error
+}
+
+// Recounts the published quotes of a post
+func refreshQuoteCount(tx *gorm.DB, postId string) error {
+	count := tx.Model(&models.Post{}).Select("COUNT(*)").Where("quote_of = ? AND draft = ?", postId, false)
+	return tx.Model(&models.Post{}).Where("post_id = ?", postId).Update("quotes", count).Error
+}
+
+// Checks that the post a new post quotes exists and is published, and
+// records which revision of it is being quoted
+func resolveQuote(post *models.Post) error {
+	if post.QuoteOf == nil {
+		return nil
+	}
+	var quoted models.Post
+	if err := db.Scopes(published).First(&quoted, "post_id = ?", *post.QuoteOf).Error; err != nil {
+		return errQuoteNotFound
+	}
+	return db.Model(&models.PostRevision{}).Where("post_id = ?", quoted.PostId).
+		Select("COALESCE(MAX(revision), 0)").Scan(&post.QuoteRevision).Error
+}
+
+// Counts a quote post towards the post it quotes once it is published, and
+// lets that post's author know
+func publishQuote(post models.Post) error {
+	if post.QuoteOf == nil {
+		return nil
+	}
+	if err := refreshQuoteCount(db, *post.QuoteOf); err != nil {
+		return err
+	}
+
+	var quoted models.Post
+	if db.First(&quoted, "post_id = ?", *post.QuoteOf).Error == nil && quoted.Author != post.Author {
+		title := "Your post was quoted"
+		content := fmt.Sprintf("%s quoted your post %s in %s", post.Author, quoted.Title, post.Title)
+		sendAutoNotification(quoted.Author, title, content)
+	}
+	return nil
+}
+
+// Embeds the posts that quote posts quote. Quotes of deleted posts are
+// marked unavailable.
+func attachQuotedPosts(posts []models.Post) {
+	var quotedIds []string
+	for _, post := range posts {
+		if post.QuoteOf != nil {
+			quotedIds = append(quotedIds, *post.QuoteOf)
+		}
+	}
+	if len(quotedIds) == 0 {
+		return
+	}
+
+	var found []models.Post
+	db.Scopes(published).Where("post_id IN ?", quotedIds).Find(&found)
+	attachImageDetails(found)
+	byId := make(map[string]*models.Post, len(found))
+	for i := range found {
+		byId[found[i].PostId] = &found[i]
+	}
+	for i := range posts {
+		if posts[i].QuoteOf == nil {
+			continue
+		}
+		posts[i].Quoted = byId[*posts[i].QuoteOf]
+		posts[i].QuoteUnavailable = posts[i].Quoted == nil
+	}
+}
+
+// Removes the reposts of a post that is being deleted
+func deleteRepostsOfPost(tx *gorm.DB, postId string) error {
+	return tx.Where("post_id = ?", postId).Delete(&models.Repost{}).Error
+}
+
+// An item of the home feed: a post, or a repost of one, listed by the time
+// and ID it is paginated on
+type feedEntry struct {
+	post models.Post
+	at   time.Time
+	id   string
+}
+
+// Loads the reposts made by the given members, newest first, as the posts
+// they repost marked with who reposted them
+func feedReposts(members *gorm.DB, after func(*gorm.DB) *gorm.DB, limit int) ([]feedEntry, error) {
+	var reposts []models.Repost
+	err := db.Scopes(after).
+		Where("reposts.member IN (?)", members).
+		Where("reposts.post_id IN (?)", db.Model(&models.Post{}).Scopes(published).Select("post_id")).
+		Order("reposts.created_at desc").
+		Order("reposts.repost_id desc").
+		Limit(limit).
+		Find(&reposts).Error
+	if err != nil || len(reposts) == 0 {
+		return nil, err
+	}
+
+	postIds := make([]string, len(reposts))
+	for i, repost := range reposts {
+		postIds[i] = repost.PostID
+	}
+	var posts []models.Post
+	if err := db.Where("post_id IN ?", postIds).Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	byId := make(map[string]models.Post, len(posts))
+	for _, post := range posts {
+		byId[post.PostId] = post
+	}
+
+	entries := make([]feedEntry, 0, len(reposts))
+	for _, repost := range reposts {
+		post, ok := byId[repost.PostID]
+		if !ok {
+			continue
+		}
+		post.RepostedBy = repost.Member
+		post.RepostedAt = &repost.CreatedAt
+		entries = append(entries, feedEntry{post: post, at: repost.CreatedAt, id: repost.RepostId})
+	}
+	return entries, nil
+}
+
+// Merges posts and reposts into one newest-first list. A post that shows up
+// more than once, reposted by several members or also by its followed
+// author, is only listed at its newest entry.
+func mergeFeedEntries(posts []models.Post, reposts []feedEntry) []feedEntry {
+	entries := make([]feedEntry, 0, len(posts)+len(reposts))
+	for _, post := range posts {
+		entries = append(entries, feedEntry{post: post, at: post.CreatedAt, id: post.PostId})
+	}
+	entries = append(entries, reposts...)
+	slices.SortFunc(entries, func(a, b feedEntry) int {
+		if c := b.at.Compare(a.at); c != 0 {
+			return c
+		}
+		return strings.Compare(b.id, a.id)
+	})
+
+	seen := map[string]bool{}
+	merged := entries[:0]
+	for _, entry := range entries {
+		if seen[entry.post.PostId] {
+			continue
+		}
+		seen[entry.post.PostId] = true
+		merged = append(merged, entry)
+	}
+	return merged
+}
+
+// Leaves out the posts that an earlier page of the feed already listed
+// through a newer repost. Without this a post reposted after the cursor
+// would come back further down as the original or an older repost.
+func dropShownEarlier(entries []feedEntry, members *gorm.DB, cursor string) ([]feedEntry, error) {
+	if cursor == "" || len(entries) == 0 {
+		return entries, nil
+	}
+	at, id, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	postIds := make([]string, len(entries))
+	for i, entry := range entries {
+		postIds[i] = entry.post.PostId
+	}
+	// The cursor is the last entry the previous page listed, so a repost
+	// exactly at it counts as shown
+	var shownIds []string
+	err = db.Model(&models.Repost{}).
+		Where("reposts.member IN (?)", members).
+		Where("reposts.post_id IN ?", postIds).
+		Where("reposts.created_at > ? OR (reposts.created_at = ? AND reposts.repost_id >= ?)", at, at, id).
+		Distinct().
+		Pluck("reposts.post_id", &shownIds).Error
+	if err != nil || len(shownIds) == 0 {
+		return entries, err
+	}
+
+	shown := make(map[string]bool, len(shownIds))
+	for _, postId := range shownIds {
+		shown[postId] = true
+	}
+	kept := entries[:0]
+	for _, entry := range entries {
+		if !shown[entry.post.PostId] {
+			kept = append(kept, entry)
+		}
+	}
+	return kept, nil
+}
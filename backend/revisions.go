@@ -0,0 +1,52 @@
+package main
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gshare.com/platform/models"
+)
+
+// Reports whether an edit touched the parts of a post that revisions track
+func postContentChanged(previous, current models.Post) bool {
+	return previous.Title != current.Title ||
+		previous.Content != current.Content ||
+		!slices.Equal(previous.Images, current.Images)
+}
+
+// Appends the post's current title, content and images as its next revision
+func savePostRevision(tx *gorm.DB, post models.Post, editor string, at time.Time) error {
+	var latest int
+	if err := tx.Model(&models.PostRevision{}).Where("post_id = ?", post.PostId).Select("COALESCE(MAX(revision), 0)").Scan(&latest).Error; err != nil {
+		return err
+	}
+
+	revision := models.PostRevision{
+		RevisionId: uuid.New().String(),
+		PostID:     post.PostId,
+		Revision:   latest + 1,
+		CreatedAt:  at,
+		Editor:     editor,
+		Title:      post.Title,
+		Content:    post.Content,
+		Images:     post.Images,
+	}
+	return tx.Create(&revision).Error
+}
+
+// Records an edit of a post. Posts created before revisions were tracked get
+// their pre-edit state saved first so the original is never lost.
+func recordPostEdit(tx *gorm.DB, previous, current models.Post, editor string, at time.Time) error {
+	var count int64
+	if err := tx.Model(&models.PostRevision{}).Where("post_id = ?", previous.PostId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		if err := savePostRevision(tx, previous, previous.Author, previous.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return savePostRevision(tx, current, editor, at)
+}
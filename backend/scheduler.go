@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gshare.com/platform/models"
+)
+
+// How often the background jobs run
+const schedulerInterval = time.Minute
+
+// Runs the background jobs on a fixed interval. Started from main.
+func runScheduler() {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		runScheduledJobs(time.Now().UTC())
+		<-ticker.C
+	}
+}
+
+func runScheduledJobs(now time.Time) {
+	if err := publishScheduledPosts(now); err != nil {
+		log.Println("Scheduler error: publishing scheduled posts:", err)
+	}
+	if err := closeExpiredPosts(now); err != nil {
+		log.Println("Scheduler error: closing expired posts:", err)
+	}
+	if err := pruneViewRecords(now); err != nil {
+		log.Println("Scheduler error: pruning view records:", err)
+	}
+	if err := pruneExpiredPins(now); err != nil {
+		log.Println("Scheduler error: pruning expired pins:", err)
+	}
+	if err := purgeDeletedContent(now); err != nil {
+		log.Println("Scheduler error: purging deleted content:", err)
+	}
+}
+
+// Publishes the drafts whose scheduled time has passed and lets their authors know
+func publishScheduledPosts(now time.Time) error {
+	now = now.UTC()
+	var posts []models.Post
+	if err := db.Where("draft = ? AND publish_at IS NOT NULL AND publish_at <= ?", true, now).Find(&posts).Error; err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		// Only publish if the draft is still scheduled, in case the author edited it meanwhile
+		result := db.Model(&models.Post{}).
+			Where("post_id = ? AND draft = ? AND publish_at <= ?", post.PostId, true, now).
+			Updates(map[string]any{"draft": false, "created_at": *post.PublishAt, "publish_at": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		if err := refreshPostRanking(db, post.PostId, 0, now); err != nil {
+			return err
+		}
+
+		title := "Your scheduled post was published!"
+		content := fmt.Sprintf("Your post %s is now live", post.Title)
+		sendAutoNotification(post.Author, title, content)
+
+		if err := publishQuote(post); err != nil {
+			return err
+		}
+		post.Draft = false
+		if err := recordPostMentions(&post); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -66,3 +66,11 @@ func getUsername(c *gin.Context) string {
 
 	return member.Username
 }
+
+func isModerator(username string) bool {
+	var member models.Member
+	if db.First(&member, "username = ?", username).Error != nil {
+		return false
+	}
+	return member.Moderator
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"gshare.com/platform/models"
+)
+
+// Replies nest at most this deep. Top-level comments are at depth zero.
+const maxCommentDepth = 5
+
+// Levels of comments returned in a thread, counting the top level, unless
+// more or fewer are asked for
+const defaultThreadDepth = 3
+
+var (
+	errParentNotFound = errors.New("the comment being replied to does not exist on this post")
+	errCommentTooDeep = fmt.Errorf("replies cannot be nested more than %d levels deep", maxCommentDepth)
+)
+
+// Checks the comment a reply answers and places the reply one level below it
+func resolveCommentParent(comment *models.Comment) (*models.Comment, error) {
+	comment.Depth = 0
+	if comment.ParentID == nil {
+		return nil, nil
+	}
+	var parent models.Comment
+	if err := db.First(&parent, "comment_id = ? AND post_id = ?", *comment.ParentID, comment.PostID).Error; err != nil {
+		return nil, errParentNotFound
+	}
+	if parent.Depth >= maxCommentDepth {
+		return nil, errCommentTooDeep
+	}
+	comment.Depth = parent.Depth + 1
+	return &parent, nil
+}
+
+// Loads the replies below a page of comments, depth levels deep counting the
+// page itself, and nests them. Replies read oldest first. Replies below the
+// last level are left out but still counted in ReplyCount.
+func loadThreads(page []models.Comment, depth int, viewer string) ([]models.Comment, error) {
+	all := append([]models.Comment{}, page...)
+	frontier := commentIds(page)
+	for level := 1; level < depth && len(frontier) > 0; level++ {
+		var replies []models.Comment
+		if err := db.Where("parent_id IN ?", frontier).Order("created_at asc").Order("comment_id asc").Find(&replies).Error; err != nil {
+			return nil, err
+		}
+		all = append(all, replies...)
+		frontier = commentIds(replies)
+	}
+
+	var counts []struct {
+		ParentID string
+		Replies  int
+	}
+	if err := db.Model(&models.Comment{}).
+		Select("parent_id, COUNT(*) AS replies").
+		Where("parent_id IN ?", commentIds(all)).
+		Group("parent_id").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	replyCounts := make(map[string]int, len(counts))
+	for _, count := range counts {
+		replyCounts[count.ParentID] = count.Replies
+	}
+
+	attachCommentBookmarkFlags(all, viewer)
+	attachCommentMentions(all)
+	children := map[string][]models.Comment{}
+	for _, comment := range all[len(page):] {
+		children[*comment.ParentID] = append(children[*comment.ParentID], comment)
+	}
+
+	var nest func(comments []models.Comment) []models.Comment
+	nest = func(comments []models.Comment) []models.Comment {
+		thread := make([]models.Comment, len(comments))
+		for i, comment := range comments {
+			comment.ReplyCount = replyCounts[comment.CommentId]
+			comment.Replies = nest(children[comment.CommentId])
+			thread[i] = comment
+		}
+		return thread
+	}
+	return nest(all[:len(page)]), nil
+}
+
+func commentIds(comments []models.Comment) []string {
+	ids := make([]string, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.CommentId
+	}
+	return ids
+}
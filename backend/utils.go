@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 	"gshare.com/platform/models"
 )
 
@@ -34,7 +35,7 @@ func generateToken(length int) string {
 func sendAutoNotification(recipient, title, content string) error {
 	noti := models.Notification{
 		Id:        uuid.New().String(),
-		CreatedAt: time.Now(),
+		CreatedAt: time.Now().UTC(),
 		Username:  recipient,
 		Title:     title,
 		Content:   content,
@@ -42,3 +43,8 @@ func sendAutoNotification(recipient, title, content string) error {
 	}
 	return db.Create(&noti).Error
 }
+
+// Scope that leaves out drafts and posts that are scheduled but not yet published
+func published(db *gorm.DB) *gorm.DB {
+	return db.Where("posts.draft = ?", false)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gshare.com/platform/models"
+)
+
+// Repeat views by the same viewer within this window only count once
+const viewDedupWindow = 24 * time.Hour
+
+// Limits on the views-over-time range, in days
+const (
+	defaultViewHistoryDays = 30
+	maxViewHistoryDays     = 365
+)
+
+// Layout of PostViewDay.Day
+const viewDayLayout = "2006-01-02"
+
+// Identifies who is viewing a post: the member's username, or a fingerprint
+// of the client's address and user agent for anonymous visitors. The
+// fingerprint is hashed so no addresses are stored.
+func viewerKey(c *gin.Context) string {
+	if username := getUsername(c); username != "" {
+		return username
+	}
+	sum := sha256.Sum256([]byte(c.ClientIP() + "|" + c.Request.UserAgent()))
+	return "anonymous:" + hex.EncodeToString(sum[:16])
+}
+
+// Counts a view of a post unless the viewer already viewed it within the
+// dedup window. The dedup record, the post's counter and ranking, and the
+// day's history are updated in one transaction, and the counters are only
+// changed by conditional statements and in-place increments, so concurrent
+// requests can neither lose nor double count views.
+func recordPostView(postId, viewer string, now time.Time) (bool, error) {
+	counted := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Refresh a stale record, or create one if the viewer is new
+		result := tx.Model(&models.PostView{}).
+			Where("post_id = ? AND viewer = ? AND viewed_at <= ?", postId, viewer, now.Add(-viewDedupWindow)).
+			Update("viewed_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			result = tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&models.PostView{PostID: postId, Viewer: viewer, ViewedAt: now})
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&models.Post{}).Where("post_id = ?", postId).
+			Update("views", gorm.Expr("views + ?", 1)).Error; err != nil {
+			return err
+		}
+		day := models.PostViewDay{PostID: postId, Day: now.UTC().Format(viewDayLayout), Views: 1}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "post_id"}, {Name: "day"}},
+			DoUpdates: clause.Assignments(map[string]any{"views": gorm.Expr("post_view_days.views + ?", 1)}),
+		}).Create(&day).Error; err != nil {
+			return err
+		}
+		if err := refreshPostRanking(tx, postId, activityView, now); err != nil {
+			return err
+		}
+
+		counted = true
+		return nil
+	})
+	return counted, err
+}
+
+// Returns the daily view counts of a post for the days up to and including
+// today, oldest first, with days without views filled in as zero
+func postViewHistory(postId string, days int, now time.Time) ([]models.PostViewDay, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	first := today.AddDate(0, 0, -(days - 1))
+
+	var rows []models.PostViewDay
+	err := db.Where("post_id = ? AND day >= ?", postId, first.Format(viewDayLayout)).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	byDay := make(map[string]int, len(rows))
+	for _, row := range rows {
+		byDay[row.Day] = row.Views
+	}
+
+	history := make([]models.PostViewDay, 0, days)
+	for day := first; !day.After(today); day = day.AddDate(0, 0, 1) {
+		key := day.Format(viewDayLayout)
+		history = append(history, models.PostViewDay{PostID: postId, Day: key, Views: byDay[key]})
+	}
+	return history, nil
+}
+
+// Forgets dedup records that no longer suppress anything. The daily history
+// is kept.
+func pruneViewRecords(now time.Time) error {
+	return db.Where("viewed_at <= ?", now.Add(-viewDedupWindow)).Delete(&models.PostView{}).Error
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gshare.com/platform/models"
+)
+
+var (
+	errInvalidVote  = errors.New("action must be like or dislike")
+	errVoteConflict = errors.New("your vote changed while this one was being applied; try again")
+)
+
+// Values of the like and dislike actions
+var voteActions = map[string]int{"like": models.VoteLike, "dislike": models.VoteDislike}
+
+// The outcome of a vote: the member's vote before and after it, and the
+// target's counters once it was applied
+type voteResult struct {
+	Previous int
+	Current  int
+	Likes    int
+	Dislikes int
+}
+
+// Likes or dislikes a post or comment for a member. Voting the same way again
+// takes the vote back; voting the other way switches it. The vote row and the
+// target's counters change together in one transaction, and each change is
+// conditional on the row it expects, so concurrent votes cannot be lost or
+// counted twice.
+func castVote(targetType, targetId, member, action string, now time.Time) (voteResult, error) {
+	value, ok := voteActions[action]
+	if !ok {
+		return voteResult{}, errInvalidVote
+	}
+
+	var result voteResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var existing models.Vote
+		found := tx.Where("member = ? AND target_type = ? AND target_id = ?", member, targetType, targetId).
+			Limit(1).Find(&existing).RowsAffected > 0
+		vote := tx.Model(&models.Vote{}).Where("member = ? AND target_type = ? AND target_id = ? AND value = ?", member, targetType, targetId, existing.Value)
+
+		var changed *gorm.DB
+		switch {
+		case !found:
+			result.Current = value
+			changed = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Vote{
+				Member: member, TargetType: targetType, TargetID: targetId, Value: value, CreatedAt: now,
+			})
+		case existing.Value == value:
+			result.Previous = value
+			changed = vote.Delete(&models.Vote{})
+		default:
+			result.Previous = existing.Value
+			result.Current = value
+			changed = vote.Updates(map[string]any{"value": value, "created_at": now})
+		}
+		if changed.Error != nil {
+			return changed.Error
+		}
+
+		// Another vote by the member got in first and counted itself
+		if changed.RowsAffected == 0 {
+			return errVoteConflict
+		}
+		if err := adjustVoteCounters(tx, targetType, targetId, result.Previous, result.Current); err != nil {
+			return err
+		}
+		return readVoteCounters(tx, targetType, targetId, &result)
+	})
+	return result, err
+}
+
+// Moves a target's counters from one vote to another
+func adjustVoteCounters(tx *gorm.DB, targetType, targetId string, previous, current int) error {
+	counters := map[string]any{
+		"likes":    gorm.Expr("likes + ?", countsAs(current, models.VoteLike)-countsAs(previous, models.VoteLike)),
+		"dislikes": gorm.Expr("dislikes + ?", countsAs(current, models.VoteDislike)-countsAs(previous, models.VoteDislike)),
+	}
+	if targetType == models.VoteTargetPost {
+		return tx.Model(&models.Post{}).Where("post_id = ?", targetId).UpdateColumns(counters).Error
+	}
+	if err := tx.Model(&models.Comment{}).Where("comment_id = ?", targetId).UpdateColumns(counters).Error; err != nil {
+		return err
+	}
+	return refreshBestScores(tx, []string{targetId})
+}
+
+func countsAs(vote, value int) int {
+	if vote == value {
+		return 1
+	}
+	return 0
+}
+
+func readVoteCounters(tx *gorm.DB, targetType, targetId string, result *voteResult) error {
+	var counters struct {
+		Likes    int
+		Dislikes int
+	}
+	model, key := any(&models.Post{}), "post_id"
+	if targetType == models.VoteTargetComment {
+		model, key = &models.Comment{}, "comment_id"
+	}
+	if err := tx.Model(model).Select("likes", "dislikes").Where(key+" = ?", targetId).Scan(&counters).Error; err != nil {
+		return err
+	}
+	result.Likes, result.Dislikes = counters.Likes, counters.Dislikes
+	return nil
+}
+
+// Rescores comments for the best sort from their counters
+func refreshBestScores(tx *gorm.DB, commentIds []string) error {
+	var comments []models.Comment
+	if err := tx.Unscoped().Select("comment_id", "likes", "dislikes").Where("comment_id IN ?", commentIds).Find(&comments).Error; err != nil {
+		return err
+	}
+	for _, comment := range comments {
+		if err := tx.Unscoped().Model(&models.Comment{}).Where("comment_id = ?", comment.CommentId).
+			UpdateColumn("best_score", confidenceScore(comment.Likes, comment.Dislikes)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recounts the likes and dislikes of the given posts or comments from their
+// vote rows, or of every post or comment when no IDs are given
+func recountVoteCounters(tx *gorm.DB, targetType string, targetIds []string) error {
+	model, key, table := any(&models.Post{}), "post_id", "posts"
+	if targetType == models.VoteTargetComment {
+		model, key, table = &models.Comment{}, "comment_id", "comments"
+	}
+	count := func(value int) *gorm.DB {
+		return tx.Model(&models.Vote{}).Select("COUNT(*)").
+			Where("votes.target_type = ? AND votes.target_id = "+table+"."+key+" AND votes.value = ?", targetType, value)
+	}
+
+	query := tx.Unscoped().Model(model)
+	if targetIds != nil {
+		query = query.Where(key+" IN ?", targetIds)
+	} else {
+		query = query.Where("1 = 1")
+	}
+	if err := query.UpdateColumns(map[string]any{"likes": count(models.VoteLike), "dislikes": count(models.VoteDislike)}).Error; err != nil {
+		return err
+	}
+
+	if targetType == models.VoteTargetComment {
+		if targetIds == nil {
+			if err := tx.Unscoped().Model(&models.Comment{}).Pluck("comment_id", &targetIds).Error; err != nil {
+				return err
+			}
+		}
+		return refreshBestScores(tx, targetIds)
+	}
+	return nil
+}
+
+// Recounts every post's and comment's likes and dislikes from the vote rows.
+// Run with the recount-votes command.
+func recountAllVotes() error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := recountVoteCounters(tx, models.VoteTargetPost, nil); err != nil {
+			return err
+		}
+		return recountVoteCounters(tx, models.VoteTargetComment, nil)
+	})
+}
+
+// Takes back a member's votes, recounting what they voted on
+func deleteVotesOf(tx *gorm.DB, member string) error {
+	var votes []models.Vote
+	if err := tx.Where("member = ?", member).Find(&votes).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("member = ?", member).Delete(&models.Vote{}).Error; err != nil {
+		return err
+	}
+	targets := map[string][]string{}
+	for _, vote := range votes {
+		targets[vote.TargetType] = append(targets[vote.TargetType], vote.TargetID)
+	}
+	for targetType, targetIds := range targets {
+		if err := recountVoteCounters(tx, targetType, targetIds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes the votes on posts or comments that are being purged
+func deleteVotesOn(tx *gorm.DB, targetType string, targetIds []string) error {
+	return tx.Where("target_type = ? AND target_id IN ?", targetType, targetIds).Delete(&models.Vote{}).Error
+}
+
+// Moves votes out of the join tables that held each kind of vote before the
+// votes table, then recounts from them. Each table is only renamed out of the
+// way, not dropped, and only once every row in it is found in the votes table.
+// Runs at startup; the migrate-votes command runs it again on its own.
+func migrateLegacyVotes() error {
+	legacy := []struct {
+		table, column, targetType string
+		value                     int
+	}{
+		{"member_likes", "post_post_id", models.VoteTargetPost, models.VoteLike},
+		{"member_dislikes", "post_post_id", models.VoteTargetPost, models.VoteDislike},
+		{"member_comment_likes", "comment_comment_id", models.VoteTargetComment, models.VoteLike},
+		{"member_comment_dislikes", "comment_comment_id", models.VoteTargetComment, models.VoteDislike},
+	}
+	migrated := false
+	for _, votes := range legacy {
+		if !db.Migrator().HasTable(votes.table) {
+			continue
+		}
+		// Likes go first, so a member somehow in both tables keeps the like
+		err := db.Exec("INSERT INTO votes (member, target_type, target_id, value, created_at) "+
+			"SELECT member_username, ?, "+votes.column+", ?, ? FROM "+votes.table+" WHERE true ON CONFLICT DO NOTHING",
+			votes.targetType, votes.value, time.Now().UTC()).Error
+		if err != nil {
+			return fmt.Errorf("failed to migrate votes from %s: %w", votes.table, err)
+		}
+
+		var missing int64
+		err = db.Raw("SELECT COUNT(*) FROM "+votes.table+" WHERE NOT EXISTS (SELECT 1 FROM votes "+
+			"WHERE votes.member = member_username AND votes.target_type = ? AND votes.target_id = "+votes.column+")",
+			votes.targetType).Scan(&missing).Error
+		if err != nil {
+			return fmt.Errorf("failed to check the votes copied from %s: %w", votes.table, err)
+		}
+		if missing > 0 {
+			return fmt.Errorf("%d votes in %s were not copied; leaving it in place", missing, votes.table)
+		}
+		if err := db.Migrator().RenameTable(votes.table, votes.table+"_migrated"); err != nil {
+			return fmt.Errorf("failed to rename %s: %w", votes.table, err)
+		}
+		log.Println("Migrated the votes in", votes.table, "and renamed it to", votes.table+"_migrated")
+		migrated = true
+	}
+	if migrated {
+		return recountAllVotes()
+	}
+	return nil
+}
+
+// Posts a member voted on the given way, latest vote first
+func votedPosts(member string, value int) ([]models.Post, error) {
+	posts := []models.Post{}
+	err := db.Joins("JOIN votes ON votes.target_id = posts.post_id AND votes.target_type = ?", models.VoteTargetPost).
+		Where("votes.member = ? AND votes.value = ?", member, value).
+		Order("votes.created_at desc").
+		Find(&posts).Error
+	return posts, err
+}
+
+// Comments a member voted on the given way, latest vote first
+func votedComments(member string, value int) ([]models.Comment, error) {
+	comments := []models.Comment{}
+	err := db.Joins("JOIN votes ON votes.target_id = comments.comment_id AND votes.target_type = ?", models.VoteTargetComment).
+		Where("votes.member = ? AND votes.value = ?", member, value).
+		Order("votes.created_at desc").
+		Find(&comments).Error
+	return comments, err
+}